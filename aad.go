@@ -0,0 +1,52 @@
+package encrypt
+
+import "io"
+
+// NewWriterAAD returns a new Writer that encrypts data with key before writing to w,
+// authenticating the additional data returned by aad along with each chunk of data without writing it.
+// aad is called with the index of each chunk, starting from 0,
+// so the additional data can be derived from state that both ends of a protocol share,
+// such as a session ID and the chunk's sequence number,
+// binding the stream to that context without transmitting it.
+// A fixed context can be bound by returning the same value for every index.
+//
+// The stream must be read by NewReaderAAD with an aad function that returns the same additional data for each index;
+// any chunk whose additional data differs fails to authenticate with ErrAuthFailed.
+// In a stream with a header, only the chunks of data are bound, not the header or the end of the stream.
+func NewWriterAAD(w io.Writer, key Key, aad func(chunkIndex int64) []byte) *Writer {
+	return &Writer{
+		w:   w,
+		key: key,
+		aad: aad,
+	}
+}
+
+// NewReaderAAD returns a new Reader for decrypting r,
+// where r was encrypted by a Writer from NewWriterAAD using key and an aad function
+// that returns the same additional data for each chunk index.
+// Seeking is supported, since aad is called with the index of whichever chunk is read next.
+func NewReaderAAD(r io.Reader, key Key, aad func(chunkIndex int64) []byte) *Reader {
+	return &Reader{
+		r:   r,
+		key: key,
+		aad: aad,
+	}
+}
+
+// chunkAD appends the additional data of the next chunk of data to ad,
+// when the Writer was created by NewWriterAAD.
+func (w *Writer) chunkAD(ad []byte) []byte {
+	if w.aad == nil {
+		return ad
+	}
+	return append(ad, w.aad(w.index)...)
+}
+
+// chunkAD appends the additional data of the next chunk of data to ad,
+// when the Reader was created by NewReaderAAD.
+func (r *Reader) chunkAD(ad []byte) []byte {
+	if r.aad == nil {
+		return ad
+	}
+	return append(ad, r.aad(r.index)...)
+}
@@ -0,0 +1,72 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+// sessionAAD returns an aad function that binds each chunk to a session ID and its sequence number.
+func sessionAAD(session string) func(int64) []byte {
+	return func(index int64) []byte {
+		ad := make([]byte, 8, 8+len(session))
+		binary.BigEndian.PutUint64(ad, uint64(index))
+		return append(ad, session...)
+	}
+}
+
+func TestNewWriterAAD(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := make([]byte, 3*encrypt.ChunkSize+10)
+	for i := range plaintext {
+		plaintext[i] = byte(i)
+	}
+
+	for _, withHeader := range []bool{false, true} {
+		buf := &bytes.Buffer{}
+		w := encrypt.NewWriterAAD(buf, key, sessionAAD("session 1"))
+		if withHeader {
+			w.SetMetadata(map[string]string{"name": "data.bin"})
+		}
+		if err := w.WriteAndClose(plaintext); err != nil {
+			t.Fatal(err)
+		}
+		ciphertext := buf.Bytes()
+
+		r := encrypt.NewReaderAAD(bytes.NewReader(ciphertext), key, sessionAAD("session 1"))
+		if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, plaintext) {
+			t.Errorf("header %v: expected the plaintext to round trip; got %d bytes/%v", withHeader, len(got), err)
+		}
+		// seeking reads a later chunk with its own index
+		r = encrypt.NewReaderAAD(bytes.NewReader(ciphertext), key, sessionAAD("session 1"))
+		if _, err := r.Seek(2*encrypt.ChunkSize+5, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, plaintext[2*encrypt.ChunkSize+5:]) {
+			t.Errorf("header %v: expected the plaintext after seeking; got %d bytes/%v", withHeader, len(got), err)
+		}
+
+		r = encrypt.NewReaderAAD(bytes.NewReader(ciphertext), key, sessionAAD("session 2"))
+		if _, err := io.ReadAll(r); !errors.Is(err, encrypt.ErrAuthFailed) {
+			t.Errorf("header %v: expected ErrAuthFailed for a different session; got %v", withHeader, err)
+		}
+		// deriving the additional data from a different index fails from the chunk where they differ
+		shifted := func(index int64) []byte {
+			if index == 2 {
+				index = 3
+			}
+			return sessionAAD("session 1")(index)
+		}
+		r = encrypt.NewReaderAAD(bytes.NewReader(ciphertext), key, shifted)
+		if n, err := io.ReadFull(r, make([]byte, len(plaintext))); n != 2*encrypt.ChunkSize || !errors.Is(err, encrypt.ErrAuthFailed) {
+			t.Errorf("header %v: expected %d/ErrAuthFailed; got %d/%v", withHeader, 2*encrypt.ChunkSize, n, err)
+		}
+		if _, err := io.ReadAll(encrypt.NewReader(bytes.NewReader(ciphertext), key)); !errors.Is(err, encrypt.ErrAuthFailed) {
+			t.Errorf("header %v: expected ErrAuthFailed without the additional data; got %v", withHeader, err)
+		}
+	}
+}
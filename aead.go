@@ -0,0 +1,57 @@
+package encrypt
+
+import (
+	"crypto/cipher"
+	"fmt"
+	"io"
+)
+
+// NewWriterAEAD returns a new Writer that encrypts data before writing to w,
+// using the AEAD returned by newAEAD for key instead of AES-GCM.
+// This allows advanced users to choose their own algorithm.
+// The nonce and tag sizes of each chunk are taken from the AEAD,
+// and each nonce is generated randomly, so the AEAD should accept nonces of at least 12 bytes.
+//
+// The algorithm is not recorded in the output, although a header marks it as custom,
+// so the output must be decrypted by NewReaderAEAD with an equivalent newAEAD.
+// If newAEAD returns an error, it is returned by every call to Write and Close.
+// Callers must call Close to write the final chunk of data.
+func NewWriterAEAD(w io.Writer, key Key, newAEAD func(key []byte) (cipher.AEAD, error)) *Writer {
+	writer := &Writer{
+		w:   w,
+		key: key,
+	}
+	aead, err := newAEAD(key.Bytes())
+	if err != nil {
+		writer.err = fmt.Errorf("encrypt.NewWriterAEAD: %w", keySizeError(err))
+		return writer
+	}
+	writer.aead = aead
+	writer.custom = true
+	return writer
+}
+
+// NewReaderAEAD returns a new Reader for decrypting r,
+// where r was encrypted by a Writer from NewWriterAEAD using key and an equivalent newAEAD.
+// If newAEAD returns an error, it is returned by every call to Read.
+func NewReaderAEAD(r io.Reader, key Key, newAEAD func(key []byte) (cipher.AEAD, error)) *Reader {
+	reader := &Reader{
+		r:   r,
+		key: key,
+	}
+	aead, err := newAEAD(key.Bytes())
+	if err != nil {
+		reader.err = fmt.Errorf("encrypt.NewReaderAEAD: %w", keySizeError(err))
+		return reader
+	}
+	reader.aead = aead
+	return reader
+}
+
+// AEAD returns the AES-256-GCM AEAD with 12-byte nonces that encrypts each chunk of a Writer's default format,
+// for use with libraries that accept a cipher.AEAD and handle their own framing.
+// Messages sealed with it are not chunked; a message of the form nonce|ciphertext|tag
+// with no additional data can be decrypted by OpenSingle.
+func AEAD(key Key) (cipher.AEAD, error) {
+	return newGCM(key, nonceSize)
+}
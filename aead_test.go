@@ -0,0 +1,133 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+// newShortTagGCM returns AES-GCM with a 12-byte tag,
+// so that its overhead differs from the default.
+func newShortTagGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCMWithTagSize(block, 12)
+}
+
+func TestNewWriterAEAD(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+
+	for _, withHeader := range []bool{false, true} {
+		buf := &bytes.Buffer{}
+		w := encrypt.NewWriterAEAD(buf, key, newShortTagGCM)
+		if withHeader {
+			w.SetMetadata(map[string]string{"name": "data.bin"})
+		}
+		w.Write(plaintext)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		decrypted, err := io.ReadAll(encrypt.NewReaderAEAD(bytes.NewReader(buf.Bytes()), key, newShortTagGCM))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("plaintext does not match")
+		}
+
+		r := encrypt.NewReaderAEAD(bytes.NewReader(buf.Bytes()), key, newShortTagGCM)
+		if offset, err := r.Seek(-100, io.SeekEnd); err != nil || offset != int64(len(plaintext)-100) {
+			t.Fatalf("expected %d/nil; got %d/%v", len(plaintext)-100, offset, err)
+		}
+		tail, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(tail, plaintext[len(plaintext)-100:]) {
+			t.Errorf("plaintext after seek does not match")
+		}
+
+		if _, err := io.ReadAll(encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)); err == nil {
+			t.Errorf("expected an error decrypting with the default AEAD")
+		}
+
+		if withHeader {
+			h, _, err := encrypt.ReadHeader(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h.Cipher != "custom" {
+				t.Errorf("expected the header to report a custom cipher; got %q", h.Cipher)
+			}
+		}
+	}
+}
+
+func TestNewWriterAEAD_error(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	failed := errors.New("unsupported")
+	newAEAD := func(key []byte) (cipher.AEAD, error) { return nil, failed }
+
+	w := encrypt.NewWriterAEAD(&bytes.Buffer{}, key, newAEAD)
+	if _, err := w.Write([]byte("Hello, world!")); !errors.Is(err, failed) {
+		t.Errorf("expected Write to return %v; got %v", failed, err)
+	}
+	if err := w.Close(); !errors.Is(err, failed) {
+		t.Errorf("expected Close to return %v; got %v", failed, err)
+	}
+	if _, err := encrypt.NewReaderAEAD(&bytes.Buffer{}, key, newAEAD).Read(make([]byte, 10)); !errors.Is(err, failed) {
+		t.Errorf("expected Read to return %v; got %v", failed, err)
+	}
+}
+
+func TestAEAD(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	aead, err := encrypt.AEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aead.NonceSize() != 12 || aead.Overhead() != 16 {
+		t.Errorf("expected 12-byte nonces and 16-byte tags; got %d and %d", aead.NonceSize(), aead.Overhead())
+	}
+	plaintext := []byte("Hello, world!")
+	nonce := make([]byte, aead.NonceSize())
+	opened, err := encrypt.OpenSingle(aead.Seal(nonce, nonce, plaintext, nil), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("expected a message sealed by the AEAD to open with OpenSingle")
+	}
+}
+
+func TestKeySizeError(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	truncated := func(key []byte) (cipher.AEAD, error) {
+		block, err := aes.NewCipher(key[:20])
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	}
+	w := encrypt.NewWriterAEAD(&bytes.Buffer{}, key, truncated)
+	_, err := w.Write([]byte("Hello, world!"))
+	var kse encrypt.KeySizeError
+	if !errors.As(err, &kse) || kse != 20 {
+		t.Errorf("expected a KeySizeError of 20; got %v", err)
+	}
+	if !errors.Is(err, encrypt.ErrInvalidKeyLength) {
+		t.Errorf("expected the error to match ErrInvalidKeyLength; got %v", err)
+	}
+	if _, err := encrypt.NewGCMSIV(make([]byte, 24)); !errors.As(err, &kse) || kse != 24 {
+		t.Errorf("expected a KeySizeError of 24 from NewGCMSIV; got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package encrypt
+
+import (
+	"encoding/base64"
+	"io"
+)
+
+// armorLineWidth is the line length of NewArmoredWriter, which is the limit for MIME-encoded email.
+const armorLineWidth = 76
+
+// ArmoredWriter encrypts data and encodes the ciphertext with standard base64 as it is written,
+// so that it can be embedded in text such as email or JSON.
+// It is created by NewArmoredWriter or NewArmoredWriterWidth.
+type ArmoredWriter struct {
+	w     *Writer
+	b64   io.WriteCloser
+	lines *lineWriter
+}
+
+// NewArmoredWriter returns an ArmoredWriter that encrypts data with key and writes it to w as base64,
+// in lines of 76 characters.
+// The output is streamed, and can be decrypted by NewArmoredReader.
+// Callers must call Close to write the end of the output.
+func NewArmoredWriter(w io.Writer, key Key) *ArmoredWriter {
+	return NewArmoredWriterWidth(w, key, armorLineWidth)
+}
+
+// NewArmoredWriterWidth is like NewArmoredWriter but breaks the output into lines of width characters,
+// or writes it as a single line if width is zero.
+func NewArmoredWriterWidth(w io.Writer, key Key, width int) *ArmoredWriter {
+	lines := &lineWriter{w: w, width: width}
+	b64 := base64.NewEncoder(base64.StdEncoding, lines)
+	return &ArmoredWriter{
+		w:     NewWriter(b64, key),
+		b64:   b64,
+		lines: lines,
+	}
+}
+
+// Write encrypts p, writing the encoded ciphertext of any chunks that it completes.
+func (a *ArmoredWriter) Write(p []byte) (int, error) {
+	return a.w.Write(p)
+}
+
+// Close writes the final chunk and the end of the encoding, followed by a newline if the output is wrapped.
+// It doesn't close the underlying writer.
+func (a *ArmoredWriter) Close() error {
+	if err := a.w.Close(); err != nil {
+		return err
+	}
+	if err := a.b64.Close(); err != nil {
+		return err
+	}
+	return a.lines.end()
+}
+
+// NewArmoredReader returns a Reader that decrypts r,
+// which was written by an ArmoredWriter using key.
+// Line breaks in r are ignored.
+// The Reader doesn't support Seek, since positions in the encoding don't match the ciphertext.
+func NewArmoredReader(r io.Reader, key Key) *Reader {
+	return NewReader(base64.NewDecoder(base64.StdEncoding, r), key)
+}
+
+// lineWriter inserts a newline into its output after every width bytes, if width is positive.
+type lineWriter struct {
+	w     io.Writer
+	width int
+	col   int // col is the number of bytes written on the current line
+}
+
+func (l *lineWriter) Write(p []byte) (n int, err error) {
+	if l.width <= 0 {
+		return l.w.Write(p)
+	}
+	for len(p) > 0 {
+		if l.col == l.width {
+			if _, err := l.w.Write([]byte{'\n'}); err != nil {
+				return n, err
+			}
+			l.col = 0
+		}
+		chunk := p
+		if len(chunk) > l.width-l.col {
+			chunk = chunk[:l.width-l.col]
+		}
+		nn, err := l.w.Write(chunk)
+		n += nn
+		l.col += nn
+		if err != nil {
+			return n, err
+		}
+		p = p[nn:]
+	}
+	return n, nil
+}
+
+// end terminates the final line of wrapped output.
+func (l *lineWriter) end() error {
+	if l.width <= 0 || l.col == 0 {
+		return nil
+	}
+	l.col = 0
+	_, err := l.w.Write([]byte{'\n'})
+	return err
+}
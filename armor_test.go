@@ -0,0 +1,43 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestArmoredWriter(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := make([]byte, encrypt.ChunkSize*2+10)
+	for i := range plaintext {
+		plaintext[i] = byte(i)
+	}
+	for _, width := range []int{0, 64, 76} {
+		buf := &bytes.Buffer{}
+		w := encrypt.NewArmoredWriterWidth(buf, key, width)
+		if _, err := io.CopyBuffer(w, bytes.NewReader(plaintext), make([]byte, 1000)); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		if width == 0 && len(lines) != 1 {
+			t.Errorf("expected a single line; got %d", len(lines))
+		}
+		for i, line := range lines {
+			if width > 0 && (len(line) > width || i < len(lines)-1 && len(line) != width) {
+				t.Fatalf("width %d: line %d has %d characters", width, i, len(line))
+			}
+		}
+
+		got, err := io.ReadAll(encrypt.NewArmoredReader(buf, key))
+		if err != nil || !bytes.Equal(got, plaintext) {
+			t.Errorf("width %d: decrypted stream doesn't match: %v", width, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestWriter_EnableChain(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	for _, toc := range []bool{false, true} {
+		buf := &bytes.Buffer{}
+		w := encrypt.NewWriter(buf, key)
+		if err := w.EnableChain(); err != nil {
+			t.Fatal(err)
+		}
+		if toc {
+			w.EnableTOC()
+		}
+		w.SetChunkSize(1024)
+		w.Write(plaintext)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		r := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+		decrypted, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("plaintext does not match")
+		}
+		for _, offset := range []int64{0, 1023, 1024, 5000, int64(len(plaintext)) - 1, int64(len(plaintext))} {
+			if _, err := r.Seek(offset, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("toc %v: reading from offset %d: %v", toc, offset, err)
+			}
+			if !bytes.Equal(got, plaintext[offset:]) {
+				t.Errorf("toc %v: plaintext from offset %d does not match", toc, offset)
+			}
+		}
+	}
+}
+
+func TestWriter_EnableChain_tampering(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	encryptChunks := func(chained bool) ([]byte, []encrypt.ChunkEntry) {
+		buf := &bytes.Buffer{}
+		w := encrypt.NewWriter(buf, key)
+		if chained {
+			w.EnableChain()
+		}
+		w.EnableTOC()
+		w.SetChunkSize(1024)
+		w.Write(plaintext)
+		w.Close()
+		return buf.Bytes(), w.TOC()
+	}
+
+	for _, chained := range []bool{false, true} {
+		ciphertext, toc := encryptChunks(chained)
+		// modifying record 3 should also invalidate record 4 when the records are chained
+		ciphertext[toc[3].Offset+20] ^= 1
+		r := encrypt.NewReader(bytes.NewReader(ciphertext), key)
+		if _, err := r.Seek(toc[4].PlaintextOffset, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		_, err := r.Read(make([]byte, 10))
+		if !chained && err != nil {
+			t.Errorf("expected record 4 of an unchained stream to be readable; got %v", err)
+		}
+		if chained && (!errors.Is(err, encrypt.ErrAuthFailed) || !strings.Contains(err.Error(), "record 4")) {
+			t.Errorf("expected record 4 of a chained stream to fail authentication; got %v", err)
+		}
+	}
+
+	ciphertext, _ := encryptChunks(true)
+	h, _, err := encrypt.ReadHeader(bytes.NewReader(ciphertext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.Chained {
+		t.Errorf("expected the header to report a chained stream")
+	}
+}
@@ -0,0 +1,34 @@
+package encrypt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const checkpointVersion = 1
+
+// Checkpoint returns a small token that records the current position of r,
+// which can be persisted and later passed to Restore on a new Reader for the same stream,
+// for example to continue an interrupted download.
+func (r *Reader) Checkpoint() []byte {
+	return appendUvarint([]byte{checkpointVersion}, uint64(r.offset-r.start))
+}
+
+// Restore moves r to the position recorded in a token from Checkpoint.
+// Like Seek, backward moves require the underlying reader to implement io.Seeker,
+// so Restore is normally called on a new Reader whose source can seek to the recorded position.
+func (r *Reader) Restore(token []byte) error {
+	if len(token) == 0 || token[0] != checkpointVersion {
+		return errors.New("encrypt.Reader.Restore: unsupported checkpoint")
+	}
+	offset, n := binary.Uvarint(token[1:])
+	if n <= 0 || n != len(token)-1 || offset > 1<<63-1 {
+		return errors.New("encrypt.Reader.Restore: malformed checkpoint")
+	}
+	if _, err := r.Seek(int64(offset), io.SeekStart); err != nil {
+		return fmt.Errorf("encrypt.Reader.Restore: %w", err)
+	}
+	return nil
+}
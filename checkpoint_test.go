@@ -0,0 +1,44 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestReader_Checkpoint(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.Write(plaintext)
+	w.Close()
+
+	r := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+	io.ReadFull(r, make([]byte, chunkSize+123))
+	token := r.Checkpoint()
+	if len(token) > 10 {
+		t.Errorf("expected a small token; got %d bytes", len(token))
+	}
+
+	// the download is interrupted and continued with a new source
+	r = encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+	if err := r.Restore(token); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, plaintext[chunkSize+123:]) {
+		t.Errorf("plaintext after restore does not match")
+	}
+
+	for _, token := range [][]byte{nil, {2, 0}, {1}, {1, 0x80}, append(r.Checkpoint(), 0)} {
+		if err := r.Restore(token); err == nil {
+			t.Errorf("expected an error restoring %v", token)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package encrypt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// checksumSize is the size of the CRC-32C that follows each record when checksums are enabled.
+const checksumSize = 4
+
+// castagnoli is the table for CRC-32C, which is computed in hardware on most CPUs.
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrChecksumMismatch is returned by QuickCheck when a record doesn't match its checksum.
+var ErrChecksumMismatch = errors.New("encrypt: checksum mismatch")
+
+// EnableChecksums makes w follow each record of the stream with a CRC-32C of its ciphertext,
+// which QuickCheck verifies far faster than decrypting the stream,
+// as a first pass when scrubbing large amounts of stored data for corruption.
+// The checksums are not a security feature:
+// anyone can recompute them after modifying a record,
+// and only decrypting the stream authenticates it.
+// A Reader skips them.
+//
+// EnableChecksums must be called before any data has been written to the underlying writer.
+// It is not supported for detached, padded, uniform, or resumed streams, or with a table of contents.
+func (w *Writer) EnableChecksums() error {
+	switch {
+	case w.started:
+		return errors.New("encrypt.Writer.EnableChecksums: data has already been written")
+	case w.tags != nil:
+		return errors.New("encrypt.Writer.EnableChecksums: not supported with detached tags")
+	case w.bucket > 0:
+		return errors.New("encrypt.Writer.EnableChecksums: not supported for padded streams")
+	case w.resumed:
+		return errors.New("encrypt.Writer.EnableChecksums: not supported for resumed streams")
+	case w.header != nil && w.header.uniform:
+		return errors.New("encrypt.Writer.EnableChecksums: not supported for uniform streams")
+	case w.header != nil && w.header.toc:
+		return errors.New("encrypt.Writer.EnableChecksums: not supported with a table of contents")
+	}
+	if w.header == nil {
+		w.header = &header{}
+	}
+	w.header.checksums = true
+	return nil
+}
+
+// appendChecksum appends the CRC-32C of record to it.
+func appendChecksum(record []byte) []byte {
+	sum := crc32.Checksum(record, castagnoli)
+	record = append(record, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(record[len(record)-checksumSize:], sum)
+	return record
+}
+
+// QuickCheck reads r, which was written by a Writer using key after a call to EnableChecksums,
+// and verifies the checksum of every record without decrypting anything.
+// It returns ErrChecksumMismatch if a record was corrupted,
+// ErrTruncated if the stream ends early,
+// and ErrAuthFailed if the header identifies a key other than key.
+//
+// A nil error means that the stream is intact as far as checksums can tell,
+// but not that it is authentic; reading it with a Reader is still the only way to detect tampering.
+func QuickCheck(r io.Reader, key Key) error {
+	prefix := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return fmt.Errorf("encrypt.QuickCheck: %w", truncated(err))
+	}
+	if string(prefix) != magic {
+		return errors.New("encrypt.QuickCheck: stream has no checksums")
+	}
+	h, _, err := parseHeader(r)
+	if err != nil {
+		return err
+	}
+	if !h.checksums {
+		return errors.New("encrypt.QuickCheck: stream has no checksums")
+	}
+	if h.fingerprint != nil && !bytes.Equal(h.fingerprint, key.Fingerprint()) {
+		return ErrAuthFailed
+	}
+	limit := int64(h.nonceSize() + maxChunkSize + tagSize)
+	var record []byte
+	for index := 0; ; index++ {
+		record = append(record[:0], 0, 0, 0, 0, 0)
+		if _, err := io.ReadFull(r, record); err != nil {
+			return truncated(err)
+		}
+		length := int64(binary.BigEndian.Uint32(record[1:]))
+		if length > limit {
+			return ErrChunkTooLarge
+		}
+		record = grow(record, int(length)+checksumSize)[:recordHeaderSize+int(length)+checksumSize]
+		if _, err := io.ReadFull(r, record[recordHeaderSize:]); err != nil {
+			return truncated(err)
+		}
+		body := record[:len(record)-checksumSize]
+		if crc32.Checksum(body, castagnoli) != binary.BigEndian.Uint32(record[len(body):]) {
+			return fmt.Errorf("encrypt.QuickCheck: record %d: %w", index, ErrChecksumMismatch)
+		}
+		if record[0] == recordEnd {
+			break
+		}
+	}
+	if h.trailer {
+		if _, err := io.CopyN(io.Discard, r, trailerSize); err != nil {
+			return truncated(err)
+		}
+	}
+	if _, err := io.ReadFull(r, make([]byte, 1)); err == nil {
+		return errors.New("encrypt.QuickCheck: unexpected data after the end of the stream")
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestQuickCheck(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := make([]byte, encrypt.ChunkSize*2+10)
+	for i := range plaintext {
+		plaintext[i] = byte(i)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		enable func(w *encrypt.Writer) error
+	}{
+		{"checksums", func(w *encrypt.Writer) error { return nil }},
+		{"chained", (*encrypt.Writer).EnableChain},
+		{"trailer", (*encrypt.Writer).EnableTrailer},
+	} {
+		buf := &bytes.Buffer{}
+		w := encrypt.NewWriter(buf, key)
+		if err := w.EnableChecksums(); err != nil {
+			t.Fatal(err)
+		}
+		if err := tc.enable(w); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.EnableTOC(); err == nil {
+			t.Errorf("%s: expected an error enabling a table of contents with checksums", tc.name)
+		}
+		w.Write(plaintext)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		ciphertext := buf.Bytes()
+
+		if err := encrypt.QuickCheck(bytes.NewReader(ciphertext), key); err != nil {
+			t.Errorf("%s: expected the checksums to verify; got %v", tc.name, err)
+		}
+		hdr, _, err := encrypt.ReadHeader(bytes.NewReader(ciphertext))
+		if err != nil || !hdr.Checksums {
+			t.Errorf("%s: expected the header to report checksums; got %v/%v", tc.name, hdr.Checksums, err)
+		}
+
+		// a Reader skips the checksums, including when seeking
+		r := encrypt.NewReader(bytes.NewReader(ciphertext), key)
+		if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, plaintext) {
+			t.Errorf("%s: expected the plaintext to round trip; got %d bytes/%v", tc.name, len(got), err)
+		}
+		if _, err := r.Seek(-20, io.SeekEnd); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, plaintext[len(plaintext)-20:]) {
+			t.Errorf("%s: expected the end of the plaintext after seeking; got %v/%v", tc.name, got, err)
+		}
+		if _, err := r.Seek(encrypt.ChunkSize+5, io.SeekStart); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, plaintext[encrypt.ChunkSize+5:]) {
+			t.Errorf("%s: expected the plaintext after seeking into the second chunk; got %d bytes/%v", tc.name, len(got), err)
+		}
+
+		corrupted := append([]byte{}, ciphertext...)
+		corrupted[len(corrupted)/2] ^= 1
+		if err := encrypt.QuickCheck(bytes.NewReader(corrupted), key); !errors.Is(err, encrypt.ErrChecksumMismatch) {
+			t.Errorf("%s: expected ErrChecksumMismatch for a corrupted stream; got %v", tc.name, err)
+		}
+		if err := encrypt.QuickCheck(bytes.NewReader(ciphertext[:len(ciphertext)-40]), key); !errors.Is(err, encrypt.ErrTruncated) {
+			t.Errorf("%s: expected ErrTruncated; got %v", tc.name, err)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.EnableChecksums()
+	w.WriteAndClose(plaintext)
+	other, _ := encrypt.NewKey()
+	if err := encrypt.QuickCheck(bytes.NewReader(buf.Bytes()), other); !errors.Is(err, encrypt.ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed for a stream written with another key; got %v", err)
+	}
+
+	buf.Reset()
+	w = encrypt.NewWriter(buf, key)
+	w.SetMetadata(map[string]string{"name": "data.bin"})
+	w.WriteAndClose(plaintext)
+	if err := encrypt.QuickCheck(bytes.NewReader(buf.Bytes()), key); err == nil {
+		t.Errorf("expected an error for a stream without checksums")
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+
+package encrypt
+
+import "os"
+
+// chown is a no-op on platforms without Unix file ownership.
+func chown(f *os.File, info os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,60 @@
+package encrypt
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+)
+
+// EncryptChunk encrypts plaintext with key as the chunk at position index of a stream,
+// appending nonce|ciphertext|tag to dst and returning the updated slice.
+// The index is authenticated as additional data,
+// so DecryptChunk fails if the chunk is presented at any other position.
+// This is the primitive beneath the records of a stream with a header,
+// for programs that frame and index the chunks in a container format of their own.
+// Unlike a record written by Writer, the chunk isn't bound to a header,
+// so the caller is also responsible for binding chunks to their container if they must not be moved between containers
+// that share a key, for example by using a different key for each.
+//
+// The result is sealed directly into the spare capacity of dst when there is room for it.
+// The cipher is set up for key on each call,
+// so the chunks should be large enough for that cost to be small;
+// each should also be no larger than a few megabytes,
+// and the caller is responsible for detecting chunks that are missing from the end of its container.
+func EncryptChunk(dst, plaintext []byte, key Key, index int64) ([]byte, error) {
+	gcm, err := AEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return sealRecord(gcm, dst, plaintext, recordAD(recordData, index, nil))
+}
+
+// DecryptChunk decrypts a chunk that was encrypted by EncryptChunk with key at position index.
+// If the chunk was altered or belongs at a different index, ErrAuthFailed is returned.
+func DecryptChunk(ciphertext []byte, key Key, index int64) ([]byte, error) {
+	gcm, err := AEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return openRecord(gcm, nil, ciphertext, recordAD(recordData, index, nil))
+}
+
+// recordAD returns the additional data authenticated with each record of a stream with a header:
+// the kind and index of the record followed by binding, the hash of the stream's header.
+func recordAD(kind byte, index int64, binding []byte) []byte {
+	ad := make([]byte, 9, 9+len(binding))
+	ad[0] = kind
+	binary.BigEndian.PutUint64(ad[1:], uint64(index))
+	return append(ad, binding...)
+}
+
+// sealRecord seals plaintext with aead and appends the payload of a record, nonce|ciphertext|tag, to dst,
+// reusing the capacity of dst when it is large enough.
+// It is shared by Writer and EncryptChunk, so that every payload has the same form.
+func sealRecord(aead cipher.AEAD, dst, plaintext, ad []byte) ([]byte, error) {
+	return encryptTo(aead, dst, plaintext, ad)
+}
+
+// openRecord opens a payload sealed by sealRecord, appending the plaintext to dst.
+func openRecord(aead cipher.AEAD, dst, payload, ad []byte) ([]byte, error) {
+	return decrypt(aead, dst, payload, ad)
+}
@@ -0,0 +1,52 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestEncryptChunk(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := []byte("Hello, world!")
+	prefix := []byte("frame:")
+	sealed, err := encrypt.EncryptChunk(prefix, plaintext, key, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(sealed, prefix) {
+		t.Errorf("expected the chunk to be appended to dst")
+	}
+	chunk := sealed[len(prefix):]
+	opened, err := encrypt.DecryptChunk(chunk, key, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("plaintext does not match")
+	}
+	if _, err := encrypt.DecryptChunk(chunk, key, 8); !errors.Is(err, encrypt.ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed at a different index; got %v", err)
+	}
+
+	// the chunk is sealed into the spare capacity of dst
+	dst := make([]byte, 0, 64)
+	if sealed, err := encrypt.EncryptChunk(dst, plaintext, key, 7); err != nil || &sealed[0] != &dst[:1][0] {
+		t.Errorf("expected the chunk to be sealed into the capacity of dst; got %v", err)
+	}
+
+	// a data record of a stream is also bound to the stream's header, so it can't be opened as a lone chunk
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.SetChunkSize(16)
+	w.Write(plaintextData()[:64])
+	w.Close()
+	h, _, _ := encrypt.ReadHeader(bytes.NewReader(buf.Bytes()))
+	start := h.Size + encrypt.SectorStartSize(32, 16)
+	record := buf.Bytes()[start+5 : start+encrypt.SectorStartSize(16, 16)]
+	if _, err := encrypt.DecryptChunk(record, key, 2); !errors.Is(err, encrypt.ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed opening record 2 of a stream as a chunk; got %v", err)
+	}
+}
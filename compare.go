@@ -0,0 +1,36 @@
+package encrypt
+
+import (
+	"bytes"
+	"io"
+)
+
+// SamePlaintext reports whether a and b, which were both encrypted by a Writer using key,
+// hold the same plaintext.
+// The streams are decrypted together one chunk at a time,
+// so memory use is constant and the comparison stops at the first chunk that differs,
+// or as soon as one stream ends before the other.
+// Streams may differ in format, such as one having a header, and still hold the same plaintext.
+//
+// An error is returned if either stream fails to decrypt before a difference is found.
+func SamePlaintext(a, b io.Reader, key Key) (bool, error) {
+	ra, rb := NewReader(a, key), NewReader(b, key)
+	bufA, bufB := make([]byte, chunkSize), make([]byte, chunkSize)
+	for {
+		na, errA := io.ReadFull(ra, bufA)
+		nb, errB := io.ReadFull(rb, bufB)
+		if errA != nil && errA != io.EOF && errA != io.ErrUnexpectedEOF {
+			return false, errA
+		}
+		if errB != nil && errB != io.EOF && errB != io.ErrUnexpectedEOF {
+			return false, errB
+		}
+		if !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+		if errA != nil {
+			// the chunks are equal, so b ended at the same place as a
+			return true, nil
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestSamePlaintext(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	encryptBytes := func(plaintext []byte, md map[string]string) *bytes.Reader {
+		buf := &bytes.Buffer{}
+		w := encrypt.NewWriter(buf, key)
+		if md != nil {
+			w.SetMetadata(md)
+		}
+		w.Write(plaintext)
+		w.Close()
+		return bytes.NewReader(buf.Bytes())
+	}
+	data := make([]byte, encrypt.ChunkSize*2+10)
+	changed := append([]byte{}, data...)
+	changed[encrypt.ChunkSize+5] = 1
+
+	tests := []struct {
+		name string
+		a, b []byte
+		md   map[string]string
+		same bool
+	}{
+		{"identical", data, data, nil, true},
+		{"empty", nil, nil, nil, true},
+		{"different header", data, data, map[string]string{"name": "file.txt"}, true},
+		{"changed byte", data, changed, nil, false},
+		{"shorter", data, data[:len(data)-1], nil, false},
+		{"full chunk shorter", data, data[:encrypt.ChunkSize*2], nil, false},
+		{"longer", data[:encrypt.ChunkSize], data, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			same, err := encrypt.SamePlaintext(encryptBytes(tt.a, nil), encryptBytes(tt.b, tt.md), key)
+			if same != tt.same || err != nil {
+				t.Errorf("expected %v/nil; got %v/%v", tt.same, same, err)
+			}
+		})
+	}
+
+	tampered := encryptBytes(data, nil)
+	ciphertext := make([]byte, tampered.Len())
+	tampered.Read(ciphertext)
+	ciphertext[100] ^= 1
+	if _, err := encrypt.SamePlaintext(encryptBytes(data, nil), bytes.NewReader(ciphertext), key); !errors.Is(err, encrypt.ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed; got %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package encrypt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+// errReflected is returned by a Conn that reads back the stream it wrote.
+var errReflected = errors.New("encrypt: connection received its own stream")
+
+// Conn returns a net.Conn that encrypts data written to c and decrypts data read from c using key.
+// Both ends of the connection must be wrapped with the same key.
+//
+// Each direction is a separate stream with its own random stream ID,
+// and a connection refuses to read a stream with the ID of the one it writes,
+// so data can't be reflected back to its sender.
+// Within a connection, the data read is authenticated and arrives in order,
+// and a stream that ends without the end record written by Close is reported as truncated.
+// There is no handshake, however:
+// the key is the only proof of the peer's identity,
+// and nothing prevents a recorded direction of an earlier connection from being replayed to a new one.
+// Applications that need replay protection or forward secrecy should use TLS.
+//
+// Each call to Write is flushed to c as soon as it has been encrypted,
+// so the peer is able to read it without waiting for a full chunk.
+// Deadlines and addresses are those of c.
+// A Read that fails because its deadline passed may be retried after extending the deadline,
+// since the part of a record received before the deadline is kept and read again by the next call.
+// Close writes the end of the encrypted stream before closing c.
+func Conn(c net.Conn, key Key) net.Conn {
+	src := &replayReader{r: c}
+	conn := &conn{
+		Conn: c,
+		src:  src,
+		r:    NewReader(src, key),
+		// the stream needs a header in order to flush short chunks,
+		// which makes its chunks vary in size
+		w: &Writer{w: c, key: key, header: &header{variable: true}},
+	}
+	// the ID is chosen now, since the stream read may arrive before anything is written
+	id, err := newStreamID()
+	if err != nil {
+		conn.r.err, conn.w.err = err, err
+		conn.checked = true
+	}
+	conn.w.header.id = id
+	return conn
+}
+
+type conn struct {
+	net.Conn
+
+	rmu     sync.Mutex
+	src     *replayReader
+	r       *Reader
+	checked bool // checked is set once the header of the stream read has been checked
+
+	wmu sync.Mutex
+	w   *Writer
+}
+
+// Read reads and decrypts data from the connection.
+func (c *conn) Read(p []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	if !c.checked {
+		c.src.mark()
+		if err := c.r.detect(); err != nil {
+			if isTimeout(err) {
+				// the header is read again from its start by the next call
+				c.src.rewind()
+				c.r.detected, c.r.err = false, nil
+			}
+			return 0, err
+		}
+		c.checked = true
+		switch {
+		case c.r.header == nil:
+			c.r.err = errors.New("encrypt: connection received a stream without a header")
+		case bytes.Equal(c.r.header.id, c.w.header.id):
+			c.r.err = errReflected
+		}
+	}
+	if len(c.r.plaintext) == 0 {
+		// the next record is about to be read
+		c.src.mark()
+	}
+	n, err := c.r.Read(p)
+	if err != nil && isTimeout(err) {
+		// the record is read again from its start by the next call
+		c.src.rewind()
+	}
+	return n, err
+}
+
+// isTimeout reports whether err is caused by a deadline passing.
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// replayReader keeps the bytes read from a connection since the start of the current record,
+// so that a record interrupted by a deadline can be read again from its start.
+type replayReader struct {
+	r   io.Reader
+	buf []byte // buf holds the bytes read since the last call to mark
+	pos int    // pos is the number of bytes of buf read since the last call to mark or rewind
+}
+
+func (r *replayReader) Read(p []byte) (int, error) {
+	if r.pos < len(r.buf) {
+		n := copy(p, r.buf[r.pos:])
+		r.pos += n
+		return n, nil
+	}
+	n, err := r.r.Read(p)
+	r.buf = append(r.buf, p[:n]...)
+	r.pos += n
+	return n, err
+}
+
+// mark discards the bytes that have been read, which starts a new record.
+// Bytes kept by rewind remain to be read.
+func (r *replayReader) mark() {
+	r.buf = append(r.buf[:0], r.buf[r.pos:]...)
+	r.pos = 0
+}
+
+// rewind makes the bytes read since the last call to mark available to be read again.
+func (r *replayReader) rewind() {
+	r.pos = 0
+}
+
+// Write encrypts p and writes it to the connection.
+func (c *conn) Write(p []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	n, err := c.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, c.w.Flush()
+}
+
+// Close ends the encrypted stream and closes the connection.
+func (c *conn) Close() error {
+	c.wmu.Lock()
+	err := c.w.Close()
+	c.wmu.Unlock()
+	if cerr := c.Conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
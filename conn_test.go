@@ -0,0 +1,142 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestConn(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	a, b := net.Pipe()
+	client, server := encrypt.Conn(a, key), encrypt.Conn(b, key)
+
+	go func() {
+		// echo each message back to the client
+		buf := make([]byte, 1024)
+		for {
+			n, err := server.Read(buf)
+			if err != nil {
+				server.Close()
+				return
+			}
+			server.Write(buf[:n])
+		}
+	}()
+
+	for _, msg := range []string{"Hello, world!", "ping", "pong"} {
+		if _, err := client.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 1024)
+		n, err := client.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != msg {
+			t.Errorf("expected %q; got %q", msg, buf[:n])
+		}
+	}
+
+	if err := client.SetReadDeadline(time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Read(make([]byte, 1)); err == nil {
+		t.Errorf("expected the read deadline to pass through to the underlying connection")
+	}
+	client.Close()
+}
+
+func TestConn_wire(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	a, b := net.Pipe()
+	client := encrypt.Conn(a, key)
+	done := make(chan []byte)
+	go func() {
+		raw, _ := io.ReadAll(b)
+		done <- raw
+	}()
+	client.Write([]byte("secret message"))
+	client.Close()
+	raw := <-done
+	if bytes.Contains(raw, []byte("secret message")) {
+		t.Errorf("expected data on the wire to be encrypted")
+	}
+	plaintext, err := io.ReadAll(encrypt.NewReader(bytes.NewReader(raw), key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "secret message" {
+		t.Errorf("expected the wire format to be a valid stream; got %q", plaintext)
+	}
+}
+
+func TestConn_reflection(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	a, b := net.Pipe()
+	client := encrypt.Conn(a, key)
+	// an attacker in the middle sends everything the client writes back to it
+	go io.Copy(b, b)
+	defer a.Close()
+
+	if _, err := client.Write([]byte("Hello, world!")); err != nil {
+		t.Fatal(err)
+	}
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if n, err := client.Read(make([]byte, 1024)); err == nil {
+		t.Errorf("expected an error reading a reflected stream; got %d bytes", n)
+	}
+}
+
+func TestConn_readDeadline(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	stream := &bytes.Buffer{}
+	w := encrypt.NewWriter(stream, key)
+	w.SetChunkSize(16)
+	w.Write([]byte("hello"))
+	w.Flush()
+	w.Write([]byte("world"))
+	w.Flush()
+	h, _, err := encrypt.ReadHeader(bytes.NewReader(stream.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, b := net.Pipe()
+	conn := encrypt.Conn(a, key)
+	// closing the Conn would block on writing the end of its stream, which nothing reads
+	defer a.Close()
+	// the deadline passes once in the middle of the header and once in the middle of the first record
+	raw := stream.Bytes()
+	pieces := [][]byte{raw[:5], raw[5 : h.Size+10], raw[h.Size+10:]}
+	next := make(chan struct{})
+	go func() {
+		for _, piece := range pieces {
+			<-next
+			b.Write(piece)
+		}
+	}()
+
+	for i := 0; i < 2; i++ {
+		next <- struct{}{}
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		if _, err := conn.Read(make([]byte, 16)); !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("expected the read deadline to pass; got %v", err)
+		}
+	}
+	next <- struct{}{}
+	conn.SetReadDeadline(time.Time{})
+	got := make([]byte, 10)
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "helloworld" {
+		t.Errorf("expected %q after retrying; got %q", "helloworld", got)
+	}
+}
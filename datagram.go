@@ -0,0 +1,84 @@
+package encrypt
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// datagramAD prefixes the additional data of each datagram,
+// which keeps frames distinct from data sealed for any stream.
+var datagramAD = []byte("encrypt datagram")
+
+// datagramIndexSize is the size of the big-endian index at the start of each frame.
+const datagramIndexSize = 8
+
+// DatagramWriter encrypts each Write as a self-contained frame for a datagram transport such as UDP,
+// where packets may be lost or arrive out of order.
+// Unlike Writer, nothing is buffered and there is no end of stream:
+// each frame is decrypted independently by DecryptDatagram.
+type DatagramWriter struct {
+	sink  func(frame []byte) error
+	key   Key
+	aead  cipher.AEAD
+	index int64 // index is the position of the next frame
+}
+
+// NewDatagramWriter returns a DatagramWriter that passes each frame it produces to sink.
+// A frame takes the form index|nonce|ciphertext|tag, where index is a big-endian uint64
+// counting the frames from zero and is authenticated along with the data.
+// Detecting lost, duplicated, or reordered frames is left to the caller, using the index returned by DecryptDatagram.
+func NewDatagramWriter(sink func(frame []byte) error, key Key) *DatagramWriter {
+	return &DatagramWriter{
+		sink: sink,
+		key:  key,
+	}
+}
+
+// Write encrypts p as a single frame and passes it to the sink.
+// p may hold at most ChunkSize bytes.
+// The frame index advances even when the sink returns an error,
+// so an index is never used for two different frames.
+func (w *DatagramWriter) Write(p []byte) (int, error) {
+	if len(p) > chunkSize {
+		return 0, fmt.Errorf("encrypt.DatagramWriter.Write: %d bytes exceeds the maximum of %d", len(p), chunkSize)
+	}
+	if w.aead == nil {
+		aead, err := AEAD(w.key)
+		if err != nil {
+			return 0, err
+		}
+		w.aead = aead
+	}
+	frame := make([]byte, datagramIndexSize, datagramIndexSize+nonceSize+len(p)+tagSize)
+	binary.BigEndian.PutUint64(frame, uint64(w.index))
+	sealed, err := encrypt(w.aead, p, append(append([]byte{}, datagramAD...), frame...))
+	if err != nil {
+		return 0, err
+	}
+	w.index++
+	if err := w.sink(append(frame, sealed...)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// DecryptDatagram decrypts a frame produced by a DatagramWriter using key,
+// returning its index along with the plaintext.
+// If the frame was altered, including its index, ErrAuthFailed is returned.
+func DecryptDatagram(frame []byte, key Key) (index int64, plaintext []byte, err error) {
+	if len(frame) < datagramIndexSize {
+		return 0, nil, errors.New("encrypt.DecryptDatagram: malformed frame")
+	}
+	aead, err := AEAD(key)
+	if err != nil {
+		return 0, nil, err
+	}
+	ad := append(append([]byte{}, datagramAD...), frame[:datagramIndexSize]...)
+	plaintext, err = decrypt(aead, nil, frame[datagramIndexSize:], ad)
+	if err != nil {
+		return 0, nil, err
+	}
+	return int64(binary.BigEndian.Uint64(frame)), plaintext, nil
+}
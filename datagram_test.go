@@ -0,0 +1,57 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestDatagramWriter(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	var frames [][]byte
+	w := encrypt.NewDatagramWriter(func(frame []byte) error {
+		frames = append(frames, frame)
+		return nil
+	}, key)
+	messages := []string{"first", "second", "third"}
+	for _, msg := range messages {
+		if n, err := w.Write([]byte(msg)); n != len(msg) || err != nil {
+			t.Fatalf("expected %d/nil; got %d/%v", len(msg), n, err)
+		}
+	}
+	if len(frames) != len(messages) {
+		t.Fatalf("expected one frame per write; got %d", len(frames))
+	}
+
+	// frames are decrypted independently, in any order
+	for i := len(frames) - 1; i >= 0; i-- {
+		index, plaintext, err := encrypt.DecryptDatagram(frames[i], key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if index != int64(i) || string(plaintext) != messages[i] {
+			t.Errorf("expected frame %d to hold %q; got %d/%q", i, messages[i], index, plaintext)
+		}
+	}
+
+	// the index is authenticated
+	forged := append([]byte{}, frames[0]...)
+	binary.BigEndian.PutUint64(forged, 2)
+	if _, _, err := encrypt.DecryptDatagram(forged, key); !errors.Is(err, encrypt.ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed for a frame with a changed index; got %v", err)
+	}
+	if _, err := w.Write(make([]byte, encrypt.ChunkSize+1)); err == nil {
+		t.Errorf("expected an error for a write larger than a chunk")
+	}
+
+	w = encrypt.NewDatagramWriter(func([]byte) error { return errors.New("send failed") }, key)
+	if n, err := w.Write([]byte("lost")); n != 0 || err == nil {
+		t.Errorf("expected the sink error; got %d/%v", n, err)
+	}
+	if _, _, err := encrypt.DecryptDatagram(bytes.Repeat([]byte{1}, 4), key); err == nil {
+		t.Errorf("expected an error for a short frame")
+	}
+}
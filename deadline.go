@@ -0,0 +1,44 @@
+package encrypt
+
+import "time"
+
+// SetChunkDeadline makes w set a write deadline of d from now before writing each chunk,
+// when the underlying writer has a SetWriteDeadline method, such as a net.Conn.
+// This keeps a stalled connection from blocking a Write forever:
+// the write fails with the error from the underlying writer, usually os.ErrDeadlineExceeded,
+// and like any other write error it makes the Writer unusable.
+// For writers without a SetWriteDeadline method it has no effect,
+// and a d of zero stops setting deadlines.
+func (w *Writer) SetChunkDeadline(d time.Duration) {
+	w.deadline = d
+}
+
+// SetChunkDeadline makes r set a read deadline of d from now before reading each chunk,
+// when the underlying reader has a SetReadDeadline method, such as a net.Conn.
+// For readers without a SetReadDeadline method it has no effect,
+// and a d of zero stops setting deadlines.
+func (r *Reader) SetChunkDeadline(d time.Duration) {
+	r.deadline = d
+}
+
+// setDeadline sets the write deadline for the next chunk, if one was configured.
+func (w *Writer) setDeadline() error {
+	if w.deadline <= 0 {
+		return nil
+	}
+	if c, ok := w.w.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		return c.SetWriteDeadline(time.Now().Add(w.deadline))
+	}
+	return nil
+}
+
+// setDeadline sets the read deadline for the next chunk, if one was configured.
+func (r *Reader) setDeadline() error {
+	if r.deadline <= 0 {
+		return nil
+	}
+	if c, ok := r.r.(interface{ SetReadDeadline(time.Time) error }); ok {
+		return c.SetReadDeadline(time.Now().Add(r.deadline))
+	}
+	return nil
+}
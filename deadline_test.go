@@ -0,0 +1,40 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestSetChunkDeadline(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	// nothing reads from the other end of the pipe, so the write stalls until the deadline
+	w := encrypt.NewWriter(a, key)
+	w.SetChunkDeadline(20 * time.Millisecond)
+	if err := w.WriteAndClose([]byte("Hello, world!")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("expected the write to time out; got %v", err)
+	}
+
+	r := encrypt.NewReader(b, key)
+	r.SetChunkDeadline(20 * time.Millisecond)
+	if _, err := r.Read(make([]byte, 10)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("expected the read to time out; got %v", err)
+	}
+
+	// writers without deadlines are unaffected
+	buf := &bytes.Buffer{}
+	w = encrypt.NewWriter(buf, key)
+	w.SetChunkDeadline(time.Nanosecond)
+	if err := w.WriteAndClose([]byte("Hello, world!")); err != nil {
+		t.Error(err)
+	}
+}
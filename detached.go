@@ -0,0 +1,74 @@
+package encrypt
+
+import (
+	"fmt"
+	"io"
+)
+
+// NewDetachedWriter returns a new Writer that encrypts data with key,
+// writing each chunk to w as nonce|ciphertext
+// and its authentication tag to tags.
+// This keeps the ciphertext contiguous so that tags can be stored and verified separately,
+// for example in a sidecar index.
+//
+// The output is not compatible with NewReader;
+// use NewDetachedReader with both streams to decrypt it.
+// Callers must call Close to write the final chunk of data.
+func NewDetachedWriter(w io.Writer, tags io.Writer, key Key) *Writer {
+	return &Writer{
+		w:    w,
+		tags: tags,
+		key:  key,
+	}
+}
+
+// NewDetachedReader returns a new Reader for decrypting r,
+// where r and tags were written by a Writer from NewDetachedWriter using key.
+//
+// Seek requires both r and tags to implement io.Seeker.
+func NewDetachedReader(r io.Reader, tags io.Reader, key Key) *Reader {
+	return &Reader{
+		r:        r,
+		tags:     tags,
+		key:      key,
+		detected: true, // detached streams never have a header
+		src:      r,
+	}
+}
+
+// writeDetached writes the nonce and ciphertext of sealed to the underlying writer and its tag to w.tags.
+func (w *Writer) writeDetached(sealed []byte) error {
+	if err := w.write(sealed[:len(sealed)-tagSize]); err != nil {
+		return err
+	}
+	written, err := w.tags.Write(sealed[len(sealed)-tagSize:])
+	if err != nil {
+		return err
+	}
+	if written != tagSize {
+		return fmt.Errorf("encrypt: wrote %d of %d tag bytes: %w", written, tagSize, io.ErrShortWrite)
+	}
+	return nil
+}
+
+// readTag reads the next tag from r.tags and appends it to sector.
+func (r *Reader) readTag(sector []byte) ([]byte, error) {
+	tag := sector[len(sector) : len(sector)+tagSize]
+	if _, err := io.ReadFull(r.tags, tag); err != nil {
+		return nil, fmt.Errorf("encrypt: reading tag: %w", truncated(err))
+	}
+	return sector[:len(sector)+tagSize], nil
+}
+
+// seekTag positions r.tags at the tag for the chunk at index.
+func (r *Reader) seekTag(index int64) error {
+	offset := index * tagSize
+	n, err := r.tags.(io.Seeker).Seek(offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	if n != offset {
+		return fmt.Errorf("expected tag seek position to be %v; got %v", offset, n)
+	}
+	return nil
+}
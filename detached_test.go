@@ -0,0 +1,61 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestDetached(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	ciphertext, tags := &bytes.Buffer{}, &bytes.Buffer{}
+	w := encrypt.NewDetachedWriter(ciphertext, tags, key)
+	if _, err := w.Write(plaintext); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if tags.Len() != 3*16 {
+		t.Errorf("expected one 16-byte tag per chunk; got %d bytes", tags.Len())
+	}
+	if ciphertext.Len() != len(plaintext)+3*12 {
+		t.Errorf("expected ciphertext to contain only nonces and data; got %d bytes", ciphertext.Len())
+	}
+
+	r := encrypt.NewDetachedReader(bytes.NewReader(ciphertext.Bytes()), bytes.NewReader(tags.Bytes()), key)
+	decrypted, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("plaintext does not match")
+	}
+
+	r = encrypt.NewDetachedReader(bytes.NewReader(ciphertext.Bytes()), bytes.NewReader(tags.Bytes()), key)
+	if n, err := r.Seek(-10, io.SeekEnd); err != nil || n != int64(len(plaintext)-10) {
+		t.Fatalf("expected %d/nil; got %d/%v", len(plaintext)-10, n, err)
+	}
+	decrypted, err = io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext[len(plaintext)-10:]) {
+		t.Errorf("plaintext after seek does not match")
+	}
+
+	badTags := append([]byte{}, tags.Bytes()...)
+	badTags[20] ^= 0xff
+	r = encrypt.NewDetachedReader(bytes.NewReader(ciphertext.Bytes()), bytes.NewReader(badTags), key)
+	if _, err := io.ReadAll(r); err == nil {
+		t.Errorf("expected an error for a modified tag")
+	}
+
+	r = encrypt.NewDetachedReader(bytes.NewReader(ciphertext.Bytes()), bytes.NewReader(tags.Bytes()[:32]), key)
+	if _, err := io.ReadAll(r); err == nil {
+		t.Errorf("expected an error for a missing tag")
+	}
+}
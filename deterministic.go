@@ -0,0 +1,48 @@
+package encrypt
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+)
+
+// NewDeterministicWriter returns a new Writer that encrypts data with key before writing to w,
+// deriving the nonce of each chunk from the chunk itself instead of choosing it randomly.
+// Identical plaintext then produces identical ciphertext, which allows encrypted data to be deduplicated
+// or stored by the hash of its ciphertext.
+//
+// WARNING: deterministic encryption reveals which chunks and streams are equal,
+// and an attacker who can guess the plaintext can confirm the guess by encrypting it.
+// Only use it for high-entropy data such as content-addressed blobs, never for low-entropy values
+// like passwords, numbers, or short messages, and prefer NewWriter in every other case.
+//
+// The output can be decrypted by NewReader.
+// The header of a stream, such as one added by SetMetadata, is still encrypted with random nonces,
+// so only headerless streams are fully deterministic.
+// Callers must call Close to write the final chunk of data.
+func NewDeterministicWriter(w io.Writer, key Key) *Writer {
+	nonceKey := key.Derive([]byte("encrypt deterministic nonce"))
+	return &Writer{
+		w:        w,
+		key:      key,
+		nonceKey: nonceKey[:],
+	}
+}
+
+// sealDeterministic encrypts plaintext with a nonce computed as HMAC-SHA256 of the additional data and plaintext,
+// appending the output to dst.
+// Including the additional data ensures that the same nonce is never used to seal two different messages.
+func sealDeterministic(aead cipher.AEAD, nonceKey, dst, plaintext, additionalData []byte) []byte {
+	mac := hmac.New(sha256.New, nonceKey)
+	var length [8]byte
+	binary.BigEndian.PutUint64(length[:], uint64(len(additionalData)))
+	mac.Write(length[:])
+	mac.Write(additionalData)
+	mac.Write(plaintext)
+	dst = grow(dst, aead.NonceSize()+len(plaintext)+aead.Overhead())
+	dst = append(dst, mac.Sum(nil)[:aead.NonceSize()]...)
+	nonce := dst[len(dst)-aead.NonceSize():]
+	return aead.Seal(dst, nonce, plaintext, additionalData)
+}
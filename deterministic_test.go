@@ -0,0 +1,45 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestNewDeterministicWriter(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	seal := func(plaintext []byte) []byte {
+		buf := &bytes.Buffer{}
+		w := encrypt.NewDeterministicWriter(buf, key)
+		w.Write(plaintext)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	a, b := seal(plaintext), seal(plaintext)
+	if !bytes.Equal(a, b) {
+		t.Errorf("expected identical plaintext to produce identical ciphertext")
+	}
+	modified := append([]byte{}, plaintext...)
+	modified[len(modified)-1] ^= 1
+	c := seal(modified)
+	if bytes.Equal(a[len(a)-100:], c[len(c)-100:]) {
+		t.Errorf("expected different plaintext to produce different ciphertext")
+	}
+	if !bytes.Equal(a[:encrypt.SectorSize], c[:encrypt.SectorSize]) {
+		t.Errorf("expected identical chunks to produce identical sectors")
+	}
+
+	decrypted, err := io.ReadAll(encrypt.NewReader(bytes.NewReader(a), key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("plaintext does not match")
+	}
+}
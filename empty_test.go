@@ -0,0 +1,107 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestEncryptAll_empty(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	ciphertext, err := encrypt.EncryptAll(nil, key)
+	if err != nil || len(ciphertext) != 0 {
+		t.Fatalf("expected an empty headerless stream; got %d bytes/%v", len(ciphertext), err)
+	}
+	plaintext, err := encrypt.DecryptAll(bytes.NewReader(ciphertext), key)
+	if err != nil || len(plaintext) != 0 {
+		t.Errorf("expected 0/nil; got %d/%v", len(plaintext), err)
+	}
+}
+
+// TestWriter_empty checks that every kind of stream with a header round-trips empty input,
+// and that the result can't be mistaken for a truncated stream.
+func TestWriter_empty(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	writers := map[string]func(w io.Writer) *encrypt.Writer{
+		"metadata": func(w io.Writer) *encrypt.Writer {
+			ew := encrypt.NewWriter(w, key)
+			ew.SetMetadata(map[string]string{"name": "empty.txt"})
+			return ew
+		},
+		"chunk size": func(w io.Writer) *encrypt.Writer {
+			ew := encrypt.NewWriter(w, key)
+			ew.SetChunkSize(1024)
+			return ew
+		},
+		"toc": func(w io.Writer) *encrypt.Writer {
+			ew := encrypt.NewWriter(w, key)
+			ew.EnableTOC()
+			return ew
+		},
+		"trailer": func(w io.Writer) *encrypt.Writer {
+			ew := encrypt.NewWriter(w, key)
+			ew.EnableTrailer()
+			return ew
+		},
+		"chain": func(w io.Writer) *encrypt.Writer {
+			ew := encrypt.NewWriter(w, key)
+			ew.EnableChain()
+			return ew
+		},
+		"uniform":    func(w io.Writer) *encrypt.Writer { return encrypt.NewUniformWriter(w, key) },
+		"padded":     func(w io.Writer) *encrypt.Writer { return encrypt.NewPaddedWriter(w, key, 4096) },
+		"gcm-siv":    func(w io.Writer) *encrypt.Writer { return encrypt.NewWriterGCMSIV(w, key) },
+		"nonce size": func(w io.Writer) *encrypt.Writer { return encrypt.NewWriterNonceSize(w, key, 16) },
+	}
+	for name, newWriter := range writers {
+		t.Run(name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			w := newWriter(buf)
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			ciphertext := buf.Bytes()
+			if len(ciphertext) == 0 {
+				t.Fatal("expected a header and end record for empty input")
+			}
+			plaintext, err := encrypt.DecryptAll(bytes.NewReader(ciphertext), key)
+			if err != nil || len(plaintext) != 0 {
+				t.Errorf("expected 0/nil; got %d/%v", len(plaintext), err)
+			}
+			r := encrypt.NewReader(bytes.NewReader(ciphertext), key)
+			if size, ok := r.DeclaredSize(); ok {
+				t.Errorf("expected no declared size before reading; got %d", size)
+			}
+			if n, err := r.Read(make([]byte, 10)); n != 0 || err != io.EOF {
+				t.Errorf("expected 0/EOF; got %d/%v", n, err)
+			}
+			if size, ok := r.DeclaredSize(); size != 0 || !ok {
+				t.Errorf("expected a declared size of 0; got %d/%v", size, ok)
+			}
+
+			if name != "padded" {
+				// padded streams don't reveal their length
+				r := encrypt.NewReader(bytes.NewReader(ciphertext), key)
+				if n, err := r.Seek(0, io.SeekEnd); n != 0 || err != nil {
+					t.Errorf("expected the end of an empty stream at 0; got %d/%v", n, err)
+				}
+			}
+
+			hdr, _, err := encrypt.ReadHeader(bytes.NewReader(ciphertext))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// anything after the header that is cut short is reported as truncated
+			truncated := ciphertext[:hdr.Size+1]
+			if _, err := io.ReadAll(encrypt.NewReader(bytes.NewReader(truncated), key)); !errors.Is(err, encrypt.ErrTruncated) {
+				t.Errorf("expected ErrTruncated; got %v", err)
+			}
+			if _, err := io.ReadAll(encrypt.NewReader(bytes.NewReader(ciphertext[:hdr.Size]), key)); !errors.Is(err, encrypt.ErrTruncated) {
+				t.Errorf("expected ErrTruncated for a header alone; got %v", err)
+			}
+		})
+	}
+}
@@ -28,20 +28,34 @@ it is not a general-purpose solution for encryption.
 One particular weakness of this approach is that although each individual chunk cannot be read or modified without the key,
 it does not prevent an attacker that has gained access to the encrypted files from re-ordering or removing chunks.
 If this is a concern, use a hashing function to verify file contents or find an encryption scheme that provides such protection.
+Streams that begin with a header, such as those written after a call to Writer.SetMetadata,
+authenticate the position of each chunk and the length of the stream, which prevents this.
+Their header is authenticated as well: the metadata is bound to a random stream ID,
+and every chunk is bound to a hash of the whole header,
+so the header can't be modified or swapped for that of another stream, and chunks can't be moved between streams.
 
 Additionally, the amount of data that a single key can safely be used to encrypt may be limited.
 */
 package encrypt
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"os"
+	"strings"
+	"time"
 )
 
 // these values result in sectors of just under 64*1024 bytes,
@@ -51,15 +65,72 @@ const (
 	blocks       = 4094
 	aesBlockSize = 16
 	chunkSize    = aesBlockSize * blocks
+	maxChunkSize = 16 << 20
 	nonceSize    = 12
 	tagSize      = 16
 )
 
+// Sizes of the headerless format written by NewWriter.
+// Sector n of the ciphertext begins at byte n*SectorSize and holds plaintext bytes n*ChunkSize through (n+1)*ChunkSize-1,
+// which allows range requests to be aligned to sector boundaries.
+// Only the final sector may be shorter.
+const (
+	ChunkSize  = chunkSize                       // ChunkSize is the plaintext size of each full chunk.
+	SectorSize = nonceSize + chunkSize + tagSize // SectorSize is the ciphertext size of each full sector.
+	Overhead   = nonceSize + tagSize             // Overhead is the size of the nonce and tag added to the plaintext of each sector, so SectorSize is ChunkSize+Overhead.
+)
+
 // ErrInvalidKeyLength is returned by DecodeBase64Key when a key of the wrong size is decoded.
+// A KeySizeError from a cipher also matches it with errors.Is.
 var ErrInvalidKeyLength = errors.New("expected 32-byte key")
 
+// KeySizeError is returned when a cipher doesn't support a key of the given number of bytes,
+// such as a key passed to NewGCMSIV or produced by the newAEAD function of NewWriterAEAD.
+// Constructors that validate their arguments, such as NewWriterE, report it before anything is encrypted,
+// and a Writer or Reader that encounters it returns it from every call rather than failing each chunk differently.
+type KeySizeError int
+
+func (k KeySizeError) Error() string {
+	return fmt.Sprintf("encrypt: unsupported key size %d", int(k))
+}
+
+// Is reports whether target is ErrInvalidKeyLength, so that both kinds of key size errors can be checked together.
+func (k KeySizeError) Is(target error) bool {
+	return target == ErrInvalidKeyLength
+}
+
+// keySizeError converts a key size error from crypto/aes into a KeySizeError,
+// and returns any other error unchanged.
+func keySizeError(err error) error {
+	var kse aes.KeySizeError
+	if errors.As(err, &kse) {
+		return KeySizeError(kse)
+	}
+	return err
+}
+
+// ErrAEADUnavailable is returned when AES-GCM can't be created in the current environment,
+// such as a build restricted to FIPS 140 approved modes that rejects a nonce size.
+// NewWriterE and NewReaderE report it before anything is encrypted,
+// and a Writer or Reader that encounters it returns it instead of encrypting or decrypting anything.
+var ErrAEADUnavailable = errors.New("encrypt: AEAD is unavailable in this environment")
+
+// newGCMWithNonceSize creates AES-GCM from a block cipher.
+// It is a variable so that tests can simulate an environment where AES-GCM is unavailable.
+var newGCMWithNonceSize = cipher.NewGCMWithNonceSize
+
+// aeadError converts an error from creating AES-GCM into one that wraps ErrAEADUnavailable.
+func aeadError(err error) error {
+	return fmt.Errorf("%w: %v", ErrAEADUnavailable, err)
+}
+
+// ErrZeroKey is returned by a Writer or NewReaderE when the key is all zeroes,
+// which almost always means that the key was never loaded.
+var ErrZeroKey = errors.New("encrypt: key is all zeroes")
+
 // NewWriter returns a new Writer that encrypts data with key before writing to w.
 // Callers must call Close to write the final chunk of data.
+// If key is all zeroes, nothing is encrypted and Write and Close return ErrZeroKey.
 func NewWriter(w io.Writer, key Key) *Writer {
 	return &Writer{
 		w:   w,
@@ -67,34 +138,133 @@ func NewWriter(w io.Writer, key Key) *Writer {
 	}
 }
 
+// NewWriterE is like NewWriter, but validates its arguments up front
+// so that misconfiguration is reported where the Writer is created instead of by the first Write.
+// It returns an error wrapping ErrZeroKey if key is all zeroes,
+// a KeySizeError if the cipher doesn't support key,
+// or an error wrapping ErrAEADUnavailable if the cipher can't be created in the current environment.
+func NewWriterE(w io.Writer, key Key) (*Writer, error) {
+	if w == nil {
+		return nil, errors.New("encrypt.NewWriterE: nil writer")
+	}
+	if key.IsZero() {
+		return nil, fmt.Errorf("encrypt.NewWriterE: %w", ErrZeroKey)
+	}
+	if _, err := newGCM(key, nonceSize); err != nil {
+		return nil, fmt.Errorf("encrypt.NewWriterE: %w", err)
+	}
+	return NewWriter(w, key), nil
+}
+
 // Writer is an io.Writer for encrypting data.
+//
+// Errors from the underlying writer are returned immediately by the Write, Flush, or Close call that caused them,
+// and every later call returns the same error.
+// When streaming to a consumer through io.Pipe, such as an HTTP request body,
+// the consumer should close its end with CloseWithError if it stops reading early;
+// the pending Write then fails with that error instead of blocking forever.
+// The producer in turn should pass the result of Close to PipeWriter.CloseWithError,
+// so the consumer sees either io.EOF after the final chunk or the error that stopped the stream:
+//
+//	pr, pw := io.Pipe()
+//	go func() {
+//		w := encrypt.NewWriter(pw, key)
+//		_, err := io.Copy(w, src)
+//		if cerr := w.Close(); err == nil {
+//			err = cerr
+//		}
+//		pw.CloseWithError(err)
+//	}()
+//	req, err := http.NewRequest(http.MethodPut, url, pr)
 type Writer struct {
 	w   io.Writer
 	key Key
 
-	pos   int // pos is the cursor position in the pending chunk
-	chunk [chunkSize]byte
+	pos     int // pos is the cursor position in the pending chunk
+	chunk   []byte
+	scratch []byte // scratch holds the output of the previous sealed chunk, and is reused for the next
+	sealed  int64  // sealed is the number of chunks sealed with the key, including those of an earlier Writer for a resumed stream
+
+	header  *header // header is non-nil for streams that begin with a header
+	encoded []byte  // encoded is the header, once it has been encoded for the first record
+	started bool    // started is set once anything has been written to w
+	index   int64   // index is the number of chunks of data written, which is the index of the next one
+	size    int64   // size is the number of plaintext bytes written after a header
+
+	tags   io.Writer   // tags receives the authentication tags when they are detached from the stream
+	aead   cipher.AEAD // aead is created on first use unless it was provided by NewWriterAEAD
+	custom bool        // custom is set when aead was provided by NewWriterAEAD, which the header records
+
+	bucket  int64 // bucket is the multiple that the stream is padded to, if positive
+	written int64 // written is the number of bytes written to w
+
+	toc   []ChunkEntry // toc lists the data records written, when the stream has a table of contents
+	chain []byte       // chain is the hash of the previous record, when records are chained
+
+	trailer hash.Hash // trailer computes the HMAC of everything written to w, when it was enabled by EnableTrailer
+
+	aad func(chunkIndex int64) []byte // aad returns the additional data of each chunk, when set by NewWriterAAD
+
+	nonceKey []byte // nonceKey derives each nonce from the chunk for a deterministic Writer
+
+	verify bool // verify is set when each sealed chunk is opened again and compared with its plaintext
+
+	deadline time.Duration // deadline is the time allowed for writing each chunk, when set by SetChunkDeadline
+	limiter  *rateLimiter  // limiter throttles the chunks written, when set by SetRateLimit
+
+	onChunk func(ctStart, ctEnd int64) // onChunk is called with the position of each chunk written, when set by OnChunk
+
+	resumed    bool  // resumed is set when the stream continues the output of an earlier Writer
+	resumeFrom int64 // resumeFrom is the number of chunks written by the earlier Writer
 
 	closed bool
+	err    error // err is the first error returned by the underlying writer, which makes the stream unusable
 }
 
 // Write writes p to an internal buffer to ensure that encrypted chunks have uniform size.
 // The buffer is encrypted and flushed as needed.
 //
 // Callers must call w.Close to flush the final chunk from the buffer.
+//
+// If writing to the underlying writer fails, n counts only the bytes of p
+// whose chunks were written before the failure.
+// The failed chunk is discarded, including any part of it that was buffered by earlier calls,
+// and the error is returned by all further calls to Write and Close.
 func (w *Writer) Write(p []byte) (n int, err error) {
 
 	if w.closed {
 		return 0, errors.New("call to write on closed writer")
 	}
+	if w.err != nil {
+		return 0, w.err
+	}
 
+	if w.chunk == nil {
+		w.chunk = make([]byte, chunkSize)
+	}
 	for len(p) > 0 {
+		if w.pos == 0 && len(p) >= len(w.chunk) {
+			// a full chunk can be encrypted directly from p
+			// without copying it into the buffer first
+			nn := len(w.chunk)
+			if err = w.writeChunk(p[:nn]); err != nil {
+				w.err = err
+				return n, err
+			}
+			p = p[nn:]
+			n += nn
+			continue
+		}
 		nn := copy(w.chunk[w.pos:], p)
 		w.pos += nn
 		p = p[nn:]
 		// if no bytes were nn that means the chunk is full
 		if w.pos == len(w.chunk) {
 			if err = w.flush(); err != nil {
+				// a chunk that failed to write would leave a gap in the stream,
+				// so any further writes would produce corrupt output.
+				// The bytes copied into it were not written, so they aren't counted in n.
+				w.err = err
 				return n, err
 			}
 		}
@@ -104,12 +274,101 @@ func (w *Writer) Write(p []byte) (n int, err error) {
 	return n, err
 }
 
+// WriteAndClose writes p and closes w, for the common case of encrypting a value that is already in memory.
+// Forgetting to call Close leaves the final chunk in the buffer,
+// which produces a stream that decrypts without error but is missing the end of its data;
+// combining the two calls makes that mistake impossible.
+// The error from Write is returned if there was one, otherwise the error from Close.
+func (w *Writer) WriteAndClose(p []byte) error {
+	_, err := w.Write(p)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
 // Close flushes any remaining data from the buffer to the underlying writer and prevents additional calls to Write.
+// If a previous write to the underlying writer failed, Close returns that error instead.
+//
+// Headerless streams can't detect a missing final chunk,
+// so callers that write all of their data at once should prefer WriteAndClose,
+// and streams that may be left unclosed by mistake should have a header, such as from SetMetadata,
+// which makes a Reader report the missing data as ErrTruncated.
 func (w *Writer) Close() error {
+	if w.closed || w.err != nil {
+		return w.err
+	}
 	// The final chunk is likely to be smaller than the chunk size,
 	// so more writes would result in decoding errors.
 	w.closed = true
-	return w.flush()
+	if w.err = w.flush(); w.err != nil {
+		return w.err
+	}
+	if w.header != nil {
+		size := make([]byte, 8)
+		binary.BigEndian.PutUint64(size, uint64(w.resumedSize()+w.size))
+		w.err = w.writeRecord(recordEnd, size)
+	}
+	if w.err == nil && w.header != nil && w.header.toc {
+		w.err = w.writeTOC()
+	}
+	if w.err == nil && w.trailer != nil {
+		w.err = w.write(w.trailer.Sum(nil))
+	}
+	if w.err == nil && w.bucket > 0 {
+		w.err = w.pad()
+	}
+	return w.err
+}
+
+// OnChunk sets f to be called after each chunk of data is written to the underlying writer,
+// with the range of bytes that the chunk occupies in the output, from ctStart up to but not including ctEnd.
+// Together with NewResumeWriter, this allows an upload that accepts byte ranges
+// to retry exactly the ranges that failed.
+//
+// Positions count the bytes written by w, so the first chunk of a stream with a header starts after the header,
+// and the positions of a resumed stream start at zero rather than at the end of the output it continues.
+// The header, end record, and table of contents are not chunks of data and aren't reported.
+// A nil f removes the callback.
+func (w *Writer) OnChunk(f func(ctStart, ctEnd int64)) {
+	w.onChunk = f
+}
+
+// BytesWritten returns the number of bytes written to the underlying writer so far,
+// including the header and the overhead of each chunk, which makes it larger than the plaintext written.
+// Data buffered by Write isn't counted until its chunk is flushed, so the total is final after Close.
+// Tags written to a separate writer by NewDetachedWriter are not included.
+func (w *Writer) BytesWritten() int64 {
+	return w.written
+}
+
+// Flush encrypts any buffered data and writes it to the underlying writer as a short chunk,
+// so that it can be decrypted by a Reader without waiting for the rest of the chunk to fill.
+//
+// Flush is only supported for streams with a header, such as those written after a call to SetMetadata,
+// because headerless streams require every chunk except the last to be full.
+// Streams that contain short chunks before the end only support Reader.Seek with a table of contents from EnableTOC.
+// When Flush writes the first chunk of a stream, it marks the header as having chunks of varying size,
+// so that Reader.Seek refuses to calculate positions from the chunk size;
+// a later short chunk is instead detected by Reader.Seek from the size of the records it finds.
+func (w *Writer) Flush() error {
+	if w.closed {
+		return errors.New("call to flush on closed writer")
+	}
+	if w.err != nil {
+		return w.err
+	}
+	if w.header == nil {
+		return errors.New("encrypt.Writer.Flush: not supported for headerless streams")
+	}
+	if w.header.uniform && w.pos > 0 {
+		return errors.New("encrypt.Writer.Flush: not supported for uniform streams")
+	}
+	if !w.started && w.pos > 0 && w.pos < len(w.chunk) {
+		w.header.variable = true
+	}
+	w.err = w.flush()
+	return w.err
 }
 
 // flush encrypts the current buffer and writes to the underlying writer.
@@ -118,51 +377,251 @@ func (w *Writer) flush() error {
 		return nil
 	}
 	defer func() { w.pos = 0 }()
+	return w.writeChunk(w.chunk[:w.pos])
+}
 
-	ciphertext, err := encrypt(w.chunk[:w.pos], w.key)
+// writeChunk encrypts a chunk of plaintext and writes it to the underlying writer.
+func (w *Writer) writeChunk(plaintext []byte) error {
+	if w.limiter != nil {
+		start := w.written
+		defer func() { w.limiter.wait(len(plaintext), int(w.written-start)) }()
+	}
+	if w.header != nil {
+		return w.writeRecord(recordData, plaintext)
+	}
+	aead, err := w.cipher()
 	if err != nil {
 		return err
 	}
-	written, err := w.w.Write(ciphertext)
+	ciphertext, err := w.seal(aead, w.scratch[:0], plaintext, w.chunkAD(nil))
+	if err != nil {
+		return err
+	}
+	w.scratch = ciphertext
+	start := w.written
+	if w.tags != nil {
+		err = w.writeDetached(ciphertext)
+	} else {
+		err = w.write(ciphertext)
+	}
 	if err != nil {
 		return err
 	}
-	if written != len(ciphertext) {
-		// is this redundant?
-		return errors.New("write size mismatch")
+	w.index++
+	if w.onChunk != nil {
+		w.onChunk(start, w.written)
 	}
 	return nil
 }
 
-// encrypt encrypts data using 256-bit AES-GCM.  This both hides the content of
-// the data and provides a check that it hasn't been altered. Output takes the
-// form nonce|ciphertext|tag where '|' indicates concatenation.
-func encrypt(plaintext []byte, key Key) (ciphertext []byte, err error) {
-	block, err := aes.NewCipher(key[:])
+// writeRecord encrypts plaintext as a record of the given kind and writes it to the underlying writer.
+func (w *Writer) writeRecord(kind byte, plaintext []byte) error {
+	aead, err := w.cipher()
 	if err != nil {
-		// I think this error path is technically unreachable,
-		// since it looks like aes.NewCipher only returns an error for invalid key lengths,
-		// which shouldn't be possible since our keys are guaranteed to be 32 bytes.
-		return nil, err
+		return err
+	}
+	// records authenticate the hash of the header, so it is encoded before the first one is sealed
+	if err := w.encodeHeader(); err != nil {
+		return err
+	}
+	if kind == recordData && w.header.uniform && len(plaintext) < len(w.chunk) {
+		kind = recordPadded
+	}
+	ad := recordAD(kind, w.index, w.header.binding)
+	if w.header.chained && kind != recordTOC {
+		ad = append(ad, w.chain...)
+	}
+	if kind == recordData || kind == recordPadded {
+		ad = w.chunkAD(ad)
+	}
+	// the record is sealed directly after its prefix
+	record, err := w.seal(aead, append(w.scratch[:0], kind, 0, 0, 0, 0), w.padChunk(kind, plaintext), ad)
+	if err != nil {
+		return err
 	}
+	w.scratch = record
+	sealed := record[recordHeaderSize:]
+	binary.BigEndian.PutUint32(record[1:], uint32(len(sealed)))
+	if w.header.chained {
+		w.chain = chainHash(sealed)
+	}
+	if w.header.checksums {
+		record = appendChecksum(record)
+		w.scratch = record
+	}
+	if err = w.write(record); err != nil {
+		return err
+	}
+	if kind == recordData && w.header.toc {
+		w.toc = append(w.toc, ChunkEntry{
+			Offset:          w.written - int64(len(record)),
+			PlaintextOffset: w.size,
+			PlaintextLength: len(plaintext),
+		})
+	}
+	if kind == recordData || kind == recordPadded {
+		w.index++
+		w.size += int64(len(plaintext))
+		if w.onChunk != nil {
+			w.onChunk(w.written-int64(len(record)), w.written)
+		}
+	}
+	return nil
+}
 
-	gcm, err := cipher.NewGCM(block)
+// encodeHeader encodes the header of the stream, if it has one that hasn't been encoded yet,
+// which fixes the binding authenticated by its records.
+func (w *Writer) encodeHeader() error {
+	if w.header == nil || w.encoded != nil || w.started {
+		return nil
+	}
+	if w.resumed {
+		if w.header.binding == nil {
+			return errors.New("encrypt: a resumed stream with a header requires SetResumeHeader")
+		}
+		return nil
+	}
+	aead, err := w.cipher()
 	if err != nil {
-		// This error path also looks unreachable as long as the stdlib doesn't suddenly break aes block size constants.
-		return nil, err
+		return err
 	}
+	if w.custom {
+		w.header.cipher = cipherCustom
+	}
+	w.encoded, err = w.header.marshal(w.key, aead)
+	return err
+}
 
-	nonce := make([]byte, gcm.NonceSize())
-	_, err = rand.Read(nonce)
+// write writes b to the underlying writer,
+// preceded by the header if the stream has one that has not been written yet.
+func (w *Writer) write(b []byte) error {
+	if w.header != nil && !w.started && !w.resumed {
+		if err := w.encodeHeader(); err != nil {
+			return err
+		}
+		b = append(w.encoded[:len(w.encoded):len(w.encoded)], b...)
+	}
+	if err := w.setDeadline(); err != nil {
+		return err
+	}
+	w.started = true
+	written, err := w.w.Write(b)
+	w.written += int64(written)
+	if w.trailer != nil {
+		w.trailer.Write(b[:written])
+	}
 	if err != nil {
+		return err
+	}
+	if written != len(b) {
+		// io.Writer requires a non-nil error for short writes,
+		// but a misbehaving writer would otherwise leave a silent gap in the stream.
+		return fmt.Errorf("encrypt: wrote %d of %d bytes: %w", written, len(b), io.ErrShortWrite)
+	}
+	return nil
+}
+
+// Limits on the number of chunks that a Writer seals with one key before returning ErrNonceLimitReached.
+const (
+	// randomNonceLimit follows NIST SP 800-38D for AES-GCM with random 96-bit nonces,
+	// which keeps the probability of a repeated nonce below 2^-32.
+	randomNonceLimit = 1 << 32
+
+	// sivNonceLimit is the much higher bound of RFC 8452 for AES-GCM-SIV with random nonces,
+	// since a repeated nonce only reveals whether two chunks are identical.
+	sivNonceLimit = 1 << 48
+)
+
+// nonceLimit returns the number of chunks that may be sealed with aead before the risk of a repeated nonce is too high.
+func nonceLimit(aead cipher.AEAD) int64 {
+	if _, ok := aead.(*gcmSIV); ok {
+		return sivNonceLimit
+	}
+	if aead.NonceSize() >= 24 {
+		// extended nonces, such as those of XChaCha20-Poly1305 from NewWriterAEAD, are large enough to choose at random indefinitely
+		return 1<<63 - 1
+	}
+	return randomNonceLimit
+}
+
+// cipher returns the AEAD used to encrypt the stream, creating it on first use.
+func (w *Writer) cipher() (cipher.AEAD, error) {
+	if w.aead == nil {
+		if w.key.IsZero() {
+			return nil, ErrZeroKey
+		}
+		gcm, err := w.header.newAEAD(w.key)
+		if err != nil {
+			return nil, err
+		}
+		w.aead = gcm
+	}
+	return w.aead, nil
+}
+
+// newGCM returns 256-bit AES-GCM using key, with nonces of nonceSize bytes.
+func newGCM(key Key, nonceSize int) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		// aes.NewCipher only returns an error for invalid key lengths,
+		// which isn't possible while keys are always 32 bytes,
+		// but it is reported as a KeySizeError in case other key sizes are supported.
+		return nil, keySizeError(err)
+	}
+
+	gcm, err := newGCMWithNonceSize(block, nonceSize)
+	if err != nil {
+		// the block size and nonce size are always valid,
+		// so this only fails in environments that restrict AES-GCM
+		return nil, aeadError(err)
+	}
+	return gcm, nil
+}
+
+// encrypt encrypts data using 256-bit AES-GCM.  This both hides the content of
+// the data and provides a check that it hasn't been altered. Output takes the
+// form nonce|ciphertext|tag where '|' indicates concatenation.
+// The additional data is authenticated but not included in the output.
+func encrypt(gcm cipher.AEAD, plaintext []byte, additionalData []byte) (ciphertext []byte, err error) {
+	return encryptTo(gcm, nil, plaintext, additionalData)
+}
+
+// encryptTo is like encrypt but appends the output to dst.
+// The ciphertext is sealed directly after the nonce,
+// so dst is only reallocated when it doesn't have capacity for the whole output.
+func encryptTo(gcm cipher.AEAD, dst, plaintext, additionalData []byte) ([]byte, error) {
+	dst = grow(dst, gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	nonce := dst[len(dst) : len(dst)+gcm.NonceSize()]
+	if _, err := rand.Read(nonce); err != nil {
 		return nil, fmt.Errorf("encrypt.encrypt: crypto.rand.Reader failed: %w", err)
 	}
+	return gcm.Seal(dst[:len(dst)+len(nonce)], nonce, plaintext, additionalData), nil
+}
 
-	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+// grow returns b with capacity for at least n more bytes.
+func grow(b []byte, n int) []byte {
+	if cap(b)-len(b) >= n {
+		return b
+	}
+	grown := make([]byte, len(b), len(b)+n)
+	copy(grown, b)
+	return grown
 }
 
 // NewReader returns a new Reader for decrypting r,
 // where r was encrypted by a Writer using key.
+// Sectors are read in full even when r returns short reads,
+// so a stream that was split into several files may be read with io.MultiReader
+// regardless of where the splits fall.
+//
+// If r implements io.Seeker then so does the Reader.
+// Seeking relative to the end with io.SeekEnd additionally requires the size of r,
+// which is determined by r implementing Sizer or a Stat method like *os.File.
+//
+// If r is a *bufio.Reader whose buffer holds at least SectorSize bytes, such as one from bufio.NewReaderSize,
+// each sector of a headerless stream is decrypted directly from that buffer instead of being copied out first.
+// The default bufio buffer of 4096 bytes is too small for this,
+// and streams with a header are always read into a separate buffer.
 func NewReader(r io.Reader, key Key) *Reader {
 	return &Reader{
 		r:   r,
@@ -170,6 +629,124 @@ func NewReader(r io.Reader, key Key) *Reader {
 	}
 }
 
+// NewReaderE is like NewReader, but validates its arguments up front
+// so that misconfiguration is reported where the Reader is created instead of by the first Read.
+// It returns an error wrapping ErrZeroKey if key is all zeroes,
+// a KeySizeError if the cipher doesn't support key,
+// or an error wrapping ErrAEADUnavailable if the cipher can't be created in the current environment.
+func NewReaderE(r io.Reader, key Key) (*Reader, error) {
+	if r == nil {
+		return nil, errors.New("encrypt.NewReaderE: nil reader")
+	}
+	if key.IsZero() {
+		return nil, fmt.Errorf("encrypt.NewReaderE: %w", ErrZeroKey)
+	}
+	if _, err := newGCM(key, nonceSize); err != nil {
+		return nil, fmt.Errorf("encrypt.NewReaderE: %w", err)
+	}
+	return NewReader(r, key), nil
+}
+
+// NewReaderSize returns a new Reader for decrypting r,
+// where r was encrypted by a Writer using key and ciphertextSize is the total size of r in bytes.
+//
+// This allows Seek to support io.SeekEnd for sources that are unable to report their own size,
+// such as a network stream whose length is known out-of-band.
+func NewReaderSize(r io.Reader, key Key, ciphertextSize int64) *Reader {
+	return &Reader{
+		r:     r,
+		key:   key,
+		size:  ciphertextSize,
+		sized: true,
+	}
+}
+
+// SetSize sets the total size of the underlying reader in bytes,
+// for sources whose size is known but which implement neither Sizer, a Stat method, nor io.Seeker.
+// This has the same effect as creating the Reader with NewReaderSize,
+// and allows Seek to support io.SeekEnd.
+func (r *Reader) SetSize(ciphertextSize int64) {
+	r.size = ciphertextSize
+	r.sized = true
+}
+
+// ErrAuthFailed is returned when data fails to authenticate,
+// which means that it was encrypted with a different key or has been modified.
+// Every method that decrypts data reports authentication failures with this error,
+// so callers can check for it with errors.Is.
+var ErrAuthFailed = errors.New("encrypt: message authentication failed")
+
+// ErrNonceLimitReached is returned by a Writer that has sealed as many chunks as it safely can with randomly chosen nonces.
+// The limit is 2^32 chunks for AES-GCM, about 256 TiB of data with the default chunk size,
+// and 2^48 for AES-GCM-SIV.
+// It is counted per stream, but the risk it guards against applies to every chunk sealed with the same key,
+// so programs that write many large streams should also rotate keys, for example with Key.Derive.
+var ErrNonceLimitReached = errors.New("encrypt: chunk limit for random nonces reached")
+
+// ErrTruncated is returned by a Reader when a stream with a header ends before its end record,
+// or when the plaintext that was read doesn't match the length declared by the end record.
+// For compatibility with earlier versions, errors.Is also matches it with io.ErrUnexpectedEOF.
+var ErrTruncated error = truncatedError{}
+
+type truncatedError struct{}
+
+func (truncatedError) Error() string { return "encrypt: stream is truncated" }
+
+func (truncatedError) Is(target error) bool { return target == io.ErrUnexpectedEOF }
+
+// ErrChunkTooLarge is returned by a Reader when a stream declares a chunk larger than its maximum chunk size,
+// before any memory is allocated for the chunk.
+var ErrChunkTooLarge = errors.New("encrypt: chunk exceeds the maximum chunk size")
+
+// SetMaxChunkSize sets the largest plaintext size of the chunks that r will decrypt to n bytes,
+// which bounds the memory used for each chunk when decrypting untrusted input.
+// The default limit is the chunk size declared in the header of the stream, or ChunkSize without one,
+// so n may raise it for streams whose chunks grow after a call to Writer.SetChunkSize, up to 16MB,
+// as well as lower it.
+// Larger chunks cause Read to return ErrChunkTooLarge.
+// SetMaxChunkSize should be called before the first Read.
+func (r *Reader) SetMaxChunkSize(n int) {
+	r.maxChunk = n
+}
+
+// chunkLimit returns the largest chunk that r will decrypt.
+func (r *Reader) chunkLimit() int {
+	if r.maxChunk > maxChunkSize {
+		return maxChunkSize
+	}
+	if r.maxChunk > 0 {
+		return r.maxChunk
+	}
+	return r.chunkSize()
+}
+
+// ErrLimitExceeded is returned by a Reader created with NewReaderLimit
+// when the stream contains more plaintext than the limit allows.
+var ErrLimitExceeded = errors.New("encrypt: plaintext size limit exceeded")
+
+// NewReaderLimit returns a new Reader for decrypting r,
+// where r was encrypted by a Writer using key,
+// that returns at most maxBytes bytes of plaintext.
+// Once maxBytes have been read, Read returns io.EOF if the stream ends there
+// and ErrLimitExceeded if it contains more data.
+//
+// Unlike wrapping r in an io.LimitReader, the limit applies to the decrypted data,
+// which protects consumers of untrusted input from unexpectedly large streams.
+func NewReaderLimit(r io.Reader, key Key, maxBytes int64) *Reader {
+	return &Reader{
+		r:       r,
+		key:     key,
+		limit:   maxBytes,
+		limited: true,
+	}
+}
+
+// Sizer is implemented by sources that know their total size in bytes, such as *bytes.Reader.
+// A Reader uses it to support seeking relative to the end of the underlying stream.
+type Sizer interface {
+	Size() int64
+}
+
 // Reader is an io.Reader capable of decrypting data that was encrypted by Writer.
 type Reader struct {
 	r   io.Reader
@@ -179,61 +756,439 @@ type Reader struct {
 	skip      int   // skip are the number of bytes the next decrypted chunk should remove, set within Seek.
 	plaintext []byte
 
+	detected bool      // detected is set once the start of the stream has been checked for a header.
+	header   *header   // header is non-nil for streams that begin with a header.
+	base     int64     // base is the position of the first sector in r, after any header.
+	src      io.Reader // src is r preceded by any bytes consumed while checking for a header.
+	index    int64     // index is the chunk index of the next record after a header.
+	total    int64     // total is the plaintext offset of the next record after a header.
+
+	toc   []ChunkEntry // toc is the table of contents of the stream, once it has been loaded.
+	chain []byte       // chain is the hash of the previous record, when records are chained.
+
+	tags io.Reader   // tags supplies the authentication tags when they are detached from the stream.
+	aead cipher.AEAD // aead is created on first use unless it was provided by NewReaderAEAD.
+
+	size  int64 // size is the size of r, when provided by the caller.
+	sized bool  // sized is set when size was provided by the caller.
+
+	maxChunk int           // maxChunk is the largest chunk that will be decrypted, when set by SetMaxChunkSize.
+	deadline time.Duration // deadline is the time allowed for reading each chunk, when set by SetChunkDeadline.
+	limiter  *rateLimiter  // limiter throttles the chunks read, when set by SetRateLimit.
+
+	recovering  bool                                 // recovering is set when chunks that fail to authenticate are replaced.
+	placeholder func(index int64, length int) []byte // placeholder returns the replacement for a failed chunk, or nil for zeroes.
+	failed      []int64                              // failed lists the indices of the chunks that were replaced.
+
+	limit   int64 // limit is the maximum plaintext offset that may be read.
+	limited bool  // limited is set when a limit was provided by the caller.
+
+	declared    int64 // declared is the plaintext length recorded by the end record, once it has been read.
+	hasDeclared bool  // hasDeclared is set once the end record has been read.
+	padding     int   // padding is the size of the final record of a uniform stream, including its padding, once it has been read.
+
+	section bool  // section is set for a Reader from NewSection, which ends at limit instead of enforcing it.
+	strict  bool  // strict is set for a Reader from NewStrictReader, which authenticates the whole stream before the first read.
+	start   int64 // start is the plaintext offset that Seek positions are relative to.
+
+	reversing bool  // reversing is set once PrevChunk has been called.
+	prevEnd   int64 // prevEnd is the plaintext offset of the end of the chunk that PrevChunk returns next.
+
+	aad func(chunkIndex int64) []byte // aad returns the additional data of each chunk, when set by NewReaderAAD.
+
 	err error
 }
 
 // Read implements io.Reader.
 func (r *Reader) Read(p []byte) (n int, err error) {
 	defer func() { r.offset += int64(n) }()
-	if len(r.plaintext) > 0 {
-		n = copy(p, r.plaintext)
-		r.plaintext = r.plaintext[n:]
-		return n, nil
-	}
-	if r.err != nil {
-		return 0, r.err
-	}
-	tmp := make([]byte, nonceSize+chunkSize+tagSize)
-	var nn int
-	if nn, err = io.ReadFull(r.r, tmp); errors.Is(err, io.ErrUnexpectedEOF) || err == io.EOF {
-		tmp = tmp[:nn]
-		r.err = io.EOF
-		if nn == 0 {
+	if r.limited {
+		remaining := r.limit - r.offset
+		if remaining <= 0 && r.section {
 			return 0, io.EOF
 		}
+		if remaining <= 0 {
+			return 0, r.checkLimit()
+		}
+		if int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
 	}
-	if r.plaintext, err = decrypt(tmp, r.key); err != nil {
-		return 0, err
+	// a chunk may be skipped entirely by a seek past the end of the final chunk,
+	// so keep reading until there is plaintext to return or an error.
+	for len(r.plaintext) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if err = r.detect(); err != nil {
+			return 0, err
+		}
+		var dst []byte
+		if len(p) >= r.chunkSize() && r.skip == 0 {
+			// a full chunk fits in p,
+			// so it can be decrypted in place without an intermediate buffer.
+			dst = p[:0:len(p)]
+		}
+		plaintext, err := r.next(dst)
+		if err != nil {
+			return 0, err
+		}
+		if dst != nil && len(plaintext) > 0 && len(plaintext) <= len(p) {
+			return len(plaintext), nil
+		}
+		if err = r.buffer(plaintext); err != nil {
+			return 0, err
+		}
 	}
-	n = copy(p, r.plaintext[r.skip:])
-	r.plaintext = r.plaintext[n+r.skip:]
-	r.skip = 0
+	n = copy(p, r.plaintext)
+	r.plaintext = r.plaintext[n:]
 	return n, nil
 }
 
-// decrypt decrypts data using 256-bit AES-GCM.  This both hides the content of
-// the data and provides a check that it hasn't been altered. Expects input
-// form nonce|ciphertext|tag where '|' indicates concatenation.
-func decrypt(ciphertext []byte, key Key) (plaintext []byte, err error) {
-	block, err := aes.NewCipher(key[:])
+// buffer holds decrypted plaintext for the following reads,
+// after removing the bytes that Seek moved past.
+func (r *Reader) buffer(plaintext []byte) error {
+	if r.skip > len(plaintext) {
+		// Seek moved past the end of a short chunk, which is only allowed for the final chunk.
+		// A short chunk before the end of a stream with a header means that its chunks vary in size,
+		// so the position Seek calculated from the chunk size is wrong.
+		if r.header != nil {
+			if _, err := r.next(nil); err != io.EOF {
+				r.err = errVariableSeek
+				return r.err
+			}
+		}
+		r.skip = len(plaintext)
+	}
+	r.plaintext = plaintext[r.skip:]
+	r.skip = 0
+	return nil
+}
+
+// errVariableSeek is returned when Reader.Seek finds that the chunks of a stream vary in size.
+var errVariableSeek = errors.New("encrypt.Reader.Seek: the chunks of the stream vary in size, so seeking requires a table of contents from EnableTOC")
+
+// checkLimit is called once a Reader created by NewReaderLimit has returned its limit.
+// It returns io.EOF if the stream ends at the limit and ErrLimitExceeded if more plaintext remains.
+func (r *Reader) checkLimit() error {
+	for len(r.plaintext) == 0 {
+		if r.err != nil {
+			return r.err
+		}
+		if err := r.detect(); err != nil {
+			return err
+		}
+		plaintext, err := r.next(nil)
+		if err != nil {
+			return err
+		}
+		if err = r.buffer(plaintext); err != nil {
+			return err
+		}
+	}
+	return ErrLimitExceeded
+}
+
+// next reads and decrypts the next chunk of the stream, appending the plaintext to dst.
+func (r *Reader) next(dst []byte) ([]byte, error) {
+	if err := r.setDeadline(); err != nil {
+		return nil, err
+	}
+	var plaintext []byte
+	var err error
+	if r.header != nil {
+		plaintext, err = r.readRecord(dst)
+	} else {
+		plaintext, err = r.readSector(dst)
+	}
+	if r.limiter != nil && err == nil {
+		nonceSize, tagSize := r.overhead()
+		overhead := nonceSize + tagSize
+		if r.header != nil {
+			overhead += recordHeaderSize
+			if r.header.checksums {
+				overhead += checksumSize
+			}
+		}
+		r.limiter.wait(len(plaintext), len(plaintext)+overhead)
+	}
+	return plaintext, err
+}
+
+// detect checks whether the stream begins with a header and reads it if so.
+func (r *Reader) detect() error {
+	if r.detected {
+		return nil
+	}
+	r.detected = true
+	if err := r.setDeadline(); err != nil {
+		r.err = err
+		return err
+	}
+	if r.strict {
+		if err := r.verifyStream(); err != nil {
+			r.err = err
+			return err
+		}
+	}
+	if p, ok := r.r.(peeker); ok {
+		// a headerless stream can be read directly from the buffer of a peeker without consuming its start
+		prefix, err := p.Peek(len(magic))
+		if err != nil && err != io.EOF {
+			r.err = err
+			return err
+		}
+		if string(prefix) != magic {
+			r.src = r.r
+			return nil
+		}
+	}
+	prefix := make([]byte, len(magic))
+	n, err := io.ReadFull(r.r, prefix)
+	if err != nil && err != io.EOF && !errors.Is(err, io.ErrUnexpectedEOF) {
+		r.err = err
+		return err
+	}
+	if string(prefix[:n]) != magic {
+		r.src = io.MultiReader(bytes.NewReader(prefix[:n]), r.r)
+		return nil
+	}
+	h, size, err := readHeader(r.r, r.key, r.aead)
+	if err == nil && r.maxChunk > 0 && h.chunkSize > r.chunkLimit() {
+		err = ErrChunkTooLarge
+	}
+	if err != nil {
+		r.err = err
+		return err
+	}
+	r.header = h
+	r.base = int64(len(magic)) + size
+	r.src = r.r
+	return nil
+}
+
+// readSector reads and decrypts the next sector of a headerless stream,
+// appending the plaintext to dst.
+func (r *Reader) readSector(dst []byte) ([]byte, error) {
+	nonceSize, tagSize := r.overhead()
+	tmp, err := r.peekSector()
 	if err != nil {
 		return nil, err
 	}
+	if tmp == nil {
+		tmp = make([]byte, r.sectorSize(), nonceSize+chunkSize+tagSize)
+		nn, err := io.ReadFull(r.src, tmp)
+		if errors.Is(err, io.ErrUnexpectedEOF) || err == io.EOF {
+			tmp = tmp[:nn]
+			r.err = io.EOF
+			if nn == 0 {
+				return nil, io.EOF
+			}
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if r.tags != nil {
+		if tmp, err = r.readTag(tmp); err != nil {
+			return nil, err
+		}
+	}
+	aead, err := r.cipher()
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := openRecord(aead, dst, tmp, r.chunkAD(nil))
+	if errors.Is(err, ErrAuthFailed) && r.recovering {
+		plaintext, err = r.recover(dst, len(tmp)-nonceSize-tagSize), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.index++
+	return plaintext, nil
+}
+
+// peeker is implemented by buffered readers such as *bufio.Reader.
+type peeker interface {
+	Peek(n int) ([]byte, error)
+	Discard(n int) (discarded int, err error)
+}
+
+// peekSector returns the next sector of a headerless stream directly from the buffer of r.src
+// when it is a peeker that holds the whole sector, and consumes it,
+// which avoids copying the sector into a separate buffer before decrypting it.
+// The sector is only valid until the next read from r.src.
+// It returns nil if the sector must be read with io.ReadFull instead.
+func (r *Reader) peekSector() ([]byte, error) {
+	p, ok := r.src.(peeker)
+	if !ok || r.tags != nil {
+		return nil, nil
+	}
+	sector, err := p.Peek(int(r.sectorSize()))
+	switch {
+	case err == io.EOF && len(sector) == 0:
+		r.err = io.EOF
+		return nil, io.EOF
+	case err == io.EOF:
+		// the final sector is short
+		r.err = io.EOF
+	case err != nil:
+		// the buffer is too small for a sector, or the error is left for io.ReadFull to report
+		return nil, nil
+	}
+	// bufio.Reader.Discard doesn't read from the source when the bytes are already buffered,
+	// so the peeked sector remains intact until the next read
+	if _, err := p.Discard(len(sector)); err != nil {
+		return nil, err
+	}
+	return sector, nil
+}
 
-	gcm, err := cipher.NewGCM(block)
+// readRecord reads and decrypts the next record of a stream with a header,
+// appending the plaintext to dst.
+func (r *Reader) readRecord(dst []byte) ([]byte, error) {
+	var prefix [recordHeaderSize]byte
+	if _, err := io.ReadFull(r.src, prefix[:]); err != nil {
+		return nil, truncated(err)
+	}
+	kind := prefix[0]
+	length := binary.BigEndian.Uint32(prefix[1:])
+	nonceSize, tagSize := r.overhead()
+	if int64(length) > int64(nonceSize+r.chunkLimit()+tagSize) {
+		return nil, ErrChunkTooLarge
+	}
+	sealed := make([]byte, length)
+	if _, err := io.ReadFull(r.src, sealed); err != nil {
+		return nil, truncated(err)
+	}
+	if r.header.checksums {
+		// the checksum is only for QuickCheck, since decrypting the record authenticates it
+		var sum [checksumSize]byte
+		if _, err := io.ReadFull(r.src, sum[:]); err != nil {
+			return nil, truncated(err)
+		}
+	}
+	aead, err := r.cipher()
+	if err != nil {
+		return nil, err
+	}
+	ad := recordAD(kind, r.index, r.header.binding)
+	if r.header.chained {
+		ad = append(ad, r.chain...)
+	}
+	if kind == recordData || kind == recordPadded {
+		ad = r.chunkAD(ad)
+	}
+	plaintext, err := openRecord(aead, dst, sealed, ad)
+	if errors.Is(err, ErrAuthFailed) && r.recovering && kind != recordEnd {
+		// the record is assumed to hold data, since only the end record has a special meaning
+		length := len(sealed) - nonceSize - tagSize
+		if length < 0 {
+			length = 0
+		}
+		plaintext = r.recover(dst, length)
+		if r.header.chained {
+			r.chain = chainHash(sealed)
+		}
+		r.index++
+		r.total += int64(length)
+		return plaintext, nil
+	}
+	if err != nil && r.header.chained {
+		return nil, fmt.Errorf("encrypt: record %d does not authenticate against the chain of previous records: %w", r.index, err)
+	}
 	if err != nil {
 		return nil, err
 	}
+	if r.header.chained {
+		r.chain = chainHash(sealed)
+	}
+	switch kind {
+	case recordData:
+		r.index++
+		r.total += int64(len(plaintext))
+		return plaintext, nil
+	case recordEnd:
+		if len(plaintext) != 8 {
+			return nil, errors.New("encrypt: malformed end record")
+		}
+		r.declared = int64(binary.BigEndian.Uint64(plaintext))
+		r.hasDeclared = true
+		// the final record of a uniform stream may hold up to r.padding bytes that aren't counted yet
+		if r.declared < r.total || r.declared > r.total+int64(r.padding) {
+			return nil, fmt.Errorf("encrypt: read %d bytes of a stream declaring %d: %w", r.total, r.declared, ErrTruncated)
+		}
+		r.err = io.EOF
+		return nil, io.EOF
+	case recordPadded:
+		return r.readPadded(plaintext)
+	default:
+		return nil, fmt.Errorf("encrypt: unsupported record kind %d", kind)
+	}
+}
+
+// truncated converts an EOF encountered in the middle of a stream into ErrTruncated.
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTruncated
+	}
+	return err
+}
 
+// DeclaredSize returns the plaintext length recorded at the end of a stream with a header,
+// once the end has been read,
+// which gives consumers that can't seek both the size of the stream and an assurance that none of it was lost.
+// It reports false for headerless streams, which don't record their length,
+// and before the end of the stream has been reached.
+func (r *Reader) DeclaredSize() (int64, bool) {
+	return r.declared, r.hasDeclared
+}
+
+// AtEOF reports whether r has reached the end of the stream and returned all of its plaintext,
+// so that the next call to Read would return io.EOF. It doesn't perform any I/O.
+//
+// AtEOF only reflects what earlier calls to Read have found:
+// it reports false until a Read has encountered the end of the stream,
+// which for streams with a header happens when the end record is read after the final chunk.
+func (r *Reader) AtEOF() bool {
+	return r.err == io.EOF && len(r.plaintext) == 0
+}
+
+// cipher returns the AEAD used to decrypt the stream, creating it on first use.
+// Failing to create it makes the stream unreadable, so the error is returned by every following Read.
+func (r *Reader) cipher() (cipher.AEAD, error) {
+	if r.aead == nil {
+		gcm, err := r.header.newAEAD(r.key)
+		if err != nil {
+			r.err = err
+			return nil, err
+		}
+		r.aead = gcm
+	}
+	return r.aead, nil
+}
+
+// decrypt decrypts data using 256-bit AES-GCM.  This both hides the content of
+// the data and provides a check that it hasn't been altered. Expects input
+// form nonce|ciphertext|tag where '|' indicates concatenation.
+// The additional data must match the data that was provided to encrypt.
+// The plaintext is appended to dst, which may be nil.
+func decrypt(gcm cipher.AEAD, dst, ciphertext []byte, additionalData []byte) (plaintext []byte, err error) {
 	if len(ciphertext) < gcm.NonceSize() {
 		return nil, errors.New("malformed ciphertext")
 	}
 
-	return gcm.Open(nil,
+	plaintext, err = gcm.Open(dst,
 		ciphertext[:gcm.NonceSize()],
 		ciphertext[gcm.NonceSize():],
-		nil,
+		additionalData,
 	)
+	if err != nil {
+		// the AEAD interface doesn't distinguish its errors,
+		// and any failure to open means the data was altered or the key is wrong
+		return nil, ErrAuthFailed
+	}
+	return plaintext, nil
 }
 
 // NewKey generates a new random key for symmetric encryption.
@@ -246,6 +1201,63 @@ func NewKey() (key Key, err error) {
 // Key is a 256-bit key used for AES-GCM encryption and decryption.
 type Key [32]byte
 
+// Bytes returns a copy of the raw key bytes.
+// Since the returned slice does not share memory with key,
+// callers may modify it without affecting the original key.
+func (key Key) Bytes() []byte {
+	b := make([]byte, len(key))
+	copy(b, key[:])
+	return b
+}
+
+// IsZero reports whether every byte of key is zero,
+// which is the value of a Key that was declared but never generated or loaded.
+func (key Key) IsZero() bool {
+	return subtle.ConstantTimeCompare(key[:], make([]byte, len(key))) == 1
+}
+
+// Derive returns a subkey of key for the purpose described by info,
+// using HKDF-Expand (RFC 5869) with SHA-256.
+// Keys derived with distinct info values are independent of each other and of key itself,
+// which allows a single master key to be used for several purposes:
+//
+//	contentKey := master.Derive([]byte("file-contents"))
+//	nameKey := master.Derive([]byte("file-names"))
+func (key Key) Derive(info []byte) (subkey Key) {
+	// key is already uniformly random, so it is used directly as the pseudorandom key
+	// and the extract step is skipped.
+	// A single round of expand is enough to fill 32 bytes of output:
+	// T(1) = HMAC-Hash(PRK, info | 0x01)
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write(info)
+	mac.Write([]byte{1})
+	copy(subkey[:], mac.Sum(nil))
+	return subkey
+}
+
+// Fingerprint returns a short identifier for key that is safe to store alongside ciphertext,
+// which allows a program to select the right key for a stream.
+// It is derived from key with Derive, so it reveals nothing about the key itself.
+// Streams with a header record the fingerprint of their key, as reported by ReadHeader.
+func (key Key) Fingerprint() []byte {
+	subkey := key.Derive([]byte("encrypt key fingerprint"))
+	return subkey[:8]
+}
+
+// NameFor returns a name for storing a blob whose plaintext has the digest plaintextDigest,
+// such as its SHA-256 hash, which is useful for content-addressed storage of encrypted data.
+// The name is a lowercase hex HMAC-SHA256 of the digest with a subkey derived from key,
+// so it is the same for the same plaintext and key,
+// but reveals nothing about the plaintext to anyone without the key,
+// not even whether two keys stored the same plaintext.
+// It is safe to use in URLs and file names.
+func (key Key) NameFor(plaintextDigest []byte) string {
+	subkey := key.Derive([]byte("encrypt content name"))
+	mac := hmac.New(sha256.New, subkey[:])
+	mac.Write(plaintextDigest)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
 // String converts key to a string using standard base64 encoding,
 // which is generally more portable between programs than 32 bytes of random binary data.
 func (key Key) String() string {
@@ -253,29 +1265,88 @@ func (key Key) String() string {
 }
 
 // DecodeBase64Key decodes a base64-encoded key.
+// If an error is returned, the key is all zeroes rather than partially decoded.
 func DecodeBase64Key(s string) (key Key, err error) {
 	var k []byte
 	k, err = base64.StdEncoding.DecodeString(s)
 	if err == nil && len(k) != 32 {
 		err = ErrInvalidKeyLength
 	}
+	if err != nil {
+		return Key{}, err
+	}
 	copy(key[:], k)
-	return key, err
+	return key, nil
+}
+
+// LoadKey loads a key from source, which takes one of three forms:
+// "env:NAME" decodes the base64-encoded value of the environment variable NAME,
+// "file:PATH" reads the file at PATH, which holds either the 32 raw bytes of the key or its base64 encoding,
+// and any other string is decoded as a base64-encoded key.
+// This allows programs to accept a key from any of these sources with a single flag.
+//
+// As with DecodeBase64Key, a key of the wrong size results in ErrInvalidKeyLength.
+func LoadKey(source string) (Key, error) {
+	switch {
+	case strings.HasPrefix(source, "env:"):
+		name := strings.TrimPrefix(source, "env:")
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return Key{}, fmt.Errorf("encrypt.LoadKey: environment variable %s is not set", name)
+		}
+		return DecodeBase64Key(strings.TrimSpace(value))
+	case strings.HasPrefix(source, "file:"):
+		b, err := os.ReadFile(strings.TrimPrefix(source, "file:"))
+		if err != nil {
+			return Key{}, fmt.Errorf("encrypt.LoadKey: %w", err)
+		}
+		if len(b) == len(Key{}) {
+			var key Key
+			copy(key[:], b)
+			return key, nil
+		}
+		// base64 key files often end with a newline
+		return DecodeBase64Key(strings.TrimSpace(string(b)))
+	default:
+		return DecodeBase64Key(source)
+	}
 }
 
 // Seek sets the offset for the next Read,
 // partially implementing io.Seeker:
 // io.SeekStart means relative to the start of the file,
 // io.SeekCurrent means relative to the current offset.
-// io.SeekEnd is only supported for specific types.
+// io.SeekEnd requires the size of the underlying reader,
+// which comes from NewReaderSize, a Size or Stat method,
+// or else seeking the underlying reader to its end and back if it implements io.Seeker.
 //
-// Seek will return an error if r.r is not an io.Seeker.
+// If r.r is not an io.Seeker, forward seeks are emulated by reading and discarding the plaintext in between,
+// and Seek will return an error for a backward seek.
+// Seek(0, io.SeekCurrent) reports the current offset without seeking.
 func (r *Reader) Seek(offset int64, whence int) (int64, error) {
 	var newOffset int64
 	var overshot bool
 	var lastChunkSize int
-	if _, ok := r.r.(io.Seeker); !ok {
-		return 0, fmt.Errorf("encrypt.Reader.Seek: seek method not supported by %T", r.r)
+	if offset == 0 && whence == io.SeekCurrent {
+		// reporting the current position doesn't require moving the underlying reader
+		return r.offset - r.start, nil
+	}
+	s, _ := r.r.(io.Seeker)
+	if _, ok := r.tags.(io.Seeker); r.tags != nil && !ok {
+		// both streams must be repositioned together
+		s = nil
+	}
+	if !r.detected {
+		// sector positions depend on the size of the header,
+		// so the start of the stream needs to be checked first.
+		if s != nil {
+			if _, err := s.Seek(0, io.SeekStart); err != nil {
+				return 0, fmt.Errorf("encrypt.Reader.Seek: %w", err)
+			}
+		}
+		if err := r.detect(); err != nil {
+			return 0, fmt.Errorf("encrypt.Reader.Seek: %w", err)
+		}
 	}
 
 	switch whence {
@@ -288,26 +1359,20 @@ func (r *Reader) Seek(offset int64, whence int) (int64, error) {
 	case io.SeekStart:
 		newOffset = offset
 	case io.SeekCurrent:
-		newOffset = offset + r.offset
+		newOffset = offset + r.offset - r.start
 	case io.SeekEnd:
-		var size int64
-		if s, ok := r.r.(sizer); ok {
-			size = s.Size()
-		} else if s, ok := r.r.(statSizer); ok {
-			fi, err := s.Stat()
-			if err != nil {
-				return 0, fmt.Errorf("encrypt.Reader.Seek: unable to determine size: %w", err)
-			}
-			size = fi.Size()
-		} else {
-			return 0, fmt.Errorf("encrypt.Reader.Seek: io.SeekEnd is not supported for %T", r.r)
+		if r.section {
+			newOffset = r.limit - r.start + offset
+			break
+		}
+		size, err := r.sourceSize()
+		if err != nil {
+			return 0, err
 		}
-		const sectorSize = nonceSize + chunkSize + tagSize
-		lastSectorSize := size % sectorSize
-		if lastSectorSize != 0 {
-			lastChunkSize = int(lastSectorSize - (nonceSize + tagSize))
+		var dataSize int64
+		if dataSize, lastChunkSize, err = r.dataSize(size); err != nil {
+			return 0, err
 		}
-		dataSize := size/sectorSize*chunkSize + int64(lastChunkSize)
 		newOffset = dataSize + offset
 		if newOffset > dataSize {
 			overshot = true
@@ -317,10 +1382,51 @@ func (r *Reader) Seek(offset int64, whence int) (int64, error) {
 	if newOffset < 0 {
 		return 0, errors.New("encrypt.Reader.Seek: negative position")
 	}
+	// positions within a section are relative to its start
+	newOffset += r.start
+	if s == nil {
+		if _, err := r.discard(newOffset); err != nil {
+			return 0, err
+		}
+		return newOffset - r.start, nil
+	}
 
-	sectorStart := getSectorStart(newOffset)
+	if r.header != nil && r.header.variable && !r.header.toc {
+		return 0, errVariableSeek
+	}
+	chunkSize := int64(r.chunkSize())
+	index := newOffset / chunkSize
+	total := index * chunkSize
+	sectorStart := r.base + index*r.sectorSize()
+	if r.header != nil && r.header.toc {
+		// chunks may vary in size, so their positions come from the table of contents
+		var err error
+		if index, total, sectorStart, overshot, err = r.seekTOC(newOffset); err != nil {
+			return 0, err
+		}
+		lastChunkSize = 0
+	} else if r.header != nil {
+		// Records past the end of the data would fail to authenticate,
+		// so seeking past the end positions the cursor at the final record instead.
+		if size, err := r.sourceSize(); err == nil {
+			dataSize, _, err := r.dataSize(size)
+			if err == errVariableSeek {
+				return 0, err
+			}
+			if err == nil && newOffset >= dataSize {
+				index = (dataSize + chunkSize - 1) / chunkSize
+				total = dataSize
+				sectorStart = r.endRecordStart(size)
+				overshot = true
+				lastChunkSize = 0
+			} else if end := r.endRecordStart(size); sectorStart < end && !r.header.uniform && !r.header.padded {
+				if err := r.checkRecord(s, sectorStart, end); err != nil {
+					return 0, err
+				}
+			}
+		}
+	}
 
-	s := r.r.(io.Seeker)
 	n, err := s.Seek(sectorStart, io.SeekStart)
 	if err != nil {
 		return 0, fmt.Errorf("encrypt.Reader.Seek: %w", err)
@@ -328,6 +1434,16 @@ func (r *Reader) Seek(offset int64, whence int) (int64, error) {
 	if n != sectorStart {
 		return 0, fmt.Errorf("encrypt.Reader.Seek: expected seek position to be %v; got %v", sectorStart, n)
 	}
+	if r.tags != nil {
+		if err := r.seekTag(index); err != nil {
+			return 0, fmt.Errorf("encrypt.Reader.Seek: %w", err)
+		}
+	}
+	if r.header != nil && r.header.chained {
+		if err := r.seekChain(s, index, sectorStart); err != nil {
+			return 0, fmt.Errorf("encrypt.Reader.Seek: %w", err)
+		}
+	}
 
 	if overshot {
 		// this should place the cursor at exactly the end of the file,
@@ -336,21 +1452,331 @@ func (r *Reader) Seek(offset int64, whence int) (int64, error) {
 	} else {
 		// this should make the next call to Read skip to the correct offset
 		// within the next decoded chunk
-		r.skip = int(newOffset % chunkSize)
+		r.skip = int(newOffset - total)
+	}
+	if r.err == io.EOF {
+		// the stream can be read again from the new position
+		r.err = nil
 	}
 	r.offset = newOffset
 	r.plaintext = nil
+	r.src = r.r
+	r.index = index
+	r.total = total
+	r.padding = 0
+	return newOffset - r.start, nil
+}
+
+// SeekSector sets the offset for the next Read to the start of the chunk containing plaintextOffset
+// and returns the plaintext offset of that chunk,
+// which avoids decrypting and discarding the part of the chunk before plaintextOffset.
+// Offsets past the end of the data are handled as by Seek.
+//
+// If r.r is not an io.Seeker, the chunks before plaintextOffset are read and discarded
+// and the Reader is positioned at exactly plaintextOffset.
+func (r *Reader) SeekSector(plaintextOffset int64) (actualOffset int64, err error) {
+	if plaintextOffset < 0 {
+		return 0, errors.New("encrypt.Reader.SeekSector: negative position")
+	}
+	if _, err := r.Seek(plaintextOffset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	back := int64(r.skip)
+	if r.offset-back < r.start {
+		// a section can't be read from before its start
+		back = r.offset - r.start
+	}
+	r.offset -= back
+	r.skip -= int(back)
+	return r.offset - r.start, nil
+}
+
+// discard emulates a forward seek to newOffset for sources that don't implement io.Seeker
+// by reading and discarding the plaintext in between.
+func (r *Reader) discard(newOffset int64) (int64, error) {
+	if newOffset < r.offset {
+		return 0, fmt.Errorf("encrypt.Reader.Seek: seek method not supported by %T", r.r)
+	}
+	if _, err := io.CopyN(io.Discard, r, newOffset-r.offset); err != nil && err != io.EOF {
+		return 0, fmt.Errorf("encrypt.Reader.Seek: %w", err)
+	}
+	// like os.File, seeking past the end is allowed and the next Read reports io.EOF
+	r.offset = newOffset
 	return newOffset, nil
 }
 
-type statSizer interface {
-	Stat() (os.FileInfo, error)
+// chunkSize returns the plaintext size of each full chunk of the stream.
+func (r *Reader) chunkSize() int {
+	if r.header != nil && r.header.chunkSize != 0 {
+		return r.header.chunkSize
+	}
+	return chunkSize
 }
-type sizer interface {
-	Size() int64
+
+// sectorSize returns the size of each full sector of the stream.
+func (r *Reader) sectorSize() int64 {
+	chunkSize := int64(r.chunkSize())
+	nonceSize, tagSize := r.overhead()
+	if r.header != nil {
+		size := recordHeaderSize + int64(nonceSize) + chunkSize + int64(tagSize)
+		if r.header.checksums {
+			size += checksumSize
+		}
+		return size
+	}
+	if r.tags != nil {
+		return int64(nonceSize) + chunkSize
+	}
+	return int64(nonceSize) + chunkSize + int64(tagSize)
+}
+
+// overhead returns the size of the nonce and tag that are added to each chunk of the stream.
+func (r *Reader) overhead() (nonce, tag int) {
+	if r.aead != nil {
+		return r.aead.NonceSize(), r.aead.Overhead()
+	}
+	return r.header.nonceSize(), tagSize
+}
+
+// endRecordSize returns the size of the final record of a stream with a header,
+// which holds a uint64 plaintext length.
+func (r *Reader) endRecordSize() int64 {
+	nonceSize, tagSize := r.overhead()
+	size := int64(recordHeaderSize + nonceSize + 8 + tagSize)
+	if r.header.checksums {
+		size += checksumSize
+	}
+	return size
+}
+
+// endRecordStart returns the position of the end record of a stream with a header
+// when the underlying reader is size bytes long, before anything that follows it such as a trailer.
+func (r *Reader) endRecordStart(size int64) int64 {
+	start := size - r.endRecordSize()
+	if r.header.trailer {
+		start -= trailerSize
+	}
+	return start
 }
 
-func getSectorStart(offset int64) int64 {
-	const sectorSize = nonceSize + chunkSize + tagSize
-	return (offset / chunkSize) * sectorSize
+// checkRecord returns errVariableSeek unless the record at start is a data record of the size
+// that the chunk size in the header gives every record except the final one, which ends at end.
+// The position of s is restored afterwards.
+func (r *Reader) checkRecord(s io.Seeker, start, end int64) error {
+	pos, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("encrypt.Reader.Seek: %w", err)
+	}
+	if _, err := s.Seek(start, io.SeekStart); err != nil {
+		return fmt.Errorf("encrypt.Reader.Seek: %w", err)
+	}
+	var prefix [recordHeaderSize]byte
+	_, err = io.ReadFull(r.r, prefix[:])
+	if _, err := s.Seek(pos, io.SeekStart); err != nil {
+		return fmt.Errorf("encrypt.Reader.Seek: %w", err)
+	}
+	if err != nil {
+		return fmt.Errorf("encrypt.Reader.Seek: %w", truncated(err))
+	}
+	size := recordHeaderSize + int64(binary.BigEndian.Uint32(prefix[1:]))
+	if r.header.checksums {
+		size += checksumSize
+	}
+	switch {
+	case prefix[0] != recordData:
+	case size == r.sectorSize() && start+size <= end:
+		return nil
+	case size < r.sectorSize() && start+size == end:
+		return nil
+	}
+	return errVariableSeek
+}
+
+// dataSize returns the plaintext size of the stream when the underlying reader is size bytes long,
+// along with the plaintext size of the final chunk.
+// An error is returned if no stream produced by Writer could have that size.
+func (r *Reader) dataSize(size int64) (dataSize int64, lastChunkSize int, err error) {
+	if r.header != nil && r.header.padded {
+		return 0, 0, errors.New("encrypt.Reader.Seek: the size of a padded stream does not reveal its length")
+	}
+	if r.header != nil && r.header.uniform {
+		return r.uniformSize(size)
+	}
+	if r.header != nil && r.header.variable && !r.header.toc {
+		return 0, 0, errVariableSeek
+	}
+	if r.header != nil && r.header.toc {
+		toc, err := r.TOC()
+		if err != nil || len(toc) == 0 {
+			return 0, 0, err
+		}
+		last := toc[len(toc)-1]
+		return last.PlaintextOffset + int64(last.PlaintextLength), last.PlaintextLength, nil
+	}
+	region := size - r.base
+	if r.header != nil {
+		region = r.endRecordStart(size) - r.base
+	}
+	if region == 0 {
+		return 0, 0, nil
+	}
+	sectorSize := r.sectorSize()
+	overhead := sectorSize - int64(r.chunkSize())
+	lastSectorSize := region % sectorSize
+	if lastSectorSize == 0 {
+		// the size is an exact multiple of the sector size,
+		// so the final sector holds a full chunk
+		lastSectorSize = sectorSize
+	}
+	// Writer never produces empty chunks,
+	// so the final sector must hold at least one byte of plaintext.
+	if region < 0 || lastSectorSize <= overhead {
+		return 0, 0, fmt.Errorf("encrypt: invalid ciphertext size %d", size)
+	}
+	lastChunkSize = int(lastSectorSize - overhead)
+	if s, ok := r.r.(io.Seeker); ok && r.header != nil {
+		end := r.base + region
+		if err := r.checkRecord(s, end-lastSectorSize, end); err != nil {
+			return 0, 0, err
+		}
+	}
+	fullSectors := (region - lastSectorSize) / sectorSize
+	return fullSectors*int64(r.chunkSize()) + int64(lastChunkSize), lastChunkSize, nil
+}
+
+// SectorCount returns the number of sectors in a headerless stream that is ciphertextSize bytes long,
+// including the partial final sector.
+// This is the number of chunks that Writer produced.
+func SectorCount(ciphertextSize int64) int64 {
+	return (ciphertextSize + SectorSize - 1) / SectorSize
+}
+
+// SectorStart returns the position in a headerless stream of the sector that holds plaintextOffset,
+// which is the ciphertext offset that Reader.Seek moves to.
+// Together with SectorSize this gives the byte range to fetch for a range of plaintext,
+// such as for an HTTP Range request against object storage.
+func SectorStart(plaintextOffset int64) int64 {
+	return plaintextOffset / chunkSize * SectorSize
+}
+
+// SectorStartSize returns the position of the record that holds plaintextOffset
+// in a stream with a header whose chunks hold chunkSize bytes of plaintext,
+// as reported by Header.ChunkSize, using the standard 12-byte nonces.
+// The position is relative to the end of the header, whose length is Header.Size.
+// Streams whose chunks vary in size need the table of contents from Reader.TOC instead.
+func SectorStartSize(plaintextOffset int64, chunkSize int) int64 {
+	recordSize := int64(recordHeaderSize + nonceSize + chunkSize + tagSize)
+	return plaintextOffset / int64(chunkSize) * recordSize
+}
+
+// EncryptedSize returns the size of the headerless stream that NewWriter produces
+// for plaintextSize bytes of plaintext.
+func EncryptedSize(plaintextSize int64) int64 {
+	chunks := (plaintextSize + chunkSize - 1) / chunkSize
+	return plaintextSize + chunks*(nonceSize+tagSize)
+}
+
+// DecryptedSize returns the size of the plaintext of a headerless stream that is ciphertextSize bytes long.
+// An error is returned if no stream produced by NewWriter could have that size.
+func DecryptedSize(ciphertextSize int64) (int64, error) {
+	size, _, err := (&Reader{}).dataSize(ciphertextSize)
+	return size, err
+}
+
+// SectorCount returns the number of sectors in the stream, including the partial final sector.
+// The size of the underlying reader must be known,
+// either through NewReaderSize, by implementing a Size or Stat method, or by implementing io.Seeker.
+func (r *Reader) SectorCount() (int64, error) {
+	if err := r.detect(); err != nil {
+		return 0, err
+	}
+	size, err := r.sourceSize()
+	if err != nil {
+		return 0, err
+	}
+	if r.header != nil && r.header.padded {
+		return 0, errors.New("encrypt.Reader.SectorCount: the size of a padded stream does not reveal its length")
+	}
+	if r.header != nil && r.header.variable {
+		return 0, errors.New("encrypt.Reader.SectorCount: the chunks of the stream vary in size")
+	}
+	region := size - r.base
+	if r.header != nil {
+		region = r.endRecordStart(size) - r.base
+	}
+	sectorSize := r.sectorSize()
+	return (region + sectorSize - 1) / sectorSize, nil
+}
+
+// Remaining returns the number of bytes of plaintext between the current offset and the end of the stream,
+// such as for the Content-Length of a range response after a call to Seek.
+// It returns 0 if the offset is past the end.
+// The size of the underlying reader must be known,
+// either through NewReaderSize, by implementing a Size or Stat method, or by implementing io.Seeker,
+// unless r is a section from NewSection.
+func (r *Reader) Remaining() (int64, error) {
+	var size int64
+	if r.section {
+		size = r.limit - r.start
+	} else {
+		var err error
+		if size, err = r.plaintextSize(); err != nil {
+			return 0, err
+		}
+	}
+	if remaining := size - (r.offset - r.start); remaining > 0 {
+		return remaining, nil
+	}
+	return 0, nil
+}
+
+// plaintextSize returns the size of the decrypted stream,
+// which requires the size of the underlying reader.
+func (r *Reader) plaintextSize() (int64, error) {
+	if err := r.detect(); err != nil {
+		return 0, err
+	}
+	size, err := r.sourceSize()
+	if err != nil {
+		return 0, err
+	}
+	dataSize, _, err := r.dataSize(size)
+	return dataSize, err
+}
+
+// sourceSize returns the size of the underlying reader, if it can be determined.
+func (r *Reader) sourceSize() (int64, error) {
+	if r.sized {
+		return r.size, nil
+	}
+	if s, ok := r.r.(Sizer); ok {
+		return s.Size(), nil
+	}
+	if s, ok := r.r.(statSizer); ok {
+		fi, err := s.Stat()
+		if err != nil {
+			return 0, fmt.Errorf("encrypt.Reader.Seek: unable to determine size: %w", err)
+		}
+		return fi.Size(), nil
+	}
+	if s, ok := r.r.(io.Seeker); ok {
+		// the end of the source is found by seeking to it, after which the position is restored
+		pos, err := s.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, fmt.Errorf("encrypt.Reader.Seek: unable to determine size: %w", err)
+		}
+		size, err := s.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, fmt.Errorf("encrypt.Reader.Seek: unable to determine size: %w", err)
+		}
+		if _, err := s.Seek(pos, io.SeekStart); err != nil {
+			return 0, fmt.Errorf("encrypt.Reader.Seek: %w", err)
+		}
+		return size, nil
+	}
+	return 0, fmt.Errorf("encrypt.Reader.Seek: io.SeekEnd is not supported for %T", r.r)
+}
+
+type statSizer interface {
+	Stat() (os.FileInfo, error)
 }
@@ -1,13 +1,21 @@
 package encrypt_test
 
 import (
+	"bufio"
 	"bytes"
+	"crypto/cipher"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/Travis-Britz/encrypt"
 )
@@ -137,6 +145,12 @@ func TestKeyFromBase64(t *testing.T) {
 		t.Errorf("expected ErrInvalidKeyLength")
 	}
 
+	// a truncated key must not be partially copied into the result
+	short := base64.StdEncoding.EncodeToString([]byte("TestKey000000000000000000000000"))
+	if key, err := encrypt.DecodeBase64Key(short); !errors.Is(err, encrypt.ErrInvalidKeyLength) || key != (encrypt.Key{}) {
+		t.Errorf("expected a zero key with ErrInvalidKeyLength; got %v/%v", key, err)
+	}
+
 	if _, err := encrypt.DecodeBase64Key(testKey); err != nil {
 		t.Error(err)
 	}
@@ -179,13 +193,35 @@ func TestWriter_Write(t *testing.T) {
 	if m != chunkSize {
 		t.Errorf("expected number of bytes written to equal the size of the first chunk; got %v", m)
 	}
+	// the failed chunk would leave a gap in the stream, so the writer must stay unusable
+	if n, err := w.Write([]byte("Hello, world!")); err == nil || n != 0 {
+		t.Errorf("expected writes after a failed flush to return 0/error; got %v/%v", n, err)
+	}
+	if err := w.Close(); err == nil || err.Error() != "failed write" {
+		t.Errorf("expected Close to return the original write error; got %v", err)
+	}
 
+	// n must only count the bytes of p whose chunks reached the underlying writer
+	w = encrypt.NewWriter(&badWriter{failAt: 2}, key)
+	if n, err := w.Write(make([]byte, 100)); n != 100 || err != nil {
+		t.Fatalf("expected a buffered write to return 100/nil; got %v/%v", n, err)
+	}
+	if n, err := w.Write(make([]byte, 2*chunkSize)); n != chunkSize-100 || err == nil {
+		t.Errorf("expected the failing write to return %v/error; got %v/%v", chunkSize-100, n, err)
+	}
+	w = encrypt.NewWriter(&badWriter{failAt: 1}, key)
+	w.Write(make([]byte, 100))
+	if n, err := w.Write(make([]byte, chunkSize)); n != 0 || err == nil {
+		t.Errorf("expected a write whose chunk failed to return 0/error; got %v/%v", n, err)
+	}
 }
 func TestReader_Seek_BadSeeker(t *testing.T) {
 	key, _ := encrypt.DecodeBase64Key(testKey)
-	r := encrypt.NewReader(&bytes.Buffer{}, key)
+	ciphertext, _ := os.ReadFile("testdata/ciphertext.txt")
+	r := encrypt.NewReader(bytes.NewBuffer(ciphertext), key)
+	io.ReadFull(r, make([]byte, 10))
 	if _, err := r.Seek(0, 0); err == nil {
-		t.Errorf("expected Seek to return an error because r does not implement io.Seeker; got nil")
+		t.Errorf("expected Seek to return an error for a backward seek because r does not implement io.Seeker; got nil")
 	}
 	r = encrypt.NewReader(&badSeeker{Reader: &bytes.Buffer{}, err: errors.New("seek failed")}, key)
 	if _, err := r.Seek(0, 0); err == nil {
@@ -210,6 +246,173 @@ func TestReader_Seek_BadSeeker(t *testing.T) {
 	}
 }
 
+func TestReader_Seek_tell(t *testing.T) {
+	key, _ := encrypt.DecodeBase64Key(testKey)
+	ciphertext, err := os.ReadFile("testdata/ciphertext.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// io.MultiReader hides the Seek method of the underlying reader
+	r := encrypt.NewReader(io.MultiReader(bytes.NewReader(ciphertext)), key)
+	if n, err := r.Seek(0, io.SeekCurrent); n != 0 || err != nil {
+		t.Errorf("expected 0/nil; got %d/%v", n, err)
+	}
+	if _, err := io.ReadFull(r, make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.Seek(0, io.SeekCurrent); n != 100 || err != nil {
+		t.Errorf("expected 100/nil; got %d/%v", n, err)
+	}
+	if _, err := r.Seek(-1, io.SeekCurrent); err == nil {
+		t.Errorf("expected Seek to return an error for a backward seek on a non-seeker; got nil")
+	}
+}
+
+func TestNewReaderSize(t *testing.T) {
+	key, _ := encrypt.DecodeBase64Key(testKey)
+	ciphertext, err := os.ReadFile("testdata/ciphertext.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := plaintextData()
+
+	// a seekable source that can't report its own size
+	r := encrypt.NewReaderSize(struct{ io.ReadSeeker }{bytes.NewReader(ciphertext)}, key, int64(len(ciphertext)))
+	if n, err := r.Seek(-10, io.SeekEnd); n != int64(len(plaintext)-10) || err != nil {
+		t.Fatalf("expected %d/nil; got %d/%v", len(plaintext)-10, n, err)
+	}
+	tail, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tail, plaintext[len(plaintext)-10:]) {
+		t.Errorf("plaintext after seek does not match")
+	}
+
+	// a stream that can't seek at all
+	r = encrypt.NewReaderSize(io.MultiReader(bytes.NewReader(ciphertext)), key, int64(len(ciphertext)))
+	if n, err := r.Seek(0, io.SeekEnd); n != int64(len(plaintext)) || err != nil {
+		t.Errorf("expected %d/nil; got %d/%v", len(plaintext), n, err)
+	}
+	if n, err := r.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("expected 0/EOF; got %d/%v", n, err)
+	}
+}
+
+func TestReader_Seek_discard(t *testing.T) {
+	key, _ := encrypt.DecodeBase64Key(testKey)
+	ciphertext, _ := os.ReadFile("testdata/ciphertext.txt")
+	plaintext := plaintextData()
+	tt := []struct {
+		name   string
+		offset int64
+		whence int
+	}{
+		{"start", 0, io.SeekStart},
+		{"within first chunk", 100, io.SeekStart},
+		{"across chunks", chunkSize + 100, io.SeekCurrent},
+		{"past the end", int64(len(plaintext)) + 100, io.SeekStart},
+	}
+	for _, td := range tt {
+		t.Run(td.name, func(t *testing.T) {
+			r := encrypt.NewReader(io.MultiReader(bytes.NewReader(ciphertext)), key)
+			n, err := r.Seek(td.offset, td.whence)
+			if err != nil || n != td.offset {
+				t.Fatalf("expected %d/nil; got %d/%v", td.offset, n, err)
+			}
+			rest, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []byte
+			if td.offset < int64(len(plaintext)) {
+				want = plaintext[td.offset:]
+			}
+			if !bytes.Equal(rest, want) {
+				t.Errorf("plaintext after seek does not match")
+			}
+		})
+	}
+}
+
+func TestSizer(t *testing.T) {
+	key, _ := encrypt.DecodeBase64Key(testKey)
+	ciphertext, _ := os.ReadFile("testdata/ciphertext.txt")
+	plaintext := plaintextData()
+	var src encrypt.Sizer = sizedReadSeeker{bytes.NewReader(ciphertext)}
+	r := encrypt.NewReader(src.(io.Reader), key)
+	if n, err := r.Seek(-10, io.SeekEnd); n != int64(len(plaintext)-10) || err != nil {
+		t.Fatalf("expected %d/nil; got %d/%v", len(plaintext)-10, n, err)
+	}
+}
+
+// sizedReadSeeker exposes only the methods needed for io.SeekEnd support
+type sizedReadSeeker struct {
+	r *bytes.Reader
+}
+
+func (rs sizedReadSeeker) Read(p []byte) (int, error)              { return rs.r.Read(p) }
+func (rs sizedReadSeeker) Seek(n int64, whence int) (int64, error) { return rs.r.Seek(n, whence) }
+func (rs sizedReadSeeker) Size() int64                             { return rs.r.Size() }
+
+func TestReader_Seek_exactSectorMultiple(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	for chunks := 1; chunks <= 3; chunks++ {
+		plaintext := make([]byte, chunks*chunkSize)
+		for i := range plaintext {
+			plaintext[i] = byte(i)
+		}
+		for _, withHeader := range []bool{false, true} {
+			buf := &bytes.Buffer{}
+			w := encrypt.NewWriter(buf, key)
+			if withHeader {
+				w.SetMetadata(nil)
+			}
+			w.Write(plaintext)
+			w.Close()
+			if !withHeader && buf.Len()%(chunkSize+encrypt.Overhead) != 0 {
+				t.Fatalf("expected ciphertext size to be an exact multiple of the sector size; got %d", buf.Len())
+			}
+
+			for _, offset := range []int64{0, -1, -chunkSize, -chunkSize - 1, 5} {
+				expected := bytes.NewReader(plaintext)
+				r := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+				n1, err1 := expected.Seek(offset, io.SeekEnd)
+				n2, err := r.Seek(offset, io.SeekEnd)
+				if err1 != nil {
+					if err == nil {
+						t.Errorf("%d chunks, header %v, seek(%d): expected an error", chunks, withHeader, offset)
+					}
+					continue
+				}
+				if n1 != n2 || err != nil {
+					t.Errorf("%d chunks, header %v, seek(%d): expected %d/nil; got %d/%v", chunks, withHeader, offset, n1, n2, err)
+					continue
+				}
+				want, _ := io.ReadAll(expected)
+				got, err := io.ReadAll(r)
+				if err != nil {
+					t.Errorf("%d chunks, header %v, seek(%d): %v", chunks, withHeader, offset, err)
+				}
+				if !bytes.Equal(want, got) {
+					t.Errorf("%d chunks, header %v, seek(%d): plaintext does not match", chunks, withHeader, offset)
+				}
+			}
+		}
+	}
+}
+
+func TestReader_Seek_invalidSize(t *testing.T) {
+	key, _ := encrypt.DecodeBase64Key(testKey)
+	ciphertext, _ := os.ReadFile("testdata/ciphertext.txt")
+	// leave a final sector that is too short to hold any plaintext
+	ciphertext = ciphertext[:2*(chunkSize+encrypt.Overhead)+encrypt.Overhead]
+	r := encrypt.NewReader(bytes.NewReader(ciphertext), key)
+	if _, err := r.Seek(0, io.SeekEnd); err == nil {
+		t.Errorf("expected an error for an invalid ciphertext size")
+	}
+}
+
 type noSizeReadSeeker struct{}
 
 func (rs noSizeReadSeeker) Read([]byte) (int, error) {
@@ -254,30 +457,82 @@ func FuzzReader_Seek(f *testing.F) {
 			t.Error(err)
 		}
 		defer ct.Close()
-		decrypter := encrypt.NewReader(ct, key)
-		pt1 := make([]byte, readSize)
-		pt2 := make([]byte, readSize)
-		n1, err1 := file.Seek(seekOffset, whence)
-		n2, err2 := decrypter.Seek(seekOffset, whence)
-		if whence >= io.SeekStart && whence <= io.SeekEnd {
-			if err1 == nil && err2 != nil || err1 != nil && err2 == nil {
-				t.Errorf("seek: expected errors to match; got %q and %q", err1, err2)
-			}
+		compareSeek(t, file, encrypt.NewReader(ct, key), seekOffset, whence, readSize)
+	})
+}
+
+// FuzzReader_Seek_fullChunks compares seeking in streams whose final chunk is full,
+// so that the ciphertext size is an exact multiple of SectorSize, against os.File.
+func FuzzReader_Seek_fullChunks(f *testing.F) {
+	key, _ := encrypt.NewKey()
+	dir := f.TempDir()
+	const maxChunks = 3
+	for chunks := 0; chunks <= maxChunks; chunks++ {
+		plaintext := make([]byte, chunks*chunkSize)
+		for i := range plaintext {
+			plaintext[i] = byte(i * 7)
 		}
-		if n1 != n2 {
-			t.Errorf("seek: expected n1 to match n2; got %v/%q and %v/%q", n1, err1, n2, err2)
+		buf := &bytes.Buffer{}
+		w := encrypt.NewWriter(buf, key)
+		w.Write(plaintext)
+		w.Close()
+		if buf.Len() != chunks*encrypt.SectorSize {
+			f.Fatalf("expected %d chunks to fill %d bytes; got %d", chunks, chunks*encrypt.SectorSize, buf.Len())
 		}
-		_, err1 = io.ReadFull(file, pt1)
-		_, err2 = io.ReadFull(decrypter, pt2)
-		if err1 == nil && err2 != nil || err1 != nil && err2 == nil {
-			t.Errorf("readfull: expected errors to match; got %q and %q", err1, err2)
+		os.WriteFile(filepath.Join(dir, fmt.Sprintf("%d.txt", chunks)), plaintext, 0o600)
+		os.WriteFile(filepath.Join(dir, fmt.Sprintf("%d.enc", chunks)), buf.Bytes(), 0o600)
+	}
+	f.Add(uint8(1), int64(0), io.SeekEnd, uint(10))
+	f.Add(uint8(2), int64(-1), io.SeekEnd, uint(10))
+	f.Add(uint8(2), int64(-chunkSize), io.SeekEnd, uint(10))
+	f.Add(uint8(3), int64(-chunkSize-1), io.SeekEnd, uint(chunkSize))
+	f.Add(uint8(3), int64(10), io.SeekEnd, uint(10))
+	f.Add(uint8(0), int64(0), io.SeekEnd, uint(10))
+	f.Add(uint8(2), int64(chunkSize), io.SeekStart, uint(10))
+	f.Fuzz(func(t *testing.T, chunks uint8, seekOffset int64, whence int, readSize uint) {
+		chunks %= maxChunks + 1
+		// os.File treats other whence values as platform-specific extensions
+		whence = int(uint(whence) % 3)
+		readSize %= 4 * chunkSize
+		file, err := os.Open(filepath.Join(dir, fmt.Sprintf("%d.txt", chunks)))
+		if err != nil {
+			t.Fatal(err)
 		}
-		if !bytes.Equal(pt1, pt2) {
-			t.Errorf("plaintext did not match: %q and %q", string(pt1), string(pt2))
+		defer file.Close()
+		ct, err := os.Open(filepath.Join(dir, fmt.Sprintf("%d.enc", chunks)))
+		if err != nil {
+			t.Fatal(err)
 		}
+		defer ct.Close()
+		compareSeek(t, file, encrypt.NewReader(ct, key), seekOffset, whence, readSize)
 	})
 }
 
+// compareSeek seeks both file and decrypter, then reads readSize bytes from each,
+// and reports any difference in their results.
+func compareSeek(t *testing.T, file *os.File, decrypter *encrypt.Reader, seekOffset int64, whence int, readSize uint) {
+	pt1 := make([]byte, readSize)
+	pt2 := make([]byte, readSize)
+	n1, err1 := file.Seek(seekOffset, whence)
+	n2, err2 := decrypter.Seek(seekOffset, whence)
+	if whence >= io.SeekStart && whence <= io.SeekEnd {
+		if err1 == nil && err2 != nil || err1 != nil && err2 == nil {
+			t.Errorf("seek: expected errors to match; got %q and %q", err1, err2)
+		}
+	}
+	if n1 != n2 {
+		t.Errorf("seek: expected n1 to match n2; got %v/%q and %v/%q", n1, err1, n2, err2)
+	}
+	_, err1 = io.ReadFull(file, pt1)
+	_, err2 = io.ReadFull(decrypter, pt2)
+	if err1 == nil && err2 != nil || err1 != nil && err2 == nil {
+		t.Errorf("readfull: expected errors to match; got %q and %q", err1, err2)
+	}
+	if !bytes.Equal(pt1, pt2) {
+		t.Errorf("plaintext did not match: %q and %q", string(pt1), string(pt2))
+	}
+}
+
 func FuzzEncryptDecrypt(f *testing.F) {
 	key, _ := encrypt.NewKey()
 	f.Fuzz(func(t *testing.T, plaintext []byte) {
@@ -335,3 +590,990 @@ func plaintextData() []byte {
 	}
 	return data
 }
+
+func TestKey_Bytes(t *testing.T) {
+	key, _ := encrypt.DecodeBase64Key(testKey)
+	b := key.Bytes()
+	if !bytes.Equal(b, key[:]) {
+		t.Fatalf("expected bytes to match key")
+	}
+	b[0] ^= 0xff
+	if b[0] == key[0] {
+		t.Errorf("modifying the returned slice should not modify the key")
+	}
+}
+
+func TestKey_Derive(t *testing.T) {
+	key, _ := encrypt.DecodeBase64Key(testKey)
+	a := key.Derive([]byte("file-contents"))
+	b := key.Derive([]byte("file-names"))
+	if a == b {
+		t.Errorf("expected distinct info values to derive distinct keys")
+	}
+	if a == key || b == key {
+		t.Errorf("expected derived keys to differ from the master key")
+	}
+	if a != key.Derive([]byte("file-contents")) {
+		t.Errorf("expected derivation to be deterministic")
+	}
+	// RFC 5869 HKDF-Expand, computed independently for this key and info
+	if got, want := a.String(), "mOIIrolETUGTq354WJNX9E9cj4bwrl9LzLI+fYI9H9U="; got != want {
+		t.Errorf("expected derived key %s; got %s", want, got)
+	}
+}
+
+func TestReader_Read_largeBuffer(t *testing.T) {
+	key, _ := encrypt.DecodeBase64Key(testKey)
+	ciphertext, err := os.ReadFile("testdata/ciphertext.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := encrypt.NewReader(bytes.NewReader(ciphertext), key)
+	var decrypted []byte
+	buf := make([]byte, chunkSize+1)
+	for {
+		n, err := r.Read(buf)
+		decrypted = append(decrypted, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(decrypted, plaintextData()) {
+		t.Errorf("plaintext does not match")
+	}
+}
+
+func BenchmarkReader_Read(b *testing.B) {
+	key, _ := encrypt.NewKey()
+	plaintext := make([]byte, 16*chunkSize)
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.Write(plaintext)
+	w.Close()
+	ciphertext := buf.Bytes()
+
+	for _, size := range []int{32 * 1024, chunkSize} {
+		b.Run(fmt.Sprintf("buffer=%d", size), func(b *testing.B) {
+			p := make([]byte, size)
+			b.SetBytes(int64(len(plaintext)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				r := encrypt.NewReader(bytes.NewReader(ciphertext), key)
+				for {
+					if _, err := r.Read(p); err == io.EOF {
+						break
+					} else if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkWriter_Write(b *testing.B) {
+	key, _ := encrypt.NewKey()
+	plaintext := make([]byte, 16*chunkSize)
+	for _, size := range []int{32 * 1024, chunkSize} {
+		b.Run(fmt.Sprintf("buffer=%d", size), func(b *testing.B) {
+			b.SetBytes(int64(len(plaintext)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				w := encrypt.NewWriter(io.Discard, key)
+				for p := plaintext; len(p) > 0; {
+					n := size
+					if n > len(p) {
+						n = len(p)
+					}
+					if _, err := w.Write(p[:n]); err != nil {
+						b.Fatal(err)
+					}
+					p = p[n:]
+				}
+				if err := w.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkWriter_Write_header measures streams with a header, whose chunks are written as records.
+func BenchmarkWriter_Write_header(b *testing.B) {
+	key, _ := encrypt.NewKey()
+	plaintext := make([]byte, 16*chunkSize)
+	b.SetBytes(int64(len(plaintext)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		w := encrypt.NewWriter(io.Discard, key)
+		if err := w.SetMetadata(map[string]string{"name": "file.txt"}); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := w.Write(plaintext); err != nil {
+			b.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestSectorCount(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3 * chunkSize} {
+		buf := &bytes.Buffer{}
+		w := encrypt.NewWriter(buf, key)
+		w.Write(make([]byte, size))
+		w.Close()
+		want := int64((size + chunkSize - 1) / chunkSize)
+		if got := encrypt.SectorCount(int64(buf.Len())); got != want {
+			t.Errorf("size %d: expected %d sectors; got %d", size, want, got)
+		}
+		if got, err := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key).SectorCount(); got != want || err != nil {
+			t.Errorf("size %d: expected %d/nil; got %d/%v", size, want, got, err)
+		}
+
+		buf.Reset()
+		w = encrypt.NewWriter(buf, key)
+		w.SetMetadata(map[string]string{"name": "data.bin"})
+		w.Write(make([]byte, size))
+		w.Close()
+		if got, err := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key).SectorCount(); got != want || err != nil {
+			t.Errorf("size %d with header: expected %d/nil; got %d/%v", size, want, got, err)
+		}
+	}
+
+	if _, err := encrypt.NewReader(&bytes.Buffer{}, key).SectorCount(); err == nil {
+		t.Errorf("expected an error when the size of the source is unknown")
+	}
+}
+
+func TestReader_Remaining(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	size := int64(2*chunkSize + 100)
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.Write(make([]byte, size))
+	w.Close()
+
+	r := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+	for _, offset := range []int64{0, 1, chunkSize, size - 1, size, size + 10} {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		want := size - offset
+		if want < 0 {
+			want = 0
+		}
+		if got, err := r.Remaining(); got != want || err != nil {
+			t.Errorf("offset %d: expected %d/nil; got %d/%v", offset, want, got, err)
+		}
+	}
+
+	// reading moves the offset too
+	r.Seek(0, io.SeekStart)
+	io.ReadFull(r, make([]byte, 10))
+	if got, err := r.Remaining(); got != size-10 || err != nil {
+		t.Errorf("expected %d/nil after reading; got %d/%v", size-10, got, err)
+	}
+
+	section := encrypt.NewSection(bytes.NewReader(buf.Bytes()), int64(buf.Len()), key, 100, 1000)
+	section.Seek(10, io.SeekStart)
+	if got, err := section.Remaining(); got != 990 || err != nil {
+		t.Errorf("expected 990/nil for a section; got %d/%v", got, err)
+	}
+
+	if _, err := encrypt.NewReader(&bytes.Buffer{}, key).Remaining(); err == nil {
+		t.Errorf("expected an error when the size of the source is unknown")
+	}
+}
+
+func TestWriter_pipeClosedEarly(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	pr, pw := io.Pipe()
+	aborted := errors.New("upload aborted")
+	go func() {
+		// read part of the first sector, then give up
+		io.ReadFull(pr, make([]byte, 1000))
+		pr.CloseWithError(aborted)
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		w := encrypt.NewWriter(pw, key)
+		var err error
+		for i := 0; i < 10 && err == nil; i++ {
+			_, err = w.Write(plaintextData())
+		}
+		if err == nil {
+			t.Errorf("expected Write to return an error after the reader closed")
+		}
+		if cerr := w.Close(); !errors.Is(cerr, aborted) {
+			t.Errorf("expected Close to return %v; got %v", aborted, cerr)
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, aborted) {
+			t.Errorf("expected %v; got %v", aborted, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("writer blocked after the reader closed the pipe")
+	}
+}
+
+func TestNewReaderLimit(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	headerless := &bytes.Buffer{}
+	w := encrypt.NewWriter(headerless, key)
+	w.Write(plaintext)
+	w.Close()
+	withHeader := &bytes.Buffer{}
+	w = encrypt.NewWriter(withHeader, key)
+	w.SetMetadata(nil)
+	w.Write(plaintext)
+	w.Close()
+
+	for _, ciphertext := range [][]byte{headerless.Bytes(), withHeader.Bytes()} {
+		for _, limit := range []int64{0, 1, chunkSize, chunkSize * 2, int64(len(plaintext)) - 1} {
+			r := encrypt.NewReaderLimit(bytes.NewReader(ciphertext), key, limit)
+			got, err := io.ReadAll(r)
+			if !errors.Is(err, encrypt.ErrLimitExceeded) {
+				t.Errorf("limit %d: expected ErrLimitExceeded; got %v", limit, err)
+			}
+			if !bytes.Equal(got, plaintext[:limit]) {
+				t.Errorf("limit %d: expected the first %d bytes of plaintext; got %d", limit, limit, len(got))
+			}
+		}
+		for _, limit := range []int64{int64(len(plaintext)), int64(len(plaintext)) + 1} {
+			got, err := io.ReadAll(encrypt.NewReaderLimit(bytes.NewReader(ciphertext), key, limit))
+			if err != nil {
+				t.Errorf("limit %d: %v", limit, err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("limit %d: plaintext does not match", limit)
+			}
+		}
+	}
+}
+
+// shortWriter violates the io.Writer contract by reporting short writes without an error.
+type shortWriter struct{}
+
+func (shortWriter) Write(p []byte) (int, error) { return len(p) / 2, nil }
+
+func TestWriter_shortWrite(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	w := encrypt.NewWriter(shortWriter{}, key)
+	w.Write([]byte("Hello, world!"))
+	err := w.Close()
+	if !errors.Is(err, io.ErrShortWrite) {
+		t.Errorf("expected io.ErrShortWrite; got %v", err)
+	}
+	if expected := "encrypt: wrote 20 of 41 bytes: short write"; err == nil || err.Error() != expected {
+		t.Errorf("expected %q; got %v", expected, err)
+	}
+}
+
+func TestSectorSize(t *testing.T) {
+	if encrypt.ChunkSize != chunkSize {
+		t.Errorf("expected ChunkSize %d; got %d", chunkSize, encrypt.ChunkSize)
+	}
+	key, _ := encrypt.NewKey()
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.Write(make([]byte, encrypt.ChunkSize*2))
+	w.Close()
+	if buf.Len() != encrypt.SectorSize*2 {
+		t.Errorf("expected two sectors of %d bytes; got %d bytes", encrypt.SectorSize, buf.Len())
+	}
+
+	// a range aligned to sector boundaries decrypts independently
+	sector := buf.Bytes()[encrypt.SectorSize:]
+	plaintext, err := io.ReadAll(encrypt.NewReader(bytes.NewReader(sector), key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plaintext) != encrypt.ChunkSize {
+		t.Errorf("expected %d bytes of plaintext; got %d", encrypt.ChunkSize, len(plaintext))
+	}
+}
+
+func TestReader_Seek_seekerSize(t *testing.T) {
+	key, _ := encrypt.DecodeBase64Key(testKey)
+	ciphertext, err := os.ReadFile("testdata/ciphertext.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := plaintextData()
+
+	// the source implements neither Sizer nor Stat, so its size is found by seeking
+	r := encrypt.NewReader(struct{ io.ReadSeeker }{bytes.NewReader(ciphertext)}, key)
+	head := make([]byte, 10)
+	if _, err := io.ReadFull(r, head); err != nil {
+		t.Fatal(err)
+	}
+	// finding the size leaves the position of the source unchanged
+	if n, err := r.Remaining(); n != int64(len(plaintext)-10) || err != nil {
+		t.Errorf("expected %d/nil; got %d/%v", len(plaintext)-10, n, err)
+	}
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(append(head, rest...), plaintext) {
+		t.Errorf("plaintext does not match after finding the size")
+	}
+
+	if n, err := r.Seek(-10, io.SeekEnd); n != int64(len(plaintext)-10) || err != nil {
+		t.Fatalf("expected %d/nil; got %d/%v", len(plaintext)-10, n, err)
+	}
+	tail, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tail, plaintext[len(plaintext)-10:]) {
+		t.Errorf("plaintext after seek does not match")
+	}
+}
+
+func TestReader_SetSize(t *testing.T) {
+	key, _ := encrypt.DecodeBase64Key(testKey)
+	ciphertext, err := os.ReadFile("testdata/ciphertext.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := plaintextData()
+
+	r := encrypt.NewReader(struct{ io.Reader }{bytes.NewReader(ciphertext)}, key)
+	if _, err := r.Seek(-10, io.SeekEnd); err == nil {
+		t.Errorf("expected an error seeking relative to the end of a source with an unknown size")
+	}
+	r.SetSize(int64(len(ciphertext)))
+	if n, err := r.Seek(-10, io.SeekEnd); n != int64(len(plaintext)-10) || err != nil {
+		t.Fatalf("expected %d/nil; got %d/%v", len(plaintext)-10, n, err)
+	}
+	tail, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tail, plaintext[len(plaintext)-10:]) {
+		t.Errorf("plaintext after seek does not match")
+	}
+}
+
+func TestReader_Seek_nearEOF(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	for _, size := range []int{chunkSize * 2, chunkSize*2 + 100} {
+		plaintext := make([]byte, size)
+		for i := range plaintext {
+			plaintext[i] = byte(i)
+		}
+		for _, withHeader := range []bool{false, true} {
+			buf := &bytes.Buffer{}
+			w := encrypt.NewWriter(buf, key)
+			if withHeader {
+				w.SetMetadata(nil)
+			}
+			w.Write(plaintext)
+			w.Close()
+
+			for _, offset := range []int64{int64(size) - 1, int64(size), int64(size) + 10, int64(size) + chunkSize} {
+				expected := bytes.NewReader(plaintext)
+				r := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+				if _, err := io.ReadAll(r); err != nil {
+					t.Fatal(err)
+				}
+				// seeking after reaching EOF must allow reading again
+				expected.Seek(offset, io.SeekStart)
+				if n, err := r.Seek(offset, io.SeekStart); n != offset || err != nil {
+					t.Fatalf("size %d, header %t: expected %d/nil; got %d/%v", size, withHeader, offset, n, err)
+				}
+				want, _ := io.ReadAll(expected)
+				got, err := io.ReadAll(r)
+				if err != nil {
+					t.Errorf("size %d, header %t, seek(%d): %v", size, withHeader, offset, err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("size %d, header %t, seek(%d): expected %d bytes; got %d", size, withHeader, offset, len(want), len(got))
+				}
+				if n, err := r.Read(make([]byte, 10)); n != 0 || err != io.EOF {
+					t.Errorf("size %d, header %t, seek(%d): expected 0/EOF; got %d/%v", size, withHeader, offset, n, err)
+				}
+			}
+
+			r := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+			io.ReadAll(r)
+			r.Seek(0, io.SeekStart)
+			if all, err := io.ReadAll(r); err != nil || !bytes.Equal(all, plaintext) {
+				t.Errorf("size %d, header %t: expected to read the whole stream again after EOF; got %d bytes/%v", size, withHeader, len(all), err)
+			}
+		}
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	expected, _ := encrypt.DecodeBase64Key(testKey)
+	dir := t.TempDir()
+	rawFile := dir + "/raw.key"
+	os.WriteFile(rawFile, expected[:], 0600)
+	base64File := dir + "/base64.key"
+	os.WriteFile(base64File, []byte(testKey+"\n"), 0600)
+	shortFile := dir + "/short.key"
+	os.WriteFile(shortFile, []byte("c2hvcnQ=\n"), 0600)
+	t.Setenv("ENCRYPT_TEST_KEY", testKey)
+	t.Setenv("ENCRYPT_TEST_SHORT_KEY", "c2hvcnQ=")
+
+	for _, source := range []string{testKey, "env:ENCRYPT_TEST_KEY", "file:" + rawFile, "file:" + base64File} {
+		key, err := encrypt.LoadKey(source)
+		if err != nil {
+			t.Errorf("%s: %v", source, err)
+		}
+		if key != expected {
+			t.Errorf("%s: key does not match", source)
+		}
+	}
+	for _, source := range []string{"c2hvcnQ=", "env:ENCRYPT_TEST_SHORT_KEY", "file:" + shortFile} {
+		if _, err := encrypt.LoadKey(source); !errors.Is(err, encrypt.ErrInvalidKeyLength) {
+			t.Errorf("%s: expected ErrInvalidKeyLength; got %v", source, err)
+		}
+	}
+	for _, source := range []string{"env:ENCRYPT_TEST_MISSING_KEY", "file:" + dir + "/missing.key"} {
+		if _, err := encrypt.LoadKey(source); err == nil {
+			t.Errorf("%s: expected an error", source)
+		}
+	}
+}
+
+func TestErrAuthFailed(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.Write(plaintext)
+	w.Close()
+	ciphertext := buf.Bytes()
+	// corrupt the middle chunk
+	ciphertext[encrypt.SectorSize+100] ^= 0xff
+	withHeader := &bytes.Buffer{}
+	w = encrypt.NewWriter(withHeader, key)
+	w.SetMetadata(nil)
+	w.Write(plaintext)
+	w.Close()
+	withHeader.Bytes()[withHeader.Len()-encrypt.SectorSize] ^= 0xff
+
+	tt := []struct {
+		name string
+		read func() error
+	}{{
+		name: "ReadAll",
+		read: func() error {
+			_, err := io.ReadAll(encrypt.NewReader(bytes.NewReader(ciphertext), key))
+			return err
+		},
+	}, {
+		name: "Read with a large buffer",
+		read: func() error {
+			r := encrypt.NewReader(bytes.NewReader(ciphertext), key)
+			p := make([]byte, len(plaintext))
+			for {
+				if _, err := r.Read(p); err != nil {
+					return err
+				}
+			}
+		},
+	}, {
+		name: "Copy to Writer",
+		read: func() error {
+			_, err := io.Copy(encrypt.NewWriter(io.Discard, key), encrypt.NewReader(bytes.NewReader(ciphertext), key))
+			return err
+		},
+	}, {
+		name: "Seek",
+		read: func() error {
+			r := encrypt.NewReader(bytes.NewReader(ciphertext), key)
+			r.Seek(chunkSize+1, io.SeekStart)
+			_, err := r.Read(make([]byte, 10))
+			return err
+		},
+	}, {
+		name: "OpenTo",
+		read: func() error {
+			_, err := encrypt.OpenTo(make([]byte, len(ciphertext)), ciphertext, key)
+			return err
+		},
+	}, {
+		name: "header",
+		read: func() error {
+			_, err := io.ReadAll(encrypt.NewReader(bytes.NewReader(withHeader.Bytes()), key))
+			return err
+		},
+	}, {
+		name: "wrong key",
+		read: func() error {
+			wrongKey, _ := encrypt.NewKey()
+			_, err := io.ReadAll(encrypt.NewReader(bytes.NewReader(withHeader.Bytes()), wrongKey))
+			return err
+		},
+	}}
+	for _, td := range tt {
+		t.Run(td.name, func(t *testing.T) {
+			if err := td.read(); !errors.Is(err, encrypt.ErrAuthFailed) {
+				t.Errorf("expected ErrAuthFailed; got %v", err)
+			}
+		})
+	}
+}
+
+func TestReader_splitStream(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	headerless := &bytes.Buffer{}
+	w := encrypt.NewWriter(headerless, key)
+	w.Write(plaintext)
+	w.Close()
+	withHeader := &bytes.Buffer{}
+	w = encrypt.NewWriter(withHeader, key)
+	w.SetMetadata(map[string]string{"name": "backup"})
+	w.Write(plaintext)
+	w.Close()
+
+	for name, ciphertext := range map[string][]byte{"headerless": headerless.Bytes(), "header": withHeader.Bytes()} {
+		// split points inside the header, on and around sector boundaries, and near the end
+		for _, splits := range [][]int{
+			{3},
+			{encrypt.SectorSize},
+			{encrypt.SectorSize - 1, encrypt.SectorSize + 1},
+			{1, 2, 100, 65536, 70000},
+			{len(ciphertext) - 17, len(ciphertext) - 1},
+		} {
+			var parts []io.Reader
+			last := 0
+			for _, split := range append(splits, len(ciphertext)) {
+				// each part returns short reads, like a file being read over a slow network
+				parts = append(parts, iotest.HalfReader(bytes.NewReader(ciphertext[last:split])))
+				last = split
+			}
+			decrypted, err := io.ReadAll(encrypt.NewReader(io.MultiReader(parts...), key))
+			if err != nil {
+				t.Fatalf("%s split at %v: %v", name, splits, err)
+			}
+			if !bytes.Equal(decrypted, plaintext) {
+				t.Errorf("%s split at %v: plaintext does not match", name, splits)
+			}
+		}
+	}
+}
+
+func TestReader_SeekSector(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	for _, withHeader := range []bool{false, true} {
+		buf := &bytes.Buffer{}
+		w := encrypt.NewWriter(buf, key)
+		if withHeader {
+			w.SetMetadata(nil)
+		}
+		w.Write(plaintext)
+		w.Close()
+
+		r := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+		for _, offset := range []int64{0, 100, chunkSize, chunkSize + 5, int64(len(plaintext)) - 1} {
+			actual, err := r.SeekSector(offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := offset / chunkSize * chunkSize; actual != expected {
+				t.Errorf("header %t, SeekSector(%d): expected offset %d; got %d", withHeader, offset, expected, actual)
+			}
+			if n, _ := r.Seek(0, io.SeekCurrent); n != actual {
+				t.Errorf("header %t, SeekSector(%d): expected the current offset to be %d; got %d", withHeader, offset, actual, n)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plaintext[actual:]) {
+				t.Errorf("header %t, SeekSector(%d): plaintext does not match", withHeader, offset)
+			}
+		}
+
+		// without an io.Seeker the Reader can only discard up to the requested offset
+		r = encrypt.NewReader(io.MultiReader(bytes.NewReader(buf.Bytes())), key)
+		if actual, err := r.SeekSector(chunkSize + 5); actual != chunkSize+5 || err != nil {
+			t.Errorf("header %t: expected %d/nil for a source that can't seek; got %d/%v", withHeader, chunkSize+5, actual, err)
+		}
+	}
+}
+
+func TestWriter_WriteAndClose(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	if err := w.WriteAndClose(plaintext); err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := io.ReadAll(encrypt.NewReader(buf, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("expected the final chunk to be flushed")
+	}
+	if _, err := w.Write([]byte("more")); err == nil {
+		t.Errorf("expected the writer to be closed")
+	}
+
+	w = encrypt.NewWriter(&badWriter{failAt: 1}, key)
+	if err := w.WriteAndClose(plaintext); err == nil || err.Error() != "failed write" {
+		t.Errorf("expected the write error; got %v", err)
+	}
+}
+
+func TestKey_IsZero(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	if key.IsZero() {
+		t.Errorf("expected a generated key not to be zero")
+	}
+	var zero encrypt.Key
+	if !zero.IsZero() {
+		t.Errorf("expected the zero value to be zero")
+	}
+
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, zero)
+	w.Write(make([]byte, chunkSize+1))
+	if err := w.Close(); !errors.Is(err, encrypt.ErrZeroKey) {
+		t.Errorf("expected ErrZeroKey; got %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing to be written with a zero key; got %d bytes", buf.Len())
+	}
+}
+
+func TestNewWriterE(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	buf := &bytes.Buffer{}
+	w, err := encrypt.NewWriterE(buf, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("Hello, world!"))
+	w.Close()
+	r, err := encrypt.NewReaderE(buf, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := io.ReadAll(r); err != nil || string(plaintext) != "Hello, world!" {
+		t.Errorf("expected the plaintext to round-trip; got %q/%v", plaintext, err)
+	}
+
+	if _, err := encrypt.NewWriterE(buf, encrypt.Key{}); !errors.Is(err, encrypt.ErrZeroKey) {
+		t.Errorf("expected ErrZeroKey from NewWriterE; got %v", err)
+	}
+	if _, err := encrypt.NewReaderE(buf, encrypt.Key{}); !errors.Is(err, encrypt.ErrZeroKey) {
+		t.Errorf("expected ErrZeroKey from NewReaderE; got %v", err)
+	}
+	if _, err := encrypt.NewWriterE(nil, key); err == nil {
+		t.Errorf("expected an error for a nil writer")
+	}
+	if _, err := encrypt.NewReaderE(nil, key); err == nil {
+		t.Errorf("expected an error for a nil reader")
+	}
+}
+
+func TestErrAEADUnavailable(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	ciphertext, err := encrypt.EncryptAll([]byte("Hello, world!"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restore := encrypt.SetNewGCM(func(cipher.Block, int) (cipher.AEAD, error) {
+		return nil, errors.New("crypto/cipher: use of GCM with arbitrary IVs is not allowed in FIPS 140-only mode")
+	})
+	defer restore()
+
+	if _, err := encrypt.NewWriterE(&bytes.Buffer{}, key); !errors.Is(err, encrypt.ErrAEADUnavailable) {
+		t.Errorf("expected ErrAEADUnavailable from NewWriterE; got %v", err)
+	}
+	if _, err := encrypt.NewReaderE(bytes.NewReader(ciphertext), key); !errors.Is(err, encrypt.ErrAEADUnavailable) {
+		t.Errorf("expected ErrAEADUnavailable from NewReaderE; got %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	if _, err := w.Write(make([]byte, chunkSize+1)); !errors.Is(err, encrypt.ErrAEADUnavailable) {
+		t.Errorf("expected ErrAEADUnavailable from Write; got %v", err)
+	}
+	if err := w.Close(); !errors.Is(err, encrypt.ErrAEADUnavailable) {
+		t.Errorf("expected ErrAEADUnavailable from Close; got %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing to be written; got %d bytes", buf.Len())
+	}
+
+	r := encrypt.NewReader(bytes.NewReader(ciphertext), key)
+	for i := 0; i < 2; i++ {
+		if _, err := r.Read(make([]byte, 10)); !errors.Is(err, encrypt.ErrAEADUnavailable) {
+			t.Errorf("read %d: expected ErrAEADUnavailable; got %v", i, err)
+		}
+	}
+}
+
+func TestSectorStart(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	headerless := &bytes.Buffer{}
+	w := encrypt.NewWriter(headerless, key)
+	w.Write(plaintext)
+	w.Close()
+	withHeader := &bytes.Buffer{}
+	w = encrypt.NewWriter(withHeader, key)
+	w.SetChunkSize(4096)
+	w.Write(plaintext)
+	w.Close()
+	h, _, _ := encrypt.ReadHeader(bytes.NewReader(withHeader.Bytes()))
+
+	for _, offset := range []int64{0, 100, 4096, chunkSize, chunkSize + 5, int64(len(plaintext)) - 1} {
+		// decrypting from the computed position must start with the chunk holding offset
+		start := encrypt.SectorStart(offset)
+		r := encrypt.NewReader(bytes.NewReader(headerless.Bytes()[start:]), key)
+		chunk := make([]byte, 10)
+		if _, err := io.ReadFull(r, chunk); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatal(err)
+		}
+		if chunkStart := offset / chunkSize * chunkSize; !bytes.HasPrefix(plaintext[chunkStart:], chunk) {
+			t.Errorf("SectorStart(%d): expected the sector at %d to begin at plaintext offset %d", offset, start, chunkStart)
+		}
+
+		start = h.Size + encrypt.SectorStartSize(offset, h.ChunkSize)
+		if kind := withHeader.Bytes()[start]; kind != 'D' {
+			t.Errorf("SectorStartSize(%d, %d): expected a data record at %d; got %q", offset, h.ChunkSize, start, kind)
+		}
+	}
+}
+
+func TestWriter_BytesWritten(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	for _, size := range []int{0, 1, encrypt.ChunkSize, encrypt.ChunkSize*2 + 10} {
+		for _, md := range []map[string]string{nil, {"name": "file.txt"}} {
+			buf := &bytes.Buffer{}
+			w := encrypt.NewWriter(buf, key)
+			if md != nil {
+				if err := w.SetMetadata(md); err != nil {
+					t.Fatal(err)
+				}
+			}
+			w.Write(make([]byte, size))
+			if w.BytesWritten() != int64(buf.Len()) {
+				t.Errorf("size %d: expected %d bytes before Close; got %d", size, buf.Len(), w.BytesWritten())
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if w.BytesWritten() != int64(buf.Len()) {
+				t.Errorf("size %d: expected %d bytes after Close; got %d", size, buf.Len(), w.BytesWritten())
+			}
+		}
+	}
+}
+
+func TestReader_AtEOF(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := make([]byte, encrypt.ChunkSize+10)
+	for _, md := range []map[string]string{nil, {"name": "file.txt"}} {
+		buf := &bytes.Buffer{}
+		w := encrypt.NewWriter(buf, key)
+		if md != nil {
+			w.SetMetadata(md)
+		}
+		w.Write(plaintext)
+		w.Close()
+
+		r := encrypt.NewReader(buf, key)
+		if r.AtEOF() {
+			t.Errorf("expected AtEOF to be false before reading")
+		}
+		if _, err := io.ReadFull(r, make([]byte, len(plaintext)-1)); err != nil {
+			t.Fatal(err)
+		}
+		if r.AtEOF() {
+			t.Errorf("expected AtEOF to be false with plaintext remaining")
+		}
+		if _, err := io.ReadFull(r, make([]byte, 1)); err != nil {
+			t.Fatal(err)
+		}
+		if md == nil && !r.AtEOF() {
+			// the final sector is short, which reveals the end of a headerless stream
+			t.Errorf("expected AtEOF after reading a short final sector")
+		}
+		if n, err := r.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+			t.Fatalf("expected 0/EOF; got %d/%v", n, err)
+		}
+		if !r.AtEOF() {
+			t.Errorf("expected AtEOF after Read returned io.EOF")
+		}
+	}
+}
+
+func TestErrNonceLimitReached(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	// a resumed Writer counts the chunks sealed by the earlier Writer
+	w := encrypt.NewResumeWriter(io.Discard, key, 1<<32-1)
+	if _, err := w.Write(make([]byte, encrypt.ChunkSize)); err != nil {
+		t.Fatalf("expected the last chunk below the limit to succeed; got %v", err)
+	}
+	if _, err := w.Write(make([]byte, encrypt.ChunkSize)); !errors.Is(err, encrypt.ErrNonceLimitReached) {
+		t.Errorf("expected ErrNonceLimitReached; got %v", err)
+	}
+	if err := w.Close(); !errors.Is(err, encrypt.ErrNonceLimitReached) {
+		t.Errorf("expected Close to return the same error; got %v", err)
+	}
+}
+
+func TestReader_bufio(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	for _, size := range []int{0, 1, encrypt.ChunkSize, encrypt.ChunkSize*2 + 10} {
+		plaintext := make([]byte, size)
+		for i := range plaintext {
+			plaintext[i] = byte(i)
+		}
+		buf := &bytes.Buffer{}
+		w := encrypt.NewWriter(buf, key)
+		w.Write(plaintext)
+		w.Close()
+
+		// a buffer large enough for a sector is read without copying; a small one falls back to io.ReadFull
+		for _, bufSize := range []int{encrypt.SectorSize, 4096} {
+			src := bufio.NewReaderSize(bytes.NewReader(buf.Bytes()), bufSize)
+			got, err := io.ReadAll(encrypt.NewReader(src, key))
+			if err != nil || !bytes.Equal(got, plaintext) {
+				t.Errorf("size %d, buffer %d: decrypted stream doesn't match: %v", size, bufSize, err)
+			}
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.Write(make([]byte, encrypt.ChunkSize*2))
+	w.Close()
+	tampered := buf.Bytes()
+	tampered[encrypt.SectorSize+100] ^= 1
+	src := bufio.NewReaderSize(bytes.NewReader(tampered), encrypt.SectorSize)
+	if _, err := io.ReadAll(encrypt.NewReader(src, key)); !errors.Is(err, encrypt.ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed; got %v", err)
+	}
+}
+
+func TestKey_NameFor(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	other, _ := encrypt.NewKey()
+	a := sha256.Sum256([]byte("a"))
+	b := sha256.Sum256([]byte("b"))
+	name := key.NameFor(a[:])
+	if len(name) != 64 || strings.Trim(name, "0123456789abcdef") != "" {
+		t.Errorf("expected 64 lowercase hex characters; got %q", name)
+	}
+	if key.NameFor(a[:]) != name {
+		t.Errorf("expected the same name for the same digest")
+	}
+	if key.NameFor(b[:]) == name {
+		t.Errorf("expected a different name for a different digest")
+	}
+	if other.NameFor(a[:]) == name {
+		t.Errorf("expected a different name for a different key")
+	}
+	if name == hex.EncodeToString(a[:]) {
+		t.Errorf("expected the name to differ from the digest")
+	}
+}
+
+func TestWriter_OnChunk(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := make([]byte, encrypt.ChunkSize*2+10)
+	for _, md := range []map[string]string{nil, {"name": "file.txt"}} {
+		buf := &bytes.Buffer{}
+		w := encrypt.NewWriter(buf, key)
+		if md != nil {
+			w.SetMetadata(md)
+		}
+		var ranges [][2]int64
+		w.OnChunk(func(ctStart, ctEnd int64) {
+			ranges = append(ranges, [2]int64{ctStart, ctEnd})
+		})
+		w.Write(plaintext)
+		w.Close()
+
+		if len(ranges) != 3 {
+			t.Fatalf("expected 3 chunks; got %v", ranges)
+		}
+		for i, rng := range ranges {
+			if i > 0 && rng[0] != ranges[i-1][1] {
+				t.Errorf("expected chunk %d to start where the previous one ended; got %v", i, ranges)
+			}
+		}
+		if md == nil && (ranges[0][0] != 0 || ranges[2][1] != int64(buf.Len())) {
+			t.Errorf("expected the chunks to cover the whole stream; got %v for %d bytes", ranges, buf.Len())
+		}
+		if md != nil {
+			hdr, _, _ := encrypt.ReadHeader(bytes.NewReader(buf.Bytes()))
+			if ranges[0][0] != hdr.Size {
+				t.Errorf("expected the first chunk to start after the header at %d; got %d", hdr.Size, ranges[0][0])
+			}
+		}
+	}
+}
+
+// stallingReader returns (0, nil) on every other call, as some network wrappers do,
+// and otherwise reads at most max bytes.
+type stallingReader struct {
+	r     io.Reader
+	max   int
+	calls int
+}
+
+func (s *stallingReader) Read(p []byte) (int, error) {
+	s.calls++
+	if s.calls%2 == 1 {
+		return 0, nil
+	}
+	if len(p) > s.max {
+		p = p[:s.max]
+	}
+	return s.r.Read(p)
+}
+
+func TestReader_stallingSource(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := make([]byte, encrypt.ChunkSize*2+10)
+	for i := range plaintext {
+		plaintext[i] = byte(i)
+	}
+	for _, md := range []map[string]string{nil, {"name": "file.txt"}} {
+		buf := &bytes.Buffer{}
+		w := encrypt.NewWriter(buf, key)
+		if md != nil {
+			w.SetMetadata(md)
+		}
+		w.Write(plaintext)
+		w.Close()
+		size := buf.Len()
+
+		src := &stallingReader{r: buf, max: 100}
+		got, err := io.ReadAll(encrypt.NewReader(src, key))
+		if err != nil || !bytes.Equal(got, plaintext) {
+			t.Errorf("decrypted stream doesn't match: %v", err)
+		}
+		// each stall costs one extra call, and each sector or record may end with one short read and one that reports EOF
+		if limit := 2*(size/100) + 20; src.calls > limit {
+			t.Errorf("expected at most %d reads of the source; got %d", limit, src.calls)
+		}
+	}
+}
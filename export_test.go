@@ -0,0 +1,21 @@
+package encrypt
+
+import "crypto/cipher"
+
+// SealVector exposes sealVector to the tests in package encrypt_test.
+var SealVector = sealVector
+
+// SetNewGCM replaces the function that creates AES-GCM until the returned function is called.
+func SetNewGCM(f func(cipher.Block, int) (cipher.AEAD, error)) (restore func()) {
+	saved := newGCMWithNonceSize
+	newGCMWithNonceSize = f
+	return func() { newGCMWithNonceSize = saved }
+}
+
+// Polyval returns the POLYVAL hash of x with the key h, for the tests in package encrypt_test.
+func Polyval(h, x []byte) []byte {
+	p := newPolyval(h)
+	p.update(x)
+	s := p.sum()
+	return s[:]
+}
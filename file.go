@@ -0,0 +1,125 @@
+package encrypt
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// OpenFile opens the named file for decryption with key.
+// The returned ReadSeekCloser supports all values of whence for Seek,
+// so it may be passed to functions such as http.ServeContent.
+// Closing it closes the underlying file.
+func OpenFile(path string, key Key) (io.ReadSeekCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &file{Reader: NewReader(f, key), f: f}, nil
+}
+
+type file struct {
+	*Reader
+	f *os.File
+}
+
+func (f *file) Close() error {
+	return f.f.Close()
+}
+
+// EncryptFile encrypts all of src with key, writes the result to dst, and closes dst,
+// such as when encrypting a file opened with os.Create.
+// The data is copied with io.Copy, which uses src.WriteTo or dst.ReadFrom when they are available.
+//
+// The errors from the copy, from closing the Writer, and from closing dst are all checked,
+// and the first of them is returned.
+// In particular a failure to close dst is reported rather than ignored as by a deferred Close,
+// since for files it may be the only indication that the final data was not saved.
+// dst is closed even when an earlier step fails.
+func EncryptFile(dst io.WriteCloser, src io.Reader, key Key) error {
+	w := NewWriter(dst, key)
+	_, err := io.Copy(w, src)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// EncryptFileInPlace encrypts the named file with key, replacing its contents with the ciphertext.
+// The ciphertext is written to a temporary file in the same directory,
+// which is synced and then renamed over the original,
+// so that after a crash the file holds either its original contents or the complete ciphertext.
+// On error the original is left untouched and the temporary file is removed.
+// The mode of the original, including its setuid, setgid, and sticky bits, is kept
+// and, where the platform allows it, so is its ownership.
+func EncryptFileInPlace(path string, key Key) error {
+	return replaceFile(path, func(dst io.Writer, src io.Reader) error {
+		w := NewWriter(dst, key)
+		if _, err := io.Copy(w, src); err != nil {
+			return err
+		}
+		return w.Close()
+	})
+}
+
+// DecryptFileInPlace decrypts the named file, which was encrypted with key,
+// replacing its contents with the plaintext in the same way as EncryptFileInPlace.
+// If any part of the file fails to authenticate, the original is left untouched.
+func DecryptFileInPlace(path string, key Key) error {
+	return replaceFile(path, func(dst io.Writer, src io.Reader) error {
+		_, err := io.Copy(dst, NewReader(src, key))
+		return err
+	})
+}
+
+// replaceFile writes the result of transform for the named file to a temporary file in the same directory,
+// then atomically renames it over the original.
+func replaceFile(path string, transform func(dst io.Writer, src io.Reader) error) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err = transform(tmp, src); err != nil {
+		return err
+	}
+	// keeping the owner requires privileges that the caller may not have
+	_ = chown(tmp, info)
+	// the mode is set after the owner, since changing the owner clears the setuid and setgid bits
+	if err = tmp.Chmod(info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	// syncing the directory makes the rename durable; not every platform supports it
+	if dir, derr := os.Open(filepath.Dir(path)); derr == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
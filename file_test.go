@@ -0,0 +1,145 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestOpenFile(t *testing.T) {
+	key, _ := encrypt.DecodeBase64Key(testKey)
+	plaintext := plaintextData()
+
+	f, err := encrypt.OpenFile("testdata/ciphertext.txt", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.Seek(-10, io.SeekEnd); n != int64(len(plaintext)-10) || err != nil {
+		t.Fatalf("expected %d/nil; got %d/%v", len(plaintext)-10, n, err)
+	}
+	tail, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tail, plaintext[len(plaintext)-10:]) {
+		t.Errorf("plaintext after seek does not match")
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err == nil {
+		t.Errorf("expected an error after the file was closed")
+	}
+
+	if _, err := encrypt.OpenFile("testdata/does-not-exist", key); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
+
+// closeFailer is a WriteCloser whose Close fails.
+type closeFailer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (w *closeFailer) Close() error {
+	w.closed = true
+	return errors.New("close failed")
+}
+
+func TestEncryptFile(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	path := filepath.Join(t.TempDir(), "plaintext.enc")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := encrypt.EncryptFile(f, bytes.NewReader(plaintext), key); err != nil {
+		t.Fatal(err)
+	}
+	r, err := encrypt.OpenFile(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	decrypted, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("plaintext does not match")
+	}
+
+	dst := &closeFailer{}
+	if err := encrypt.EncryptFile(dst, bytes.NewReader(plaintext), key); err == nil || err.Error() != "close failed" {
+		t.Errorf("expected the error from closing dst; got %v", err)
+	}
+	if dst.Len() == 0 {
+		t.Errorf("expected the data to be written before dst was closed")
+	}
+
+	dst = &closeFailer{}
+	if err := encrypt.EncryptFile(dst, iotest.ErrReader(errors.New("read failed")), key); err == nil || err.Error() != "read failed" {
+		t.Errorf("expected the error from reading src; got %v", err)
+	}
+	if !dst.closed {
+		t.Errorf("expected dst to be closed after a failed copy")
+	}
+}
+
+func TestEncryptFileInPlace(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	wrongKey, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(path, plaintext, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	// the platform may refuse some of the special bits, so the mode is compared with what was set
+	os.Chmod(path, 0o640|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := encrypt.EncryptFileInPlace(path, key); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode() != before.Mode() {
+		t.Errorf("expected the mode %v to be kept; got %v", before.Mode(), info.Mode())
+	}
+	ciphertext, _ := os.ReadFile(path)
+	if decrypted, err := encrypt.DecryptAll(bytes.NewReader(ciphertext), key); err != nil || !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("expected the file to hold the ciphertext; got %v", err)
+	}
+
+	// a failure leaves the original in place without a temporary file
+	if err := encrypt.DecryptFileInPlace(path, wrongKey); !errors.Is(err, encrypt.ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed; got %v", err)
+	}
+	if unchanged, _ := os.ReadFile(path); !bytes.Equal(unchanged, ciphertext) {
+		t.Errorf("expected the original to be untouched after a failure")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected the temporary file to be removed; got %d entries", len(entries))
+	}
+
+	if err := encrypt.DecryptFileInPlace(path, key); err != nil {
+		t.Fatal(err)
+	}
+	if decrypted, _ := os.ReadFile(path); !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("expected the file to hold the plaintext again")
+	}
+}
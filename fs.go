@@ -0,0 +1,69 @@
+package encrypt
+
+import (
+	"io/fs"
+)
+
+// FS returns a read-only file system that decrypts the files of base with key,
+// where each file was encrypted by a Writer using key.
+// Files opened from it implement io.Seeker, and Stat reports the size of the decrypted data,
+// so the result may be served with http.FileServer and http.FS.
+//
+// Directories are passed through unchanged,
+// so the sizes reported by their entries are those of the encrypted files.
+func FS(base fs.FS, key Key) fs.FS {
+	return &encryptedFS{base: base, key: key}
+}
+
+type encryptedFS struct {
+	base fs.FS
+	key  Key
+}
+
+func (fsys *encryptedFS) Open(name string) (fs.File, error) {
+	f, err := fsys.base.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if fi.IsDir() {
+		return f, nil
+	}
+	return &fsFile{Reader: NewReader(f, fsys.key), f: f}, nil
+}
+
+// fsFile is a decrypted fs.File.
+type fsFile struct {
+	*Reader
+	f fs.File
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) {
+	fi, err := f.f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size, err := f.Reader.plaintextSize()
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: fi.Name(), Err: err}
+	}
+	return fileInfo{FileInfo: fi, size: size}, nil
+}
+
+func (f *fsFile) Close() error {
+	return f.f.Close()
+}
+
+// fileInfo reports the size of the decrypted data in place of the size of the encrypted file.
+type fileInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (fi fileInfo) Size() int64 {
+	return fi.size
+}
@@ -0,0 +1,74 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestFS(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.Write(plaintext)
+	w.Close()
+	fsys := encrypt.FS(fstest.MapFS{"docs/data.txt": {Data: buf.Bytes()}}, key)
+
+	decrypted, err := fs.ReadFile(fsys, "docs/data.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("plaintext does not match")
+	}
+
+	f, err := fsys.Open("docs/data.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != int64(len(plaintext)) || fi.Name() != "data.txt" {
+		t.Errorf("expected data.txt with size %d; got %s with size %d", len(plaintext), fi.Name(), fi.Size())
+	}
+
+	entries, err := fs.ReadDir(fsys, "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "data.txt" {
+		t.Errorf("expected directory listings to pass through; got %v", entries)
+	}
+}
+
+func TestFS_http(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.Write(plaintext)
+	w.Close()
+	fsys := encrypt.FS(fstest.MapFS{"data.txt": {Data: buf.Bytes()}}, key)
+
+	req := httptest.NewRequest(http.MethodGet, "/data.txt", nil)
+	req.Header.Set("Range", "bytes=70000-70099")
+	rec := httptest.NewRecorder()
+	http.FileServer(http.FS(fsys)).ServeHTTP(rec, req)
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("expected status %d; got %d", http.StatusPartialContent, rec.Code)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	if !bytes.Equal(body, plaintext[70000:70100]) {
+		t.Errorf("range does not match the plaintext")
+	}
+}
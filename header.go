@@ -0,0 +1,669 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Streams may optionally begin with a header, which is identified by a magic string.
+// Headerless streams begin with a random nonce,
+// so the chance of one being mistaken for a header is negligible.
+//
+// A header takes the form magic|version|length|fields,
+// where length is the size of fields as a big-endian uint32
+// and each field is encoded as tag|length|value with a big-endian uint16 length.
+// Every header holds a random stream ID, which is authenticated along with the metadata,
+// so metadata can't be moved from one stream to another.
+//
+// Sectors following a header are framed as records of the form kind|length|nonce|ciphertext|tag,
+// and the record kind, the chunk index, and a SHA-256 hash of the whole header are authenticated as additional data,
+// which prevents the records from being reordered or removed,
+// moved between streams that share a key, or combined with a different or modified header.
+// The hash covers every byte of the header from the magic string to the end of the fields,
+// and the additional data of a record is kind|uint64 index|hash, as in testdata/vectors.json.
+// In a chained stream, the additional data of each data and end record
+// also includes a SHA-256 hash of the nonce, ciphertext, and tag of the record before it.
+// The final record of the stream holds the total plaintext length,
+// which allows a Reader to detect a truncated stream.
+// In a uniform stream, a final chunk shorter than the others is padded with zeroes
+// and written as a padded record, whose true length follows from the end record.
+const (
+	magic         = "\x89ENCRYPT"
+	headerVersion = 1
+
+	maxHeaderSize = 1 << 20
+
+	// nonces shorter than the standard size would increase the chance of a random collision
+	minNonceSize = nonceSize
+	maxNonceSize = 32
+
+	recordHeaderSize = 5
+	recordData       = 'D'
+	recordEnd        = 'E'
+	recordTOC        = 'T'
+	recordPadded     = 'P'
+)
+
+// header field tags
+const (
+	fieldMetadata    = 1
+	fieldChunkSize   = 2
+	fieldNonceSize   = 3
+	fieldCipher      = 4
+	fieldPadded      = 5
+	fieldFingerprint = 6
+	fieldKeyCheck    = 7
+	fieldTOC         = 8
+	fieldChain       = 9
+	fieldUniform     = 10
+	fieldTrailer     = 11
+	fieldKeySize     = 12
+	fieldChecksums   = 13
+	fieldStreamID    = 14
+	fieldVariable    = 15
+)
+
+// streamIDSize is the size of the random ID in the header of every stream.
+const streamIDSize = 16
+
+// ciphers that may be recorded in a header
+const (
+	cipherGCM    = 0
+	cipherGCMSIV = 1
+	cipherCustom = 0xff // cipherCustom is an AEAD provided to NewWriterAEAD, which the header doesn't identify
+)
+
+// metadataAD is the additional data used to seal the metadata header field,
+// which keeps it distinct from data sealed for any record.
+// The stream ID follows it, binding the metadata to its stream.
+var metadataAD = []byte("encrypt metadata")
+
+// keyCheckAD is the additional data used to seal the empty key check header field,
+// which allows a Reader to detect the wrong key before reading any records.
+var keyCheckAD = []byte("encrypt key check")
+
+// header holds the optional fields written at the start of a stream.
+type header struct {
+	metadata  map[string]string
+	chunkSize int // chunkSize is the size of the first chunk when it differs from the default
+	nonceLen  int // nonceLen is the size of each nonce when it differs from the default
+	keyLen    int // keyLen is the number of bytes of the key used by the cipher when it differs from the default
+	cipher    byte
+	padded    bool // padded is set when random padding follows the end record
+	toc       bool // toc is set when a table of contents follows the end record
+	chained   bool // chained is set when each record authenticates a hash of the record before it
+	uniform   bool // uniform is set when the final chunk is padded to the size of the others
+	trailer   bool // trailer is set when an HMAC of the whole stream follows the end record
+	checksums bool // checksums is set when a CRC-32C follows each record
+	variable  bool // variable is set when chunks before the final one may be short, such as after Writer.Flush
+
+	sealedMetadata []byte // sealedMetadata is the encrypted metadata field, before it is opened
+	keyCheck       []byte // keyCheck is an empty message sealed with the key of the stream
+	fingerprint    []byte // fingerprint identifies the key used to write the stream
+	id             []byte // id is the random stream ID
+	binding        []byte // binding is the SHA-256 hash of the encoded header, which every record authenticates
+}
+
+// nonceSize returns the size of the nonces used by the stream.
+// It may be called on a nil header.
+func (h *header) nonceSize() int {
+	if h == nil || h.nonceLen == 0 {
+		return nonceSize
+	}
+	return h.nonceLen
+}
+
+// keySize returns the number of bytes of the key used by the cipher of the stream.
+// It may be called on a nil header.
+func (h *header) keySize() int {
+	if h == nil || h.keyLen == 0 {
+		return len(Key{})
+	}
+	return h.keyLen
+}
+
+// newAEAD returns the AEAD used to encrypt the stream with key.
+// It may be called on a nil header.
+func (h *header) newAEAD(key Key) (cipher.AEAD, error) {
+	if h != nil && h.cipher == cipherGCMSIV {
+		return NewGCMSIV(key[:h.keySize()])
+	}
+	if h != nil && h.cipher == cipherCustom {
+		return nil, errors.New("encrypt: the stream was written with a custom AEAD, which requires NewReaderAEAD")
+	}
+	if h != nil && h.keyLen != 0 {
+		block, err := aes.NewCipher(key[:h.keyLen])
+		if err != nil {
+			return nil, keySizeError(err)
+		}
+		gcm, err := newGCMWithNonceSize(block, h.nonceSize())
+		if err != nil {
+			return nil, aeadError(err)
+		}
+		return gcm, nil
+	}
+	return newGCM(key, h.nonceSize())
+}
+
+// marshal encodes the header for a stream encrypted with key, including the magic string,
+// choosing a stream ID if it has none and recording the hash of the result as the binding of the stream's records.
+// Encrypted fields are sealed with aead.
+func (h *header) marshal(key Key, aead cipher.AEAD) ([]byte, error) {
+	if h.id == nil {
+		id, err := newStreamID()
+		if err != nil {
+			return nil, err
+		}
+		h.id = id
+	}
+	fields, _ := appendField(nil, fieldStreamID, h.id)
+	fields, _ = appendField(fields, fieldFingerprint, key.Fingerprint())
+	keyCheck, err := encrypt(aead, nil, keyCheckAD)
+	if err != nil {
+		return nil, err
+	}
+	fields, _ = appendField(fields, fieldKeyCheck, keyCheck)
+	if h.nonceLen != 0 {
+		fields, _ = appendField(fields, fieldNonceSize, []byte{byte(h.nonceLen)})
+	}
+	if h.cipher != cipherGCM {
+		fields, _ = appendField(fields, fieldCipher, []byte{h.cipher})
+	}
+	if h.keyLen != 0 {
+		fields, _ = appendField(fields, fieldKeySize, []byte{byte(h.keyLen)})
+	}
+	if h.padded {
+		fields, _ = appendField(fields, fieldPadded, nil)
+	}
+	if h.toc {
+		fields, _ = appendField(fields, fieldTOC, nil)
+	}
+	if h.chained {
+		fields, _ = appendField(fields, fieldChain, nil)
+	}
+	if h.uniform {
+		fields, _ = appendField(fields, fieldUniform, nil)
+	}
+	if h.trailer {
+		fields, _ = appendField(fields, fieldTrailer, nil)
+	}
+	if h.checksums {
+		fields, _ = appendField(fields, fieldChecksums, nil)
+	}
+	if h.variable {
+		fields, _ = appendField(fields, fieldVariable, nil)
+	}
+	if h.metadata != nil {
+		sealed, err := encrypt(aead, encodeMetadata(h.metadata), h.metadataAD())
+		if err != nil {
+			return nil, err
+		}
+		if fields, err = appendField(fields, fieldMetadata, sealed); err != nil {
+			return nil, err
+		}
+	}
+
+	if h.chunkSize != 0 {
+		v := make([]byte, 4)
+		binary.BigEndian.PutUint32(v, uint32(h.chunkSize))
+		fields, _ = appendField(fields, fieldChunkSize, v)
+	}
+
+	b := make([]byte, len(magic)+5, len(magic)+5+len(fields))
+	copy(b, magic)
+	b[len(magic)] = headerVersion
+	binary.BigEndian.PutUint32(b[len(magic)+1:], uint32(len(fields)))
+	b = append(b, fields...)
+	sum := sha256.Sum256(b)
+	h.binding = sum[:]
+	return b, nil
+}
+
+// newStreamID returns a random stream ID.
+func newStreamID() ([]byte, error) {
+	id := make([]byte, streamIDSize)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("encrypt: crypto.rand.Reader failed: %w", err)
+	}
+	return id, nil
+}
+
+// metadataAD returns the additional data of the metadata field, which includes the stream ID.
+func (h *header) metadataAD() []byte {
+	return append(append([]byte{}, metadataAD...), h.id...)
+}
+
+func appendField(b []byte, tag byte, value []byte) ([]byte, error) {
+	if len(value) > 0xffff {
+		return nil, fmt.Errorf("encrypt: header field %d is too large", tag)
+	}
+	b = append(b, tag, byte(len(value)>>8), byte(len(value)))
+	return append(b, value...), nil
+}
+
+// readHeader reads and decodes a header from r, which must be positioned immediately after the magic string.
+// Encrypted fields are opened with aead, or with the cipher recorded in the header using key if aead is nil.
+// The returned size is the number of bytes read from r.
+func readHeader(r io.Reader, key Key, aead cipher.AEAD) (h *header, size int64, err error) {
+	if h, size, err = parseHeader(r); err != nil {
+		return nil, 0, err
+	}
+	// encrypted fields are decrypted last, since they depend on the other fields
+	if aead == nil && (h.keyCheck != nil || h.sealedMetadata != nil) {
+		if aead, err = h.newAEAD(key); err != nil {
+			return nil, 0, err
+		}
+	}
+	if h.keyCheck != nil {
+		// a wrong key fails here with ErrAuthFailed, before any data is read
+		if _, err = decrypt(aead, nil, h.keyCheck, keyCheckAD); err != nil {
+			return nil, 0, err
+		}
+	}
+	if h.sealedMetadata != nil {
+		plaintext, err := decrypt(aead, nil, h.sealedMetadata, h.metadataAD())
+		if err != nil {
+			return nil, 0, err
+		}
+		if h.metadata, err = decodeMetadata(plaintext); err != nil {
+			return nil, 0, err
+		}
+	}
+	return h, size, nil
+}
+
+// parseHeader reads and decodes a header from r like readHeader,
+// leaving encrypted fields sealed.
+// The binding of the header is the hash of the magic string and the bytes read from r.
+func parseHeader(r io.Reader) (h *header, size int64, err error) {
+	var prefix [5]byte
+	if _, err = io.ReadFull(r, prefix[:]); err != nil {
+		return nil, 0, fmt.Errorf("encrypt: reading header: %w", err)
+	}
+	if prefix[0] != headerVersion {
+		return nil, 0, fmt.Errorf("encrypt: unsupported header version %d", prefix[0])
+	}
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if length > maxHeaderSize {
+		return nil, 0, errors.New("encrypt: header is too large")
+	}
+	fields := make([]byte, length)
+	if _, err = io.ReadFull(r, fields); err != nil {
+		return nil, 0, fmt.Errorf("encrypt: reading header: %w", err)
+	}
+	encoded := fields
+
+	h = &header{}
+	for len(fields) > 0 {
+		if len(fields) < 3 {
+			return nil, 0, errors.New("encrypt: malformed header")
+		}
+		tag := fields[0]
+		n := int(binary.BigEndian.Uint16(fields[1:]))
+		fields = fields[3:]
+		if len(fields) < n {
+			return nil, 0, errors.New("encrypt: malformed header")
+		}
+		value := fields[:n]
+		fields = fields[n:]
+
+		switch tag {
+		case fieldStreamID:
+			if len(value) != streamIDSize {
+				return nil, 0, errors.New("encrypt: malformed header")
+			}
+			h.id = value
+		case fieldMetadata:
+			h.sealedMetadata = value
+		case fieldFingerprint:
+			h.fingerprint = value
+		case fieldKeyCheck:
+			h.keyCheck = value
+		case fieldNonceSize:
+			if len(value) != 1 || value[0] < minNonceSize || value[0] > maxNonceSize {
+				return nil, 0, errors.New("encrypt: unsupported nonce size")
+			}
+			h.nonceLen = int(value[0])
+		case fieldCipher:
+			if len(value) != 1 || (value[0] != cipherGCMSIV && value[0] != cipherCustom) {
+				return nil, 0, errors.New("encrypt: unsupported cipher")
+			}
+			h.cipher = value[0]
+		case fieldPadded:
+			if len(value) != 0 {
+				return nil, 0, errors.New("encrypt: malformed header")
+			}
+			h.padded = true
+		case fieldTOC:
+			if len(value) != 0 {
+				return nil, 0, errors.New("encrypt: malformed header")
+			}
+			h.toc = true
+		case fieldChain:
+			if len(value) != 0 {
+				return nil, 0, errors.New("encrypt: malformed header")
+			}
+			h.chained = true
+		case fieldUniform:
+			if len(value) != 0 {
+				return nil, 0, errors.New("encrypt: malformed header")
+			}
+			h.uniform = true
+		case fieldKeySize:
+			if len(value) != 1 || (value[0] != 16 && value[0] != 24) {
+				return nil, 0, errors.New("encrypt: unsupported key size")
+			}
+			h.keyLen = int(value[0])
+		case fieldTrailer:
+			if len(value) != 0 {
+				return nil, 0, errors.New("encrypt: malformed header")
+			}
+			h.trailer = true
+		case fieldChecksums:
+			if len(value) != 0 {
+				return nil, 0, errors.New("encrypt: malformed header")
+			}
+			h.checksums = true
+		case fieldVariable:
+			if len(value) != 0 {
+				return nil, 0, errors.New("encrypt: malformed header")
+			}
+			h.variable = true
+		case fieldChunkSize:
+			if len(value) != 4 {
+				return nil, 0, errors.New("encrypt: malformed header")
+			}
+			h.chunkSize = int(binary.BigEndian.Uint32(value))
+			if h.chunkSize <= 0 || h.chunkSize > maxChunkSize {
+				return nil, 0, errors.New("encrypt: unsupported chunk size")
+			}
+		default:
+			return nil, 0, fmt.Errorf("encrypt: unsupported header field %d", tag)
+		}
+	}
+
+	if h.cipher == cipherGCMSIV && h.nonceLen != 0 && h.nonceLen != sivNonceSize {
+		return nil, 0, errors.New("encrypt: unsupported nonce size")
+	}
+	if h.id == nil {
+		return nil, 0, errors.New("encrypt: header has no stream ID")
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(magic))
+	hash.Write(prefix[:])
+	hash.Write(encoded)
+	h.binding = hash.Sum(nil)
+	return h, int64(len(prefix)) + int64(length), nil
+}
+
+// encodeMetadata encodes md as a count followed by length-prefixed keys and values.
+// Keys are sorted so that the encoding is deterministic.
+func encodeMetadata(md map[string]string) []byte {
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b := appendUvarint(nil, uint64(len(keys)))
+	for _, k := range keys {
+		b = appendUvarint(b, uint64(len(k)))
+		b = append(b, k...)
+		b = appendUvarint(b, uint64(len(md[k])))
+		b = append(b, md[k]...)
+	}
+	return b
+}
+
+func appendUvarint(b []byte, x uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], x)
+	return append(b, buf[:n]...)
+}
+
+func decodeMetadata(b []byte) (map[string]string, error) {
+	r := bytes.NewReader(b)
+	readString := func() (string, error) {
+		n, err := binary.ReadUvarint(r)
+		if err != nil || n > uint64(r.Len()) {
+			return "", errors.New("encrypt: malformed metadata")
+		}
+		s := make([]byte, n)
+		_, err = io.ReadFull(r, s)
+		return string(s), err
+	}
+
+	count, err := binary.ReadUvarint(r)
+	if err != nil || count > uint64(r.Len()) {
+		return nil, errors.New("encrypt: malformed metadata")
+	}
+	md := make(map[string]string, count)
+	for i := uint64(0); i < count; i++ {
+		k, err := readString()
+		if err != nil {
+			return nil, err
+		}
+		v, err := readString()
+		if err != nil {
+			return nil, err
+		}
+		md[k] = v
+	}
+	return md, nil
+}
+
+// SetMetadata attaches md to the stream, such as an original filename, mode, or modification time.
+// The metadata is encrypted and authenticated with the same key as the stream
+// and stored in a header at the start of the output,
+// where it can be retrieved with Reader.Metadata.
+//
+// SetMetadata must be called before any data has been written to the underlying writer,
+// which happens once the first chunk is full or the Writer is closed.
+func (w *Writer) SetMetadata(md map[string]string) error {
+	if w.started {
+		return errors.New("encrypt.Writer.SetMetadata: data has already been written")
+	}
+	if w.tags != nil {
+		return errors.New("encrypt.Writer.SetMetadata: not supported with detached tags")
+	}
+	m := make(map[string]string, len(md))
+	for k, v := range md {
+		m[k] = v
+	}
+	if len(encodeMetadata(m)) > 0xffff-nonceSize-tagSize {
+		return errors.New("encrypt.Writer.SetMetadata: metadata is too large")
+	}
+	if w.header == nil {
+		w.header = &header{}
+	}
+	w.header.metadata = m
+	return nil
+}
+
+// Metadata returns the metadata attached to the stream by Writer.SetMetadata.
+// If it has not already been read, the header is read from the underlying reader.
+// Metadata returns nil for streams that have no metadata.
+func (r *Reader) Metadata() (map[string]string, error) {
+	if err := r.detect(); err != nil {
+		return nil, err
+	}
+	if r.header == nil {
+		return nil, nil
+	}
+	return r.header.metadata, nil
+}
+
+// SetChunkSize changes the plaintext size of the chunks that follow,
+// after flushing any buffered data as a short chunk.
+// The size n must be a positive multiple of 16 bytes and no larger than 16MB.
+// This allows, for example, small chunks at the start of a media file for fast initial playback
+// followed by large chunks for throughput.
+//
+// Changing the chunk size requires a stream with a header,
+// which SetChunkSize adds if nothing has been written to the underlying writer yet.
+// When it is called before anything has been written,
+// the chunk size is recorded in the header and the stream remains seekable.
+// Otherwise Reader.Seek is only supported with a table of contents from EnableTOC,
+// and without one it returns an error when it finds a record whose size doesn't match the header.
+// Chunks larger than the chunk size in the header exceed the default limit of a Reader,
+// which must be raised with Reader.SetMaxChunkSize to read them.
+func (w *Writer) SetChunkSize(n int) error {
+	if n <= 0 || n%aesBlockSize != 0 || n > maxChunkSize {
+		return fmt.Errorf("encrypt.Writer.SetChunkSize: invalid chunk size %d", n)
+	}
+	if w.closed {
+		return errors.New("encrypt.Writer.SetChunkSize: writer is closed")
+	}
+	if w.started && w.header == nil {
+		return errors.New("encrypt.Writer.SetChunkSize: not supported for headerless streams")
+	}
+	if w.tags != nil {
+		return errors.New("encrypt.Writer.SetChunkSize: not supported with detached tags")
+	}
+	if w.started && w.header != nil && w.header.uniform {
+		return errors.New("encrypt.Writer.SetChunkSize: uniform streams can't change their chunk size")
+	}
+	if w.header == nil {
+		w.header = &header{}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if !w.started {
+		w.header.chunkSize = n
+	}
+	w.chunk = make([]byte, n)
+	return nil
+}
+
+// NewWriterNonceSize returns a new Writer that encrypts data with key before writing to w,
+// using AES-GCM with nonces of n bytes instead of the standard 12.
+// This is intended for interoperating with systems that require a non-standard nonce size,
+// and n must be between 12 and 32.
+//
+// The nonce size is recorded in the stream header, so the output can be decrypted by NewReader.
+// Callers must call Close to write the final chunk of data.
+func NewWriterNonceSize(w io.Writer, key Key, n int) *Writer {
+	writer := &Writer{
+		w:      w,
+		key:    key,
+		header: &header{nonceLen: n},
+	}
+	if n < minNonceSize || n > maxNonceSize {
+		writer.err = fmt.Errorf("encrypt.NewWriterNonceSize: unsupported nonce size %d", n)
+	}
+	return writer
+}
+
+// NewWriterKeySize returns a new Writer that encrypts data before writing to w,
+// using AES-GCM with the first n bytes of key, where n is 16 for AES-128, 24 for AES-192, or 32 for AES-256.
+// Smaller keys are slightly faster and satisfy policies that call for them;
+// a 128-bit key from elsewhere can be used by copying it into the start of a Key.
+//
+// The key size is recorded in the stream header, so the output can be decrypted by NewReader with the same key.
+// Callers must call Close to write the final chunk of data.
+func NewWriterKeySize(w io.Writer, key Key, n int) *Writer {
+	writer := &Writer{
+		w:      w,
+		key:    key,
+		header: &header{},
+	}
+	switch n {
+	case 16, 24:
+		writer.header.keyLen = n
+	case 32:
+	default:
+		writer.err = fmt.Errorf("encrypt.NewWriterKeySize: %w", KeySizeError(n))
+	}
+	return writer
+}
+
+// Header describes the start of a stream, as returned by ReadHeader.
+type Header struct {
+	Version     int    // Version is the version of the header format, or 0 for a headerless stream.
+	Cipher      string // Cipher names the AEAD, or is "custom" for one provided to NewWriterAEAD.
+	ChunkSize   int    // ChunkSize is the plaintext size of each full chunk at the start of the stream.
+	NonceSize   int    // NonceSize is the size of the nonce of each chunk.
+	KeySize     int    // KeySize is the number of bytes of the key used by the cipher.
+	Padded      bool   // Padded is set for streams written by NewPaddedWriter.
+	TOC         bool   // TOC is set for streams with a table of contents from Writer.EnableTOC.
+	Chained     bool   // Chained is set for streams whose records are linked by Writer.EnableChain.
+	Uniform     bool   // Uniform is set for streams written by NewUniformWriter.
+	Trailer     bool   // Trailer is set for streams that end with an HMAC from Writer.EnableTrailer.
+	Checksums   bool   // Checksums is set for streams whose records are followed by a CRC-32C from Writer.EnableChecksums.
+	Variable    bool   // Variable is set for streams whose chunks vary in size because of Writer.Flush, such as those written by Conn.
+	HasMetadata bool   // HasMetadata is set when the stream holds encrypted metadata, which requires the key to read.
+	Fingerprint []byte // Fingerprint is the Key.Fingerprint of the key that encrypted the stream, or nil if it was not recorded.
+	Size        int64  // Size is the length of the header in bytes, which is the position of the first record.
+}
+
+// ReadHeader reads the header at the start of r without decrypting anything,
+// which allows a program to choose the key for a stream, for example by its Fingerprint,
+// before creating a Reader.
+// Headerless streams are reported with a Version of 0.
+//
+// The returned reader replays the bytes consumed from r followed by the rest of r,
+// so it yields the whole stream and may be passed to NewReader.
+func ReadHeader(r io.Reader) (Header, io.Reader, error) {
+	consumed := &bytes.Buffer{}
+	tee := io.TeeReader(r, consumed)
+	prefix := make([]byte, len(magic))
+	n, err := io.ReadFull(tee, prefix)
+	if err != nil && err != io.EOF && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return Header{}, nil, fmt.Errorf("encrypt.ReadHeader: %w", err)
+	}
+	if string(prefix[:n]) != magic {
+		return (*header)(nil).export(), io.MultiReader(consumed, r), nil
+	}
+	h, size, err := parseHeader(tee)
+	if err != nil {
+		return Header{}, nil, err
+	}
+	hdr := h.export()
+	hdr.Size = int64(len(magic)) + size
+	return hdr, io.MultiReader(consumed, r), nil
+}
+
+// export describes h as a Header.
+// It may be called on a nil header, which describes a headerless stream.
+func (h *header) export() Header {
+	hdr := Header{
+		Cipher:    "AES-256-GCM",
+		ChunkSize: chunkSize,
+		NonceSize: h.nonceSize(),
+		KeySize:   h.keySize(),
+	}
+	if h == nil {
+		return hdr
+	}
+	hdr.Version = headerVersion
+	hdr.Cipher = fmt.Sprintf("AES-%d-GCM", h.keySize()*8)
+	if h.cipher == cipherGCMSIV {
+		hdr.Cipher += "-SIV"
+	}
+	if h.cipher == cipherCustom {
+		hdr.Cipher = "custom"
+	}
+	if h.chunkSize != 0 {
+		hdr.ChunkSize = h.chunkSize
+	}
+	hdr.Padded = h.padded
+	hdr.TOC = h.toc
+	hdr.Chained = h.chained
+	hdr.Uniform = h.uniform
+	hdr.Trailer = h.trailer
+	hdr.Checksums = h.checksums
+	hdr.Variable = h.variable
+	hdr.HasMetadata = h.sealedMetadata != nil
+	hdr.Fingerprint = h.fingerprint
+	return hdr
+}
@@ -0,0 +1,610 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestWriter_SetMetadata(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	md := map[string]string{"name": "report.pdf", "mode": "0644", "mtime": "2022-03-20T00:00:00Z"}
+
+	for _, plaintext := range [][]byte{nil, []byte("Hello, world!"), plaintextData()} {
+		buf := &bytes.Buffer{}
+		w := encrypt.NewWriter(buf, key)
+		if err := w.SetMetadata(md); err != nil {
+			t.Fatal(err)
+		}
+		w.Write(plaintext)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		r := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+		got, err := r.Metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, md) {
+			t.Errorf("expected metadata %v; got %v", md, got)
+		}
+		decrypted, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("plaintext does not match")
+		}
+	}
+}
+
+func TestWriter_SetMetadata_afterWrite(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	w := encrypt.NewWriter(&bytes.Buffer{}, key)
+	w.Write(make([]byte, chunkSize+1))
+	if err := w.SetMetadata(map[string]string{"name": "late"}); err == nil {
+		t.Errorf("expected an error when setting metadata after data was written")
+	}
+}
+
+func TestReader_Metadata_headerless(t *testing.T) {
+	key, _ := encrypt.DecodeBase64Key(testKey)
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.Write([]byte("Hello, world!"))
+	w.Close()
+
+	r := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+	md, err := r.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md != nil {
+		t.Errorf("expected nil metadata for a headerless stream; got %v", md)
+	}
+	// checking for a header must not consume any of the stream
+	decrypted, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decrypted) != "Hello, world!" {
+		t.Errorf("plaintext does not match")
+	}
+}
+
+func TestReader_header_tampering(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	const sectorSize = 5 + 12 + chunkSize + 16
+	const endRecordSize = 5 + 12 + 8 + 16
+	// encode returns a stream with a header holding md, or only the chunk size if md is nil, and the size of its header
+	encode := func(md map[string]string) ([]byte, int) {
+		buf := &bytes.Buffer{}
+		w := encrypt.NewWriter(buf, key)
+		if md != nil {
+			w.SetMetadata(md)
+		} else {
+			w.SetChunkSize(chunkSize)
+		}
+		w.Write(plaintextData())
+		w.Close()
+		return buf.Bytes(), buf.Len() - 3*sectorSize - endRecordSize + (3*chunkSize - len(plaintextData()))
+	}
+	ciphertext, headerSize := encode(map[string]string{"name": "data.bin"})
+	other, _ := encode(map[string]string{"name": "data.bin"})
+	plain, plainHeaderSize := encode(nil)
+
+	tt := []struct {
+		name       string
+		ciphertext []byte
+	}{{
+		name:       "truncated end record",
+		ciphertext: ciphertext[:len(ciphertext)-endRecordSize],
+	}, {
+		name:       "truncated mid record",
+		ciphertext: ciphertext[:len(ciphertext)-100],
+	}, {
+		name: "reordered records",
+		ciphertext: append(append(append([]byte{}, ciphertext[:headerSize]...),
+			ciphertext[headerSize+sectorSize:headerSize+2*sectorSize]...),
+			ciphertext[headerSize:]...),
+	}, {
+		name: "modified metadata",
+		ciphertext: func() []byte {
+			b := append([]byte{}, ciphertext...)
+			b[headerSize-1] ^= 0xff
+			return b
+		}(),
+	}, {
+		name:       "header of another stream",
+		ciphertext: append(append([]byte{}, other[:headerSize]...), ciphertext[headerSize:]...),
+	}, {
+		name:       "record of another stream",
+		ciphertext: append(append(append([]byte{}, ciphertext[:headerSize]...), other[headerSize:headerSize+sectorSize]...), ciphertext[headerSize+sectorSize:]...),
+	}, {
+		name:       "stripped metadata",
+		ciphertext: append(append([]byte{}, plain[:plainHeaderSize]...), ciphertext[headerSize:]...),
+	}}
+	for _, td := range tt {
+		t.Run(td.name, func(t *testing.T) {
+			if _, err := io.ReadAll(encrypt.NewReader(bytes.NewReader(td.ciphertext), key)); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestReader_Seek_header(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.SetMetadata(map[string]string{"name": "data.bin"})
+	w.Write(plaintext)
+	w.Close()
+
+	tt := []struct {
+		offset int64
+		whence int
+	}{
+		{0, io.SeekStart},
+		{1, io.SeekStart},
+		{chunkSize, io.SeekStart},
+		{chunkSize + 1, io.SeekStart},
+		{int64(len(plaintext)), io.SeekStart},
+		{int64(len(plaintext)) + chunkSize*2, io.SeekStart},
+		{0, io.SeekEnd},
+		{-1, io.SeekEnd},
+		{-chunkSize, io.SeekEnd},
+		{10, io.SeekEnd},
+	}
+	for _, td := range tt {
+		expected := bytes.NewReader(plaintext)
+		r := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+		n1, _ := expected.Seek(td.offset, td.whence)
+		n2, err := r.Seek(td.offset, td.whence)
+		if err != nil {
+			t.Errorf("seek(%d, %d): %v", td.offset, td.whence, err)
+			continue
+		}
+		if n1 != n2 {
+			t.Errorf("seek(%d, %d): expected %d; got %d", td.offset, td.whence, n1, n2)
+		}
+		want, _ := io.ReadAll(expected)
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Errorf("seek(%d, %d): %v", td.offset, td.whence, err)
+		}
+		if !bytes.Equal(want, got) {
+			t.Errorf("seek(%d, %d): plaintext does not match", td.offset, td.whence)
+		}
+	}
+}
+
+func TestWriter_Flush(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	if err := encrypt.NewWriter(&bytes.Buffer{}, key).Flush(); err == nil {
+		t.Errorf("expected Flush to return an error for a headerless stream")
+	}
+
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.SetMetadata(nil)
+	for _, s := range []string{"Hello, ", "world", "!"} {
+		w.Write([]byte(s))
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+	plaintext, err := io.ReadAll(encrypt.NewReader(buf, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "Hello, world!" {
+		t.Errorf("plaintext does not match")
+	}
+}
+
+func TestReader_Seek_flushed(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()[:48]
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.SetChunkSize(16)
+	// the chunks hold 16, 8, 16, and 8 bytes, so the second chunk is short but not the last
+	w.Write(plaintext[:24])
+	w.Flush()
+	w.Write(plaintext[24:])
+	w.Close()
+
+	// offset 28 is past the end of the second chunk, where Seek expects it to be if every chunk is full
+	r := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+	if _, err := r.Seek(28, io.SeekStart); err == nil {
+		if got, err := io.ReadAll(r); err == nil {
+			t.Errorf("expected an error reading after a seek into a stream with a short chunk; got %d bytes", len(got))
+		}
+	}
+}
+
+func TestReader_Seek_chunkSizeChanged(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()[:1000]
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.SetChunkSize(64)
+	// the chunks hold 64 and 36 bytes followed by 48 bytes each, which Seek can't calculate from the header
+	w.Write(plaintext[:100])
+	w.SetChunkSize(48)
+	w.Write(plaintext[100:])
+	w.Close()
+
+	r := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+	if size, err := r.Seek(0, io.SeekEnd); err == nil {
+		t.Errorf("expected an error seeking to the end of a stream whose chunk size changed; got %d", size)
+	}
+	for _, offset := range []int64{0, 63, 64, 100, 500, 999} {
+		r := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			continue
+		}
+		got, err := io.ReadAll(r)
+		if err == nil && !bytes.Equal(got, plaintext[offset:]) {
+			t.Errorf("Seek(%d) read the wrong plaintext", offset)
+		}
+	}
+}
+
+func TestWriter_Flush_variable(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()[:100]
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.SetChunkSize(16)
+	w.Write(plaintext[:10])
+	w.Flush()
+	w.Write(plaintext[10:])
+	w.Close()
+
+	h, _, err := encrypt.ReadHeader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.Variable {
+		t.Errorf("expected the header of a stream flushed before its first full chunk to be marked variable")
+	}
+	r := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+	if _, err := r.Seek(50, io.SeekStart); err == nil {
+		t.Errorf("expected an error seeking in a stream whose chunks vary in size")
+	}
+	if _, err := r.Seek(0, io.SeekEnd); err == nil {
+		t.Errorf("expected an error seeking to the end of a stream whose chunks vary in size")
+	}
+	decrypted, err := io.ReadAll(encrypt.NewReader(bytes.NewReader(buf.Bytes()), key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("plaintext does not match")
+	}
+}
+
+func TestWriter_SetChunkSize(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	w := encrypt.NewWriter(&bytes.Buffer{}, key)
+	for _, n := range []int{0, -16, 15, 17, 32<<20 + 16} {
+		if err := w.SetChunkSize(n); err == nil {
+			t.Errorf("expected an error for chunk size %d", n)
+		}
+	}
+
+	plaintext := make([]byte, 3<<20)
+	for i := range plaintext {
+		plaintext[i] = byte(i)
+	}
+	buf := &bytes.Buffer{}
+	w = encrypt.NewWriter(buf, key)
+	if err := w.SetChunkSize(1024); err != nil {
+		t.Fatal(err)
+	}
+	w.Write(plaintext[:5000])
+	if err := w.SetChunkSize(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	w.Write(plaintext[5000:])
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)); !errors.Is(err, encrypt.ErrChunkTooLarge) {
+		t.Errorf("expected chunks larger than the header declares to exceed the default limit; got %v", err)
+	}
+	r := encrypt.NewReader(buf, key)
+	r.SetMaxChunkSize(1 << 20)
+	decrypted, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("plaintext does not match")
+	}
+
+	headerless := encrypt.NewWriter(&bytes.Buffer{}, key)
+	headerless.Write(make([]byte, chunkSize))
+	if err := headerless.SetChunkSize(1024); err == nil {
+		t.Errorf("expected an error changing the chunk size of a headerless stream that has started")
+	}
+}
+
+func TestWriter_SetChunkSize_seek(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.SetChunkSize(4096)
+	w.Write(plaintext)
+	w.Close()
+
+	for _, offset := range []int64{0, 4095, 4096, 100000, int64(len(plaintext))} {
+		r := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+		if n, err := r.Seek(offset, io.SeekStart); n != offset || err != nil {
+			t.Fatalf("expected %d/nil; got %d/%v", offset, n, err)
+		}
+		rest, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(rest, plaintext[offset:]) {
+			t.Errorf("seek(%d): plaintext does not match", offset)
+		}
+	}
+}
+
+func TestNewWriterNonceSize(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	for _, n := range []int{0, 8, 11, 33} {
+		w := encrypt.NewWriterNonceSize(&bytes.Buffer{}, key, n)
+		if _, err := w.Write([]byte("Hello, world!")); err == nil {
+			t.Errorf("expected an error for nonce size %d", n)
+		}
+	}
+
+	plaintext := plaintextData()
+	for _, n := range []int{12, 16, 32} {
+		buf := &bytes.Buffer{}
+		w := encrypt.NewWriterNonceSize(buf, key, n)
+		w.Write(plaintext)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		decrypted, err := io.ReadAll(encrypt.NewReader(bytes.NewReader(buf.Bytes()), key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("nonce size %d: plaintext does not match", n)
+		}
+
+		r := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+		if offset, err := r.Seek(-100, io.SeekEnd); err != nil || offset != int64(len(plaintext)-100) {
+			t.Fatalf("nonce size %d: expected %d/nil; got %d/%v", n, len(plaintext)-100, offset, err)
+		}
+		tail, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(tail, plaintext[len(plaintext)-100:]) {
+			t.Errorf("nonce size %d: plaintext after seek does not match", n)
+		}
+	}
+}
+
+func TestReadHeader(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	otherKey, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	withHeader := &bytes.Buffer{}
+	w := encrypt.NewWriterGCMSIV(withHeader, key)
+	w.SetMetadata(map[string]string{"name": "data.bin"})
+	w.SetChunkSize(4096)
+	w.Write(plaintext)
+	w.Close()
+	headerless := &bytes.Buffer{}
+	w = encrypt.NewWriter(headerless, key)
+	w.Write(plaintext)
+	w.Close()
+
+	tt := []struct {
+		name       string
+		ciphertext []byte
+		expected   encrypt.Header
+	}{{
+		name:       "header",
+		ciphertext: withHeader.Bytes(),
+		expected: encrypt.Header{
+			Version:     1,
+			Cipher:      "AES-256-GCM-SIV",
+			ChunkSize:   4096,
+			NonceSize:   12,
+			KeySize:     32,
+			HasMetadata: true,
+			Fingerprint: key.Fingerprint(),
+		},
+	}, {
+		name:       "headerless",
+		ciphertext: headerless.Bytes(),
+		expected: encrypt.Header{
+			Cipher:    "AES-256-GCM",
+			ChunkSize: encrypt.ChunkSize,
+			NonceSize: 12,
+			KeySize:   32,
+		},
+	}}
+	for _, td := range tt {
+		t.Run(td.name, func(t *testing.T) {
+			h, r, err := encrypt.ReadHeader(bytes.NewReader(td.ciphertext))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the first record begins immediately after the header
+			if h.Version != 0 && td.ciphertext[h.Size] != 'D' {
+				t.Errorf("expected a data record at the end of the header, offset %d", h.Size)
+			}
+			h.Size = 0
+			if !reflect.DeepEqual(h, td.expected) {
+				t.Errorf("expected %+v; got %+v", td.expected, h)
+			}
+			if bytes.Equal(h.Fingerprint, otherKey.Fingerprint()) {
+				t.Errorf("expected fingerprints of different keys to differ")
+			}
+			decrypted, err := io.ReadAll(encrypt.NewReader(r, key))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decrypted, plaintext) {
+				t.Errorf("plaintext does not match")
+			}
+		})
+	}
+}
+
+func TestReader_keyCheck(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	wrongKey, _ := encrypt.NewKey()
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.SetChunkSize(1 << 20)
+	w.Write(make([]byte, 1<<20))
+	w.Close()
+
+	src := bytes.NewReader(buf.Bytes())
+	if _, err := encrypt.NewReader(src, wrongKey).Read(make([]byte, 10)); !errors.Is(err, encrypt.ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed; got %v", err)
+	}
+	// the key is checked before the first record is read
+	if consumed := src.Size() - int64(src.Len()); consumed > 1024 {
+		t.Errorf("expected only the header to be read; read %d bytes", consumed)
+	}
+}
+
+func TestReader_SetMaxChunkSize(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.SetChunkSize(1 << 20)
+	w.Write(make([]byte, 100))
+	w.Close()
+
+	r := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+	r.SetMaxChunkSize(64 << 10)
+	if _, err := io.ReadAll(r); !errors.Is(err, encrypt.ErrChunkTooLarge) {
+		t.Errorf("expected ErrChunkTooLarge; got %v", err)
+	}
+
+	plaintext, err := io.ReadAll(encrypt.NewReader(bytes.NewReader(buf.Bytes()), key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plaintext) != 100 {
+		t.Errorf("expected 100 bytes with the default limit; got %d", len(plaintext))
+	}
+
+	// the default limit is the chunk size of the header, which a larger limit may raise
+	buf = &bytes.Buffer{}
+	w = encrypt.NewWriter(buf, key)
+	w.SetChunkSize(1024)
+	w.Write(make([]byte, 100))
+	w.SetChunkSize(4096)
+	w.Write(make([]byte, 4000))
+	w.Close()
+	if _, err := io.ReadAll(encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)); !errors.Is(err, encrypt.ErrChunkTooLarge) {
+		t.Errorf("expected ErrChunkTooLarge for a chunk larger than the header declares; got %v", err)
+	}
+	r = encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+	r.SetMaxChunkSize(4096)
+	if plaintext, err := io.ReadAll(r); err != nil || len(plaintext) != 4100 {
+		t.Errorf("expected 4100 bytes with a raised limit; got %d, %v", len(plaintext), err)
+	}
+}
+
+func TestReader_DeclaredSize(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.SetMetadata(nil)
+	w.Write(plaintext)
+	w.Close()
+
+	// the source can't seek, so the size is only known at the end
+	r := encrypt.NewReader(io.MultiReader(bytes.NewReader(buf.Bytes())), key)
+	if _, ok := r.DeclaredSize(); ok {
+		t.Errorf("expected no declared size before the end of the stream")
+	}
+	if _, err := io.ReadAll(r); err != nil {
+		t.Fatal(err)
+	}
+	if size, ok := r.DeclaredSize(); size != int64(len(plaintext)) || !ok {
+		t.Errorf("expected a declared size of %d/true; got %d/%v", len(plaintext), size, ok)
+	}
+
+	truncated := buf.Bytes()[:buf.Len()-100]
+	_, err := io.ReadAll(encrypt.NewReader(io.MultiReader(bytes.NewReader(truncated)), key))
+	if !errors.Is(err, encrypt.ErrTruncated) || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected ErrTruncated matching io.ErrUnexpectedEOF; got %v", err)
+	}
+
+	headerless := &bytes.Buffer{}
+	w = encrypt.NewWriter(headerless, key)
+	w.Write(plaintext)
+	w.Close()
+	r = encrypt.NewReader(headerless, key)
+	io.ReadAll(r)
+	if _, ok := r.DeclaredSize(); ok {
+		t.Errorf("expected no declared size for a headerless stream")
+	}
+}
+
+func TestNewWriterKeySize(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	for _, n := range []int{16, 24, 32} {
+		buf := &bytes.Buffer{}
+		w := encrypt.NewWriterKeySize(buf, key, n)
+		w.Write(plaintext)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		h, _, err := encrypt.ReadHeader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cipher := fmt.Sprintf("AES-%d-GCM", n*8); h.KeySize != n || h.Cipher != cipher {
+			t.Errorf("expected %d/%s; got %d/%s", n, cipher, h.KeySize, h.Cipher)
+		}
+		got, err := io.ReadAll(encrypt.NewReader(bytes.NewReader(buf.Bytes()), key))
+		if err != nil || !bytes.Equal(got, plaintext) {
+			t.Errorf("%d-byte key: decrypted stream doesn't match: %v", n, err)
+		}
+	}
+
+	// AES-128 only uses the first 16 bytes of the key
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriterKeySize(buf, key, 16)
+	w.Write(plaintext)
+	w.Close()
+	var short encrypt.Key
+	copy(short[:16], key[:16])
+	if got, err := io.ReadAll(encrypt.NewReader(bytes.NewReader(buf.Bytes()), short)); err != nil || !bytes.Equal(got, plaintext) {
+		t.Errorf("expected a key with the same first 16 bytes to decrypt the stream: %v", err)
+	}
+
+	w = encrypt.NewWriterKeySize(io.Discard, key, 20)
+	if _, err := w.Write(plaintext); !errors.Is(err, encrypt.ErrInvalidKeyLength) {
+		t.Errorf("expected ErrInvalidKeyLength; got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package encrypt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// NewReaderKeyring returns a Reader for decrypting r with whichever of keys it was encrypted with,
+// along with the matching key, which is useful while keys are being rotated.
+//
+// A stream with a header is matched by its key check alone,
+// so a key that matches is returned even if the records that follow are corrupted,
+// and the corruption is reported by the Reader as usual.
+// If the fingerprint of the stream identifies one of keys but its key check doesn't open,
+// the header is corrupted, and the error says so.
+// A headerless stream has no key check, so each key is tried on the tag of its first chunk,
+// and a corrupted first chunk can't be told apart from a stream encrypted with a key that isn't in keys.
+// An empty headerless stream has nothing to authenticate and matches the first key.
+//
+// r is rewound to its starting position after the keys are tried, which is why it must be seekable.
+// The keys are tried one after another,
+// so the time taken may reveal the position of the matching key in keys, though nothing about the keys themselves.
+// If no key matches, the error wraps ErrAuthFailed.
+func NewReaderKeyring(r io.ReadSeeker, keys ...Key) (*Reader, Key, error) {
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, Key{}, fmt.Errorf("encrypt.NewReaderKeyring: %w", err)
+	}
+	key, err := matchKey(r, start, keys)
+	if _, serr := r.Seek(start, io.SeekStart); serr != nil && err == nil {
+		err = serr
+	}
+	if err != nil {
+		return nil, Key{}, fmt.Errorf("encrypt.NewReaderKeyring: %w", err)
+	}
+	return NewReader(r, key), key, nil
+}
+
+// matchKey returns the key in keys that encrypted the stream starting at start in r,
+// which must be positioned at start.
+// The position of r afterwards is unspecified.
+func matchKey(r io.ReadSeeker, start int64, keys []Key) (Key, error) {
+	prefix := make([]byte, len(magic))
+	n, err := io.ReadFull(r, prefix)
+	if err != nil && err != io.EOF && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return Key{}, err
+	}
+	if string(prefix[:n]) != magic {
+		return matchFirstChunk(r, start, keys)
+	}
+
+	h, _, err := parseHeader(r)
+	if err != nil {
+		return Key{}, err
+	}
+	if h.keyCheck == nil {
+		return Key{}, errors.New("the header has no key check")
+	}
+	fingerprinted := false
+	for _, key := range keys {
+		if h.fingerprint != nil && bytes.Equal(h.fingerprint, key.Fingerprint()) {
+			fingerprinted = true
+		}
+		aead, err := h.newAEAD(key)
+		if err != nil {
+			return Key{}, err
+		}
+		if _, err := decrypt(aead, nil, h.keyCheck, keyCheckAD); err == nil {
+			return key, nil
+		}
+	}
+	if fingerprinted {
+		return Key{}, fmt.Errorf("the header is corrupted: %w", ErrAuthFailed)
+	}
+	return Key{}, fmt.Errorf("none of %d keys match: %w", len(keys), ErrAuthFailed)
+}
+
+// matchFirstChunk returns the key in keys that authenticates the first chunk of the headerless stream
+// starting at start in r.
+func matchFirstChunk(r io.ReadSeeker, start int64, keys []Key) (Key, error) {
+	for _, key := range keys {
+		if _, err := r.Seek(start, io.SeekStart); err != nil {
+			return Key{}, err
+		}
+		_, err := NewReader(r, key).Read(make([]byte, 1))
+		if errors.Is(err, ErrAuthFailed) {
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return Key{}, err
+		}
+		return key, nil
+	}
+	return Key{}, fmt.Errorf("none of %d keys match the first chunk, or it is corrupted: %w", len(keys), ErrAuthFailed)
+}
@@ -0,0 +1,85 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestNewReaderKeyring(t *testing.T) {
+	oldKey, _ := encrypt.NewKey()
+	newKey, _ := encrypt.NewKey()
+	otherKey, _ := encrypt.NewKey()
+	plaintext := []byte("encrypted before the rotation")
+
+	for _, md := range []map[string]string{nil, {"name": "file.txt"}} {
+		buf := &bytes.Buffer{}
+		w := encrypt.NewWriter(buf, oldKey)
+		if md != nil {
+			w.SetMetadata(md)
+		}
+		w.Write(plaintext)
+		w.Close()
+
+		r, key, err := encrypt.NewReaderKeyring(bytes.NewReader(buf.Bytes()), newKey, otherKey, oldKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key != oldKey {
+			t.Errorf("expected the key that encrypted the stream")
+		}
+		if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, plaintext) {
+			t.Errorf("expected %q/nil; got %q/%v", plaintext, got, err)
+		}
+
+		_, _, err = encrypt.NewReaderKeyring(bytes.NewReader(buf.Bytes()), newKey, otherKey)
+		if !errors.Is(err, encrypt.ErrAuthFailed) {
+			t.Errorf("expected ErrAuthFailed when no key matches; got %v", err)
+		}
+	}
+}
+
+func TestNewReaderKeyring_corrupted(t *testing.T) {
+	oldKey, _ := encrypt.NewKey()
+	newKey, _ := encrypt.NewKey()
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, oldKey)
+	w.SetMetadata(map[string]string{"name": "file.txt"})
+	w.Write(plaintextData())
+	w.Close()
+	ciphertext := buf.Bytes()
+
+	// a corrupted first record doesn't prevent the key from being found,
+	// and the Reader reports the corruption
+	b := append([]byte{}, ciphertext...)
+	headerSize := 13 + int(binary.BigEndian.Uint32(b[9:13]))
+	b[headerSize+100] ^= 0xff
+	r, key, err := encrypt.NewReaderKeyring(bytes.NewReader(b), newKey, oldKey)
+	if err != nil || key != oldKey {
+		t.Fatalf("expected the key that encrypted the stream; got %v", err)
+	}
+	if _, err := io.ReadAll(r); !errors.Is(err, encrypt.ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed reading a corrupted record; got %v", err)
+	}
+
+	// a corrupted key check is reported as corruption rather than a missing key
+	b = append([]byte{}, ciphertext...)
+	const fieldKeyCheck = 7
+	for i := 13; i < len(b); {
+		tag, n := b[i], int(b[i+1])<<8|int(b[i+2])
+		i += 3 + n
+		if tag == fieldKeyCheck {
+			b[i-1] ^= 0xff
+			break
+		}
+	}
+	_, _, err = encrypt.NewReaderKeyring(bytes.NewReader(b), newKey, oldKey)
+	if !errors.Is(err, encrypt.ErrAuthFailed) || !strings.Contains(err.Error(), "corrupted") {
+		t.Errorf("expected an error reporting a corrupted header; got %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package encrypt
+
+import "io"
+
+// Normalize decrypts src, which was encrypted by a Writer using key,
+// and encrypts it again to dst in chunks of targetChunkSize bytes of plaintext.
+// This rewrites streams with irregular chunks, such as those written with many calls to Flush,
+// into a uniform and seekable layout.
+// Any metadata from the header of src is carried over to dst.
+//
+// A targetChunkSize of ChunkSize produces a headerless stream unless src has metadata;
+// other sizes follow the rules of Writer.SetChunkSize.
+// Memory use is bounded by the chunk sizes of src and dst,
+// and an error is returned if any part of src fails to authenticate,
+// in which case dst holds an incomplete stream.
+func Normalize(dst io.Writer, src io.Reader, key Key, targetChunkSize int) error {
+	r := NewReader(src, key)
+	md, err := r.Metadata()
+	if err != nil {
+		return err
+	}
+	w := NewWriter(dst, key)
+	if md != nil {
+		if err := w.SetMetadata(md); err != nil {
+			return err
+		}
+	}
+	if targetChunkSize != ChunkSize {
+		if err := w.SetChunkSize(targetChunkSize); err != nil {
+			return err
+		}
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	return w.Close()
+}
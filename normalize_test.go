@@ -0,0 +1,63 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestNormalize(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	md := map[string]string{"name": "log.txt"}
+	// a stream of many small chunks, as written by frequent calls to Flush
+	src := &bytes.Buffer{}
+	w := encrypt.NewWriter(src, key)
+	w.SetMetadata(md)
+	for p := plaintext; len(p) > 0; {
+		n := 1000
+		if n > len(p) {
+			n = len(p)
+		}
+		w.Write(p[:n])
+		w.Flush()
+		p = p[n:]
+	}
+	w.Close()
+
+	dst := &bytes.Buffer{}
+	if err := encrypt.Normalize(dst, bytes.NewReader(src.Bytes()), key, 4096); err != nil {
+		t.Fatal(err)
+	}
+	r := encrypt.NewReader(bytes.NewReader(dst.Bytes()), key)
+	if got, err := r.Metadata(); err != nil || !reflect.DeepEqual(got, md) {
+		t.Errorf("expected the metadata to be carried over; got %v/%v", got, err)
+	}
+	// uniform chunks can be located without a table of contents
+	if _, err := r.Seek(5000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plaintext[5000:]) {
+		t.Errorf("plaintext does not match")
+	}
+	h, _, _ := encrypt.ReadHeader(bytes.NewReader(dst.Bytes()))
+	if h.ChunkSize != 4096 {
+		t.Errorf("expected a chunk size of 4096; got %d", h.ChunkSize)
+	}
+
+	tampered := append([]byte{}, src.Bytes()...)
+	tampered[len(tampered)/2] ^= 1
+	if err := encrypt.Normalize(&bytes.Buffer{}, bytes.NewReader(tampered), key, 4096); err == nil {
+		t.Errorf("expected an error normalizing a tampered stream")
+	}
+	if err := encrypt.Normalize(&bytes.Buffer{}, bytes.NewReader(src.Bytes()), key, 1000); err == nil {
+		t.Errorf("expected an error for an invalid chunk size")
+	}
+}
@@ -0,0 +1,52 @@
+package encrypt
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+)
+
+// NewPaddedWriter returns a new Writer that encrypts data with key before writing to w,
+// padding the output to a multiple of bucket bytes so that its size does not reveal the exact plaintext length.
+// For example, a bucket of 1<<20 rounds every stream up to the next megabyte.
+// The true length is authenticated in the stream, and a Reader returns exactly the original plaintext.
+//
+// The padding costs up to bucket bytes of storage per stream.
+// Because the ciphertext size no longer determines the plaintext size,
+// Reader.Seek does not support io.SeekEnd for padded streams,
+// and reading after seeking past the end of the plaintext returns an error.
+// Callers must call Close to write the final chunk of data and the padding.
+func NewPaddedWriter(w io.Writer, key Key, bucket int64) *Writer {
+	writer := &Writer{
+		w:      w,
+		key:    key,
+		header: &header{padded: true},
+		bucket: bucket,
+	}
+	if bucket <= 0 {
+		writer.err = fmt.Errorf("encrypt.NewPaddedWriter: invalid bucket size %d", bucket)
+	}
+	return writer
+}
+
+// pad writes random bytes after the end record until the size of the stream is a multiple of w.bucket.
+// A Reader stops at the end record, so the padding is never decrypted,
+// and random bytes are indistinguishable from the ciphertext that precedes them.
+func (w *Writer) pad() error {
+	n := (w.bucket - w.written%w.bucket) % w.bucket
+	buf := make([]byte, chunkSize)
+	for n > 0 {
+		b := buf
+		if int64(len(b)) > n {
+			b = b[:n]
+		}
+		if _, err := rand.Read(b); err != nil {
+			return fmt.Errorf("encrypt.Writer.Close: crypto.rand.Reader failed: %w", err)
+		}
+		if err := w.write(b); err != nil {
+			return err
+		}
+		n -= int64(len(b))
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestNewPaddedWriter(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	const bucket = 1 << 16
+	for _, plaintext := range [][]byte{nil, []byte("Hello, world!"), make([]byte, chunkSize), plaintextData()} {
+		buf := &bytes.Buffer{}
+		w := encrypt.NewPaddedWriter(buf, key, bucket)
+		w.Write(plaintext)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len()%bucket != 0 {
+			t.Errorf("expected the ciphertext size to be a multiple of %d; got %d", bucket, buf.Len())
+		}
+		decrypted, err := io.ReadAll(encrypt.NewReader(bytes.NewReader(buf.Bytes()), key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("expected %d bytes of plaintext; got %d", len(plaintext), len(decrypted))
+		}
+	}
+
+	if _, err := encrypt.NewPaddedWriter(&bytes.Buffer{}, key, 0).Write([]byte("Hello, world!")); err == nil {
+		t.Errorf("expected an error for a bucket size of 0")
+	}
+}
+
+func TestNewPaddedWriter_seek(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	buf := &bytes.Buffer{}
+	w := encrypt.NewPaddedWriter(buf, key, 1<<20)
+	w.Write(plaintext)
+	w.Close()
+
+	r := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+	if _, err := r.Seek(-1, io.SeekEnd); err == nil {
+		t.Errorf("expected an error seeking relative to the end of a padded stream")
+	}
+	offset := int64(chunkSize + 100)
+	if n, err := r.Seek(offset, io.SeekStart); n != offset || err != nil {
+		t.Fatalf("expected %d/nil; got %d/%v", offset, n, err)
+	}
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, plaintext[offset:]) {
+		t.Errorf("plaintext after seek does not match")
+	}
+}
@@ -0,0 +1,97 @@
+package encrypt
+
+import (
+	"errors"
+	"io"
+)
+
+// PrefetchReader decrypts a stream ahead of the consumer in a background goroutine,
+// which overlaps the latency of reading from slow sources such as network or object storage
+// with processing the plaintext that has already arrived.
+type PrefetchReader struct {
+	chunks chan prefetched
+	done   chan struct{}
+
+	plaintext []byte
+	err       error
+	closed    bool
+}
+
+// prefetched is a chunk of plaintext decrypted by the background goroutine,
+// or the error that ended the stream.
+type prefetched struct {
+	plaintext []byte
+	err       error
+}
+
+// NewPrefetchReader returns a PrefetchReader for decrypting r,
+// where r was encrypted by a Writer using key.
+// Up to ahead chunks are decrypted and buffered before they are read,
+// in addition to the chunk being read from r; values less than 1 are treated as 1.
+//
+// Errors, including ErrAuthFailed, are returned by Read in stream order,
+// after all of the plaintext that preceded them.
+// Callers must call Close when they are done with the PrefetchReader, even after an error,
+// to stop the background goroutine.
+func NewPrefetchReader(r io.Reader, key Key, ahead int) *PrefetchReader {
+	if ahead < 1 {
+		ahead = 1
+	}
+	p := &PrefetchReader{
+		chunks: make(chan prefetched, ahead),
+		done:   make(chan struct{}),
+	}
+	go p.run(NewReader(r, key))
+	return p
+}
+
+// run decrypts chunks from r until an error or until p is closed.
+func (p *PrefetchReader) run(r *Reader) {
+	defer close(p.chunks)
+	for {
+		// a buffer of a full chunk lets r decrypt in place and return one chunk per call
+		buf := make([]byte, chunkSize)
+		n, err := r.Read(buf)
+		select {
+		case p.chunks <- prefetched{buf[:n], err}:
+		case <-p.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Read implements io.Reader.
+func (p *PrefetchReader) Read(b []byte) (int, error) {
+	if p.closed {
+		return 0, errors.New("encrypt.PrefetchReader.Read: reader is closed")
+	}
+	for len(p.plaintext) == 0 {
+		if p.err != nil {
+			return 0, p.err
+		}
+		c, ok := <-p.chunks
+		if !ok {
+			// run only stops without sending an error when p is closed
+			return 0, io.ErrUnexpectedEOF
+		}
+		p.plaintext, p.err = c.plaintext, c.err
+	}
+	n := copy(b, p.plaintext)
+	p.plaintext = p.plaintext[n:]
+	return n, nil
+}
+
+// Close stops the background goroutine and discards any buffered plaintext.
+// It doesn't close the underlying reader;
+// a goroutine blocked in a call to its Read method exits once that call returns.
+// Close must not be called concurrently with Read.
+func (p *PrefetchReader) Close() error {
+	if !p.closed {
+		p.closed = true
+		close(p.done)
+	}
+	return nil
+}
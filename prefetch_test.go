@@ -0,0 +1,76 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestPrefetchReader(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := make([]byte, encrypt.ChunkSize*5+123)
+	for i := range plaintext {
+		plaintext[i] = byte(i)
+	}
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.Write(plaintext)
+	w.Close()
+	ciphertext := buf.Bytes()
+
+	for _, ahead := range []int{0, 1, 3, 10} {
+		r := encrypt.NewPrefetchReader(iotest.HalfReader(bytes.NewReader(ciphertext)), key, ahead)
+		got, err := io.ReadAll(iotest.OneByteReader(io.LimitReader(r, 100)))
+		if err != nil || !bytes.Equal(got, plaintext[:100]) {
+			t.Fatalf("ahead %d: unexpected start of stream: %v", ahead, err)
+		}
+		rest, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(rest, plaintext[100:]) {
+			t.Errorf("ahead %d: decrypted plaintext doesn't match: %v", ahead, err)
+		}
+		r.Close()
+	}
+
+	// the plaintext before a tampered chunk is returned before the error
+	tampered := append([]byte{}, ciphertext...)
+	tampered[encrypt.SectorSize*2+100] ^= 1
+	r := encrypt.NewPrefetchReader(bytes.NewReader(tampered), key, 4)
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if !errors.Is(err, encrypt.ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed; got %v", err)
+	}
+	if !bytes.Equal(got, plaintext[:encrypt.ChunkSize*2]) {
+		t.Errorf("expected the %d bytes before the tampered chunk; got %d", encrypt.ChunkSize*2, len(got))
+	}
+	if _, err := r.Read(make([]byte, 1)); !errors.Is(err, encrypt.ErrAuthFailed) {
+		t.Errorf("expected the error to repeat; got %v", err)
+	}
+}
+
+func TestPrefetchReader_Close(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.Write(make([]byte, encrypt.ChunkSize*20))
+	w.Close()
+
+	// closing with the buffer full must not leave the goroutine blocked
+	r := encrypt.NewPrefetchReader(buf, key, 1)
+	if _, err := r.Read(make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("expected a second Close to succeed; got %v", err)
+	}
+	if _, err := r.Read(make([]byte, 10)); err == nil {
+		t.Errorf("expected an error reading after Close")
+	}
+}
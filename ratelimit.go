@@ -0,0 +1,76 @@
+package encrypt
+
+import "time"
+
+// RateBasis selects which bytes count toward a rate limit set by SetRateLimit.
+type RateBasis int
+
+const (
+	// RateCiphertext counts the encrypted bytes that pass through the underlying writer or reader,
+	// which is what a network link carries.
+	RateCiphertext RateBasis = iota
+
+	// RatePlaintext counts the bytes of plaintext that are encrypted or decrypted.
+	RatePlaintext
+)
+
+// SetRateLimit limits w to an average of bytesPerSecond bytes per second, counted according to basis,
+// so that a large upload doesn't saturate a shared link.
+// After each chunk is written, w waits until the chunk fits within the limit,
+// allowing bursts of up to one second of data;
+// a limit smaller than a chunk therefore waits longer than a second after each chunk.
+// A bytesPerSecond of zero or less removes the limit.
+func (w *Writer) SetRateLimit(bytesPerSecond int64, basis RateBasis) {
+	w.limiter = newRateLimiter(bytesPerSecond, basis)
+}
+
+// SetRateLimit limits r to an average of bytesPerSecond bytes per second, counted according to basis,
+// in the same way as Writer.SetRateLimit.
+// After each chunk is read, r waits until the chunk fits within the limit.
+func (r *Reader) SetRateLimit(bytesPerSecond int64, basis RateBasis) {
+	r.limiter = newRateLimiter(bytesPerSecond, basis)
+}
+
+// rateLimiter is a token bucket that holds up to one second of bytes.
+type rateLimiter struct {
+	rate   float64 // rate is the number of bytes allowed per second
+	basis  RateBasis
+	tokens float64 // tokens is the number of bytes that may be transferred without waiting, which is negative after a burst
+	last   time.Time
+}
+
+// newRateLimiter returns a rateLimiter for bytesPerSecond, or nil if there is no limit.
+func newRateLimiter(bytesPerSecond int64, basis RateBasis) *rateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		rate:   float64(bytesPerSecond),
+		basis:  basis,
+		tokens: float64(bytesPerSecond),
+		last:   time.Now(),
+	}
+}
+
+// wait accounts for a chunk of plaintext and its ciphertext,
+// sleeping until the transfer is within the limit.
+// It may be called on a nil rateLimiter, which doesn't wait.
+func (l *rateLimiter) wait(plaintext, ciphertext int) {
+	if l == nil {
+		return
+	}
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	if l.basis == RatePlaintext {
+		l.tokens -= float64(plaintext)
+	} else {
+		l.tokens -= float64(ciphertext)
+	}
+	if l.tokens < 0 {
+		time.Sleep(time.Duration(-l.tokens / l.rate * float64(time.Second)))
+	}
+}
@@ -0,0 +1,59 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestSetRateLimit(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := make([]byte, 1<<20)
+	const rate = 2 << 20
+
+	// the first second of data is allowed as a burst, so twice that takes at least half a second more
+	start := time.Now()
+	var buf bytes.Buffer
+	w := encrypt.NewWriter(&buf, key)
+	w.SetRateLimit(rate, encrypt.RatePlaintext)
+	for i := 0; i < 3; i++ {
+		if _, err := w.Write(plaintext); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 400*time.Millisecond {
+		t.Errorf("writing 3 MiB at 2 MiB/s took %v", d)
+	}
+
+	start = time.Now()
+	r := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+	r.SetRateLimit(rate, encrypt.RateCiphertext)
+	n, err := io.Copy(io.Discard, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3<<20 {
+		t.Errorf("expected %d bytes; got %d", 3<<20, n)
+	}
+	if d := time.Since(start); d < 400*time.Millisecond {
+		t.Errorf("reading 3 MiB at 2 MiB/s took %v", d)
+	}
+
+	// without a limit, the same data is read without waiting
+	start = time.Now()
+	r = encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+	r.SetRateLimit(rate, encrypt.RateCiphertext)
+	r.SetRateLimit(0, encrypt.RateCiphertext)
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 400*time.Millisecond {
+		t.Errorf("reading without a limit took %v", d)
+	}
+}
@@ -0,0 +1,38 @@
+package encrypt
+
+// EnableRecovery makes r continue past chunks that fail to authenticate instead of returning ErrAuthFailed,
+// for salvaging what remains of a damaged stream.
+// In place of each failed chunk, Read returns the result of placeholder,
+// which is called with the index of the chunk and the size of its plaintext,
+// or that many zero bytes if placeholder is nil.
+// The indices of the failed chunks are reported by FailedChunks.
+//
+// Recovery is only meant for forensic use:
+// placeholders are indistinguishable from plaintext in the output,
+// so callers must check FailedChunks before trusting any of it.
+// A placeholder of a different size than the chunk it replaces shifts the offsets of the data that follows.
+// Damage that prevents the chunks from being located,
+// such as a corrupt record length or end record in a stream with a header, is still returned as an error.
+func (r *Reader) EnableRecovery(placeholder func(index int64, length int) []byte) {
+	r.recovering = true
+	r.placeholder = placeholder
+}
+
+// FailedChunks returns the indices of the chunks that failed to authenticate
+// and were replaced by placeholders since EnableRecovery was called.
+func (r *Reader) FailedChunks() []int64 {
+	return r.failed
+}
+
+// recover records that the chunk at r.index failed to authenticate
+// and appends its placeholder, for a chunk of length bytes, to dst.
+func (r *Reader) recover(dst []byte, length int) []byte {
+	if length < 0 {
+		length = 0
+	}
+	r.failed = append(r.failed, r.index)
+	if r.placeholder != nil {
+		return append(dst, r.placeholder(r.index, length)...)
+	}
+	return append(dst, make([]byte, length)...)
+}
@@ -0,0 +1,68 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestReader_EnableRecovery(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.Write(plaintext)
+	w.Close()
+	ciphertext := buf.Bytes()
+	ciphertext[encrypt.SectorSize+100] ^= 1
+
+	if _, err := io.ReadAll(encrypt.NewReader(bytes.NewReader(ciphertext), key)); !errors.Is(err, encrypt.ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed without recovery; got %v", err)
+	}
+	r := encrypt.NewReader(bytes.NewReader(ciphertext), key)
+	r.EnableRecovery(nil)
+	recovered, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := append([]byte{}, plaintext...)
+	copy(expected[chunkSize:2*chunkSize], make([]byte, chunkSize))
+	if !bytes.Equal(recovered, expected) {
+		t.Errorf("expected the damaged chunk to be replaced with zeroes")
+	}
+	if failed := r.FailedChunks(); !reflect.DeepEqual(failed, []int64{1}) {
+		t.Errorf("expected chunk 1 to fail; got %v", failed)
+	}
+
+	// records of a stream with a header can be skipped the same way
+	buf = &bytes.Buffer{}
+	w = encrypt.NewWriter(buf, key)
+	w.SetChunkSize(1024)
+	w.Write(plaintext[:5000])
+	w.Close()
+	h, _, _ := encrypt.ReadHeader(bytes.NewReader(buf.Bytes()))
+	ciphertext = buf.Bytes()
+	ciphertext[h.Size+encrypt.SectorStartSize(3000, 1024)+50] ^= 1
+
+	r = encrypt.NewReader(bytes.NewReader(ciphertext), key)
+	r.EnableRecovery(func(index int64, length int) []byte {
+		return bytes.Repeat([]byte{'?'}, length)
+	})
+	recovered, err = io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = append([]byte{}, plaintext[:5000]...)
+	copy(expected[2048:3072], bytes.Repeat([]byte{'?'}, 1024))
+	if !bytes.Equal(recovered, expected) {
+		t.Errorf("expected the damaged record to be replaced with the placeholder")
+	}
+	if failed := r.FailedChunks(); !reflect.DeepEqual(failed, []int64{2}) {
+		t.Errorf("expected chunk 2 to fail; got %v", failed)
+	}
+}
@@ -0,0 +1,79 @@
+package encrypt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// NewResumeWriter returns a new Writer that continues a stream from an earlier Writer using key,
+// after the first resumeFromChunk chunks were encrypted and written successfully.
+// This allows an interrupted upload to be resumed without encrypting and sending the whole stream again.
+//
+// The output of the new Writer must be appended to the first resumeFromChunk sectors of the original output,
+// including its header if it had one,
+// and the caller must write the plaintext starting from offset resumeFromChunk*ChunkSize.
+// A stream with a header requires a call to SetResumeHeader with the original header before the first call to Write,
+// since every record is bound to it; the header itself is not written again.
+// Streams whose chunk size changed after data was written cannot be resumed.
+// Callers must call Close to write the final chunk of data.
+func NewResumeWriter(w io.Writer, key Key, resumeFromChunk int64) *Writer {
+	writer := &Writer{
+		w:          w,
+		key:        key,
+		index:      resumeFromChunk,
+		resumed:    true,
+		resumeFrom: resumeFromChunk,
+		sealed:     resumeFromChunk,
+	}
+	if resumeFromChunk < 0 {
+		writer.err = fmt.Errorf("encrypt.NewResumeWriter: invalid chunk %d", resumeFromChunk)
+	}
+	return writer
+}
+
+// SetResumeHeader reads the header of the original stream from r,
+// which must be positioned at the start of the original output,
+// and configures the Writer to continue that stream.
+// It must be called before the first call to Write for a stream with a header,
+// and replaces any configuration from setters such as SetMetadata or SetChunkSize.
+// Chained streams and streams with a table of contents, trailer, or checksums cannot be resumed.
+func (w *Writer) SetResumeHeader(r io.Reader) error {
+	if !w.resumed {
+		return errors.New("encrypt.Writer.SetResumeHeader: not a resumed stream")
+	}
+	if w.started {
+		return errors.New("encrypt.Writer.SetResumeHeader: data has already been written")
+	}
+	prefix := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return fmt.Errorf("encrypt.Writer.SetResumeHeader: %w", truncated(err))
+	}
+	if string(prefix) != magic {
+		return errors.New("encrypt.Writer.SetResumeHeader: stream has no header")
+	}
+	h, _, err := readHeader(r, w.key, nil)
+	if err != nil {
+		return err
+	}
+	if h.chained || h.toc || h.trailer || h.checksums {
+		return errors.New("encrypt.Writer.SetResumeHeader: stream can't be resumed")
+	}
+	w.header = h
+	w.chunk = nil
+	if h.chunkSize != 0 {
+		w.chunk = make([]byte, h.chunkSize)
+	}
+	return nil
+}
+
+// resumedSize returns the size of the plaintext that was written by an earlier Writer.
+func (w *Writer) resumedSize() int64 {
+	if !w.resumed {
+		return 0
+	}
+	if w.header != nil && w.header.chunkSize != 0 {
+		return w.resumeFrom * int64(w.header.chunkSize)
+	}
+	return w.resumeFrom * chunkSize
+}
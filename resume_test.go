@@ -0,0 +1,77 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+// flakyWriter stores everything written to it until the write numbered failAt, which fails.
+type flakyWriter struct {
+	bytes.Buffer
+	failAt int
+	n      int
+}
+
+func (w *flakyWriter) Write(p []byte) (int, error) {
+	w.n++
+	if w.n == w.failAt {
+		return 0, errors.New("connection reset")
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestNewResumeWriter(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+
+	for _, withHeader := range []bool{false, true} {
+		// the upload fails after two chunks were sent
+		upload := &flakyWriter{failAt: 3}
+		w := encrypt.NewWriter(upload, key)
+		if withHeader {
+			w.SetMetadata(map[string]string{"name": "backup.tar"})
+		}
+		w.Write(plaintext)
+		if err := w.Close(); err == nil {
+			t.Fatal("expected the upload to fail")
+		}
+
+		const sent = 2
+		w = encrypt.NewResumeWriter(upload, key, sent)
+		if withHeader {
+			if err := w.SetResumeHeader(bytes.NewReader(upload.Bytes())); err != nil {
+				t.Fatal(err)
+			}
+		}
+		upload.failAt = 0
+		w.Write(plaintext[sent*chunkSize:])
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		r := encrypt.NewReader(bytes.NewReader(upload.Bytes()), key)
+		decrypted, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("header %t: %v", withHeader, err)
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("header %t: plaintext does not match", withHeader)
+		}
+	}
+
+	// records are bound to the header, so a stream with a header can't be resumed without it
+	w := encrypt.NewResumeWriter(&bytes.Buffer{}, key, 2)
+	w.SetMetadata(map[string]string{"name": "backup.tar"})
+	w.Write([]byte("Hello, world!"))
+	if err := w.Close(); err == nil {
+		t.Errorf("expected an error for a stream with a header without SetResumeHeader")
+	}
+
+	if _, err := encrypt.NewResumeWriter(&bytes.Buffer{}, key, -1).Write([]byte("Hello, world!")); err == nil {
+		t.Errorf("expected an error for a negative chunk")
+	}
+}
@@ -0,0 +1,70 @@
+package encrypt
+
+import (
+	"errors"
+	"io"
+	"sort"
+)
+
+// PrevChunk returns the plaintext of the chunks of the stream in reverse order,
+// starting with the final chunk and moving toward the start with each call,
+// and returns io.EOF once the first chunk has been returned.
+// This suits programs such as log viewers that show the newest data first.
+//
+// Each call seeks to the start of its chunk and decrypts only that chunk,
+// so PrevChunk has the same requirements as Seek with io.SeekEnd:
+// the underlying reader must implement io.Seeker and its size must be known.
+// Streams whose chunks vary in size also need a table of contents from Writer.EnableTOC.
+// Calls to Read continue from the end of the chunk most recently returned by PrevChunk.
+// PrevChunk is not supported for a Reader from NewSection.
+func (r *Reader) PrevChunk() ([]byte, error) {
+	if r.section {
+		return nil, errors.New("encrypt.Reader.PrevChunk: not supported for sections")
+	}
+	if !r.reversing {
+		size, err := r.plaintextSize()
+		if err != nil {
+			return nil, err
+		}
+		r.prevEnd = size
+		r.reversing = true
+	}
+	if r.prevEnd <= 0 {
+		return nil, io.EOF
+	}
+	start, err := r.chunkStart(r.prevEnd - 1)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, r.prevEnd-start)
+	if _, err := io.ReadFull(r, plaintext); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	r.prevEnd = start
+	return plaintext, nil
+}
+
+// chunkStart returns the plaintext offset of the start of the chunk that holds plaintextOffset.
+func (r *Reader) chunkStart(plaintextOffset int64) (int64, error) {
+	if r.header == nil || !r.header.toc {
+		chunkSize := int64(r.chunkSize())
+		return plaintextOffset / chunkSize * chunkSize, nil
+	}
+	toc, err := r.TOC()
+	if err != nil {
+		return 0, err
+	}
+	i := sort.Search(len(toc), func(i int) bool {
+		return toc[i].PlaintextOffset+int64(toc[i].PlaintextLength) > plaintextOffset
+	})
+	if i == len(toc) {
+		return 0, errors.New("encrypt: table of contents doesn't cover the stream")
+	}
+	return toc[i].PlaintextOffset, nil
+}
@@ -0,0 +1,77 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestReader_PrevChunk(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := make([]byte, encrypt.ChunkSize*3+10)
+	for i := range plaintext {
+		plaintext[i] = byte(i * 3)
+	}
+	tests := map[string]func(w *encrypt.Writer){
+		"headerless": func(w *encrypt.Writer) { w.Write(plaintext) },
+		"chunk size": func(w *encrypt.Writer) {
+			w.SetChunkSize(4096)
+			w.Write(plaintext)
+		},
+		"toc": func(w *encrypt.Writer) {
+			// Flush produces chunks of irregular sizes
+			w.EnableTOC()
+			for p := plaintext; len(p) > 0; {
+				n := 10000
+				if n > len(p) {
+					n = len(p)
+				}
+				w.Write(p[:n])
+				w.Flush()
+				p = p[n:]
+			}
+		},
+	}
+	for name, write := range tests {
+		t.Run(name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			w := encrypt.NewWriter(buf, key)
+			write(w)
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			r := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+			var chunks [][]byte
+			for {
+				chunk, err := r.PrevChunk()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				chunks = append(chunks, chunk)
+			}
+			var got []byte
+			for i := len(chunks) - 1; i >= 0; i-- {
+				got = append(got, chunks[i]...)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("chunks in reverse don't match the plaintext")
+			}
+			if _, err := r.PrevChunk(); err != io.EOF {
+				t.Errorf("expected io.EOF to repeat; got %v", err)
+			}
+		})
+	}
+
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.Write(plaintext)
+	w.Close()
+	if _, err := encrypt.NewReader(buf, key).PrevChunk(); err == nil {
+		t.Errorf("expected an error for a source of unknown size")
+	}
+}
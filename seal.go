@@ -0,0 +1,269 @@
+package encrypt
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The first byte of a message from Seal and the functions like it identifies the format and AEAD that encrypted it,
+// and is authenticated along with the message.
+// Each format has its own byte, so a message can't be opened as another format;
+// other values are reserved for future formats and algorithms.
+const (
+	sealAESGCM      = 1 // sealAESGCM identifies an AES-GCM message from Seal or SealWithAAD
+	sealFixedAESGCM = 2 // sealFixedAESGCM identifies a padded AES-GCM message from SealFixed
+)
+
+// Seal encrypts plaintext with key as a single compact message for small values such as tokens and cookies.
+// The output is a byte identifying the algorithm followed by nonce|ciphertext|tag,
+// and must be decrypted by Open.
+// The algorithm byte is authenticated, so a message can't be reinterpreted as another algorithm.
+//
+// For large values, use Writer, whose header records the same information for a stream.
+func Seal(plaintext []byte, key Key) ([]byte, error) {
+	gcm, err := AEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	ad := []byte{sealAESGCM}
+	sealed, err := encrypt(gcm, plaintext, ad)
+	if err != nil {
+		return nil, err
+	}
+	return append(ad, sealed...), nil
+}
+
+// Open decrypts ciphertext that was encrypted by Seal using key,
+// using the algorithm identified by its first byte.
+func Open(ciphertext []byte, key Key) ([]byte, error) {
+	if len(ciphertext) == 0 {
+		return nil, errors.New("encrypt.Open: malformed ciphertext")
+	}
+	switch ciphertext[0] {
+	case sealAESGCM:
+		gcm, err := AEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		return decrypt(gcm, nil, ciphertext[1:], ciphertext[:1])
+	case sealFixedAESGCM:
+		return nil, errors.New("encrypt.Open: message is from SealFixed and must be opened by OpenFixed")
+	default:
+		return nil, fmt.Errorf("encrypt.Open: unsupported algorithm %d", ciphertext[0])
+	}
+}
+
+// SealTo encrypts plaintext with key and appends the result to dst, returning the updated slice.
+// Like append, the capacity of dst is reused when it is large enough,
+// which avoids allocations when encrypting many small messages into reused buffers.
+// The output is a headerless stream in the same format written by Writer,
+// so it can be decrypted by NewReader or OpenTo.
+// The remaining capacity of dst must not overlap plaintext.
+func SealTo(dst, plaintext []byte, key Key) ([]byte, error) {
+	gcm, err := AEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if n := len(dst) + int(EncryptedSize(int64(len(plaintext)))); n > cap(dst) {
+		grown := make([]byte, len(dst), n)
+		copy(grown, dst)
+		dst = grown
+	}
+	for len(plaintext) > 0 {
+		chunk := plaintext
+		if len(chunk) > chunkSize {
+			chunk = chunk[:chunkSize]
+		}
+		plaintext = plaintext[len(chunk):]
+
+		nonce := dst[len(dst) : len(dst)+nonceSize]
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, fmt.Errorf("encrypt.SealTo: crypto.rand.Reader failed: %w", err)
+		}
+		dst = gcm.Seal(dst[:len(dst)+nonceSize], nonce, chunk, nil)
+	}
+	return dst, nil
+}
+
+// OpenTo decrypts ciphertext that was encrypted by a Writer using key into dst,
+// returning the number of bytes of plaintext written.
+// This avoids allocating a new plaintext slice for each message,
+// which is useful when decrypting many small messages into reused buffers.
+//
+// OpenTo returns an error wrapping io.ErrShortBuffer if dst is too small to hold the plaintext.
+// The contents of dst are unspecified when an error is returned.
+// Only headerless streams are supported.
+func OpenTo(dst, ciphertext []byte, key Key) (int, error) {
+	gcm, err := AEAD(key)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for len(ciphertext) > 0 {
+		sector := ciphertext
+		if len(sector) > SectorSize {
+			sector = sector[:SectorSize]
+		}
+		ciphertext = ciphertext[len(sector):]
+		if len(sector)-nonceSize-tagSize > len(dst)-n {
+			return 0, fmt.Errorf("encrypt.OpenTo: %w", io.ErrShortBuffer)
+		}
+		// the capacity limit guarantees the plaintext is written into dst rather than a new slice
+		plaintext, err := decrypt(gcm, dst[n:n:len(dst)], sector, nil)
+		if err != nil {
+			return 0, err
+		}
+		n += len(plaintext)
+	}
+	return n, nil
+}
+
+// SealWithAAD encrypts plaintext with key as a single message like Seal,
+// authenticating aad without including it in the output.
+// This binds the ciphertext to its context, such as the primary key of the database row that stores it,
+// so that it can't be moved to a different context without failing to decrypt.
+// The output begins with the same algorithm byte as the output of Seal,
+// which is authenticated along with aad.
+//
+// SealWithAAD is intended for small values;
+// the output must be decrypted by OpenWithAAD with the same aad.
+func SealWithAAD(plaintext, aad []byte, key Key) ([]byte, error) {
+	gcm, err := AEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	prefix := []byte{sealAESGCM}
+	return encryptTo(gcm, prefix, plaintext, append(prefix[:1:1], aad...))
+}
+
+// OpenWithAAD decrypts ciphertext that was encrypted by SealWithAAD using key and aad,
+// using the algorithm identified by its first byte.
+// If aad doesn't match, ErrAuthFailed is returned.
+func OpenWithAAD(ciphertext, aad []byte, key Key) ([]byte, error) {
+	if len(ciphertext) == 0 {
+		return nil, errors.New("encrypt.OpenWithAAD: malformed ciphertext")
+	}
+	if ciphertext[0] != sealAESGCM {
+		return nil, fmt.Errorf("encrypt.OpenWithAAD: unsupported algorithm %d", ciphertext[0])
+	}
+	gcm, err := AEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return decrypt(gcm, nil, ciphertext[1:], append(ciphertext[:1:1], aad...))
+}
+
+// OpenSingle decrypts ciphertext that was encrypted with key as a single AES-GCM message
+// of the form nonce|ciphertext|tag, using a 12-byte nonce and no additional data.
+// This is the format of data sealed whole with cipher.AEAD.Seal rather than split into chunks,
+// and provides a way to migrate such data into streams written by Writer.
+// Unlike Open, the message has no algorithm byte, and unlike Reader, it may be of any length.
+func OpenSingle(ciphertext []byte, key Key) ([]byte, error) {
+	gcm, err := AEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return decrypt(gcm, nil, ciphertext, nil)
+}
+
+// EncryptAll encrypts plaintext with key, returning a headerless stream in the format written by NewWriter.
+// The result is allocated once at its final size.
+// Empty plaintext produces an empty result, which DecryptAll returns as empty plaintext,
+// but which can't be told apart from a stream that was truncated to nothing;
+// a Writer with a header, such as from SetMetadata, writes an end record even for empty input.
+func EncryptAll(plaintext []byte, key Key) ([]byte, error) {
+	return SealTo(make([]byte, 0, EncryptedSize(int64(len(plaintext)))), plaintext, key)
+}
+
+// DecryptAll reads and decrypts all of r, which was encrypted by a Writer using key.
+// When the size of r can be determined, such as for *os.File or *bytes.Reader,
+// the result is allocated once at its final size instead of growing as it is read.
+func DecryptAll(r io.Reader, key Key) ([]byte, error) {
+	reader := NewReader(r, key)
+	size, err := reader.plaintextSize()
+	if err != nil {
+		// the size is unknown, so the result grows as it is read
+		return io.ReadAll(reader)
+	}
+	plaintext := make([]byte, 0, size)
+	for {
+		if len(plaintext) == cap(plaintext) {
+			// the source was larger than expected; the extra byte reports EOF or the remaining data
+			var b [1]byte
+			n, err := reader.Read(b[:])
+			if err == io.EOF {
+				return plaintext, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			plaintext = append(plaintext, b[:n]...)
+			continue
+		}
+		n, err := reader.Read(plaintext[len(plaintext):cap(plaintext)])
+		plaintext = plaintext[:len(plaintext)+n]
+		if err == io.EOF {
+			return plaintext, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// fixedLengthSize is the size of the length of the plaintext sealed in a message from SealFixed.
+const fixedLengthSize = 4
+
+// SealFixed encrypts plaintext with key as a single message whose size depends only on recordLen,
+// by padding the plaintext with zeroes to recordLen bytes before encrypting it.
+// This hides the lengths of values that are stored together, such as the cells of a database column,
+// where longer ciphertext would otherwise reveal longer values.
+// The output is always recordLen+33 bytes long, beginning with a byte that identifies the format,
+// and must be decrypted by OpenFixed.
+//
+// recordLen may be at most 16 MiB, and an error is returned if plaintext is longer than recordLen.
+func SealFixed(plaintext []byte, key Key, recordLen int) ([]byte, error) {
+	if recordLen < 0 || recordLen > maxChunkSize {
+		return nil, fmt.Errorf("encrypt.SealFixed: invalid record length %d", recordLen)
+	}
+	if len(plaintext) > recordLen {
+		return nil, fmt.Errorf("encrypt.SealFixed: %d bytes of plaintext exceeds the record length of %d", len(plaintext), recordLen)
+	}
+	gcm, err := AEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	// the length is encrypted along with the padding, so only the record length is visible
+	padded := make([]byte, fixedLengthSize+recordLen)
+	binary.BigEndian.PutUint32(padded, uint32(len(plaintext)))
+	copy(padded[fixedLengthSize:], plaintext)
+	ad := []byte{sealFixedAESGCM}
+	return encryptTo(gcm, ad, padded, ad)
+}
+
+// OpenFixed decrypts ciphertext that was encrypted by SealFixed using key,
+// removing the padding.
+func OpenFixed(ciphertext []byte, key Key) ([]byte, error) {
+	if len(ciphertext) == 0 || ciphertext[0] != sealFixedAESGCM {
+		return nil, errors.New("encrypt.OpenFixed: malformed ciphertext")
+	}
+	gcm, err := AEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	padded, err := decrypt(gcm, nil, ciphertext[1:], ciphertext[:1])
+	if err != nil {
+		return nil, err
+	}
+	if len(padded) < fixedLengthSize {
+		return nil, errors.New("encrypt.OpenFixed: malformed ciphertext")
+	}
+	n := binary.BigEndian.Uint32(padded)
+	if uint64(n) > uint64(len(padded)-fixedLengthSize) {
+		return nil, errors.New("encrypt.OpenFixed: malformed ciphertext")
+	}
+	return padded[fixedLengthSize : fixedLengthSize+int(n)], nil
+}
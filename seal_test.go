@@ -0,0 +1,277 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestOpenTo(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	for _, plaintext := range [][]byte{nil, []byte("Hello, world!"), plaintextData()} {
+		buf := &bytes.Buffer{}
+		w := encrypt.NewWriter(buf, key)
+		w.Write(plaintext)
+		w.Close()
+		ciphertext := buf.Bytes()
+
+		dst := make([]byte, len(plaintext))
+		n, err := encrypt.OpenTo(dst, ciphertext, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(dst[:n], plaintext) {
+			t.Errorf("plaintext does not match")
+		}
+
+		if len(plaintext) > 0 {
+			if _, err := encrypt.OpenTo(dst[:len(dst)-1], ciphertext, key); !errors.Is(err, io.ErrShortBuffer) {
+				t.Errorf("expected io.ErrShortBuffer; got %v", err)
+			}
+			ciphertext[len(ciphertext)-1] ^= 0xff
+			if _, err := encrypt.OpenTo(dst, ciphertext, key); err == nil {
+				t.Errorf("expected a decryption error")
+			}
+		}
+	}
+}
+
+func BenchmarkOpenTo(b *testing.B) {
+	key, _ := encrypt.NewKey()
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.Write(make([]byte, 256))
+	w.Close()
+	ciphertext := buf.Bytes()
+	dst := make([]byte, 256)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := encrypt.OpenTo(dst, ciphertext, key); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestSealTo(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	prefix := []byte("prefix")
+	for _, plaintext := range [][]byte{nil, []byte("Hello, world!"), plaintextData()} {
+		buf := make([]byte, len(prefix), 1<<20)
+		copy(buf, prefix)
+		sealed, err := encrypt.SealTo(buf, plaintext, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(sealed[:len(prefix)], prefix) {
+			t.Errorf("expected the contents of dst to be preserved")
+		}
+		if &sealed[0] != &buf[0] {
+			t.Errorf("expected the capacity of dst to be reused")
+		}
+		decrypted, err := io.ReadAll(encrypt.NewReader(bytes.NewReader(sealed[len(prefix):]), key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("plaintext does not match")
+		}
+	}
+
+	sealed, err := encrypt.SealTo(nil, plaintextData(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := len(plaintextData()) + 3*encrypt.Overhead; len(sealed) != expected || cap(sealed) != expected {
+		t.Errorf("expected a single allocation of %d bytes; got len %d cap %d", expected, len(sealed), cap(sealed))
+	}
+}
+
+func BenchmarkSealTo(b *testing.B) {
+	key, _ := encrypt.NewKey()
+	plaintext := make([]byte, 256)
+	dst := make([]byte, 0, 512)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := encrypt.SealTo(dst[:0], plaintext, key); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestSealWithAAD(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := []byte("4111 1111 1111 1111")
+	sealed, err := encrypt.SealWithAAD(plaintext, []byte("customer:42"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened, err := encrypt.OpenWithAAD(sealed, []byte("customer:42"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("plaintext does not match")
+	}
+	for _, aad := range [][]byte{nil, []byte("customer:43")} {
+		if _, err := encrypt.OpenWithAAD(sealed, aad, key); !errors.Is(err, encrypt.ErrAuthFailed) {
+			t.Errorf("aad %q: expected ErrAuthFailed; got %v", aad, err)
+		}
+	}
+
+	// the algorithm byte is shared with Seal and authenticated
+	if sealed[0] != 1 {
+		t.Errorf("expected the algorithm byte of Seal; got %d", sealed[0])
+	}
+	unknown := append([]byte{}, sealed...)
+	unknown[0] = 0xff
+	if _, err := encrypt.OpenWithAAD(unknown, []byte("customer:42"), key); err == nil {
+		t.Errorf("expected an error for an unsupported algorithm")
+	}
+	for _, ciphertext := range [][]byte{nil, sealed[:1]} {
+		if _, err := encrypt.OpenWithAAD(ciphertext, []byte("customer:42"), key); err == nil {
+			t.Errorf("expected an error opening %d bytes", len(ciphertext))
+		}
+	}
+}
+
+func TestEncryptAll(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	for _, plaintext := range [][]byte{nil, []byte("Hello, world!"), plaintextData()} {
+		ciphertext, err := encrypt.EncryptAll(plaintext, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(len(ciphertext)) != encrypt.EncryptedSize(int64(len(plaintext))) || len(ciphertext) != cap(ciphertext) {
+			t.Errorf("expected the result to be allocated at its final size")
+		}
+		if size, err := encrypt.DecryptedSize(int64(len(ciphertext))); err != nil || size != int64(len(plaintext)) {
+			t.Errorf("expected DecryptedSize %d/nil; got %d/%v", len(plaintext), size, err)
+		}
+
+		// with and without a known source size
+		for _, src := range []io.Reader{bytes.NewReader(ciphertext), io.MultiReader(bytes.NewReader(ciphertext))} {
+			decrypted, err := encrypt.DecryptAll(src, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decrypted, plaintext) {
+				t.Errorf("plaintext does not match")
+			}
+		}
+	}
+	if _, err := encrypt.DecryptedSize(1); err == nil {
+		t.Errorf("expected an error for an invalid ciphertext size")
+	}
+}
+
+func BenchmarkDecryptAll(b *testing.B) {
+	key, _ := encrypt.NewKey()
+	ciphertext, _ := encrypt.EncryptAll(make([]byte, 4<<20), key)
+	b.ReportAllocs()
+	b.SetBytes(4 << 20)
+	for i := 0; i < b.N; i++ {
+		if _, err := encrypt.DecryptAll(bytes.NewReader(ciphertext), key); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestOpenSingle(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	// legacy data sealed in one piece
+	block, _ := aes.NewCipher(key[:])
+	gcm, _ := cipher.NewGCM(block)
+	nonce := make([]byte, gcm.NonceSize())
+	rand.Read(nonce)
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
+
+	opened, err := encrypt.OpenSingle(ciphertext, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("plaintext does not match")
+	}
+	ciphertext[len(ciphertext)/2] ^= 0xff
+	if _, err := encrypt.OpenSingle(ciphertext, key); !errors.Is(err, encrypt.ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed; got %v", err)
+	}
+}
+
+func TestSeal(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := []byte("session=abc123")
+	sealed, err := encrypt.Seal(plaintext, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// one byte of overhead beyond the nonce and tag
+	if expected := 1 + 12 + len(plaintext) + 16; len(sealed) != expected {
+		t.Errorf("expected %d bytes; got %d", expected, len(sealed))
+	}
+	opened, err := encrypt.Open(sealed, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("plaintext does not match")
+	}
+
+	unknown := append([]byte{}, sealed...)
+	unknown[0] = 0xff
+	if _, err := encrypt.Open(unknown, key); err == nil {
+		t.Errorf("expected an error for an unsupported algorithm")
+	}
+	for _, ciphertext := range [][]byte{nil, sealed[:1], sealed[:len(sealed)-1]} {
+		if _, err := encrypt.Open(ciphertext, key); err == nil {
+			t.Errorf("expected an error opening %d bytes", len(ciphertext))
+		}
+	}
+}
+
+func TestSealFixed(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	const recordLen = 64
+	for _, plaintext := range []string{"", "a", "a longer value", strings.Repeat("x", recordLen)} {
+		ciphertext, err := encrypt.SealFixed([]byte(plaintext), key, recordLen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ciphertext) != recordLen+33 {
+			t.Errorf("expected %d bytes for %q; got %d", recordLen+33, plaintext, len(ciphertext))
+		}
+		got, err := encrypt.OpenFixed(ciphertext, key)
+		if err != nil || string(got) != plaintext {
+			t.Errorf("expected %q/nil; got %q/%v", plaintext, got, err)
+		}
+	}
+	if _, err := encrypt.SealFixed(make([]byte, recordLen+1), key, recordLen); err == nil {
+		t.Errorf("expected an error for plaintext longer than the record")
+	}
+
+	ciphertext, _ := encrypt.SealFixed([]byte("value"), key, recordLen)
+	ciphertext[len(ciphertext)-1] ^= 1
+	if _, err := encrypt.OpenFixed(ciphertext, key); !errors.Is(err, encrypt.ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed; got %v", err)
+	}
+	sealed, _ := encrypt.Seal([]byte("value"), key)
+	if _, err := encrypt.OpenFixed(sealed, key); err == nil {
+		t.Errorf("expected an error for a message from Seal")
+	}
+	// the formats are identified by different bytes
+	fixed, _ := encrypt.SealFixed([]byte("value"), key, recordLen)
+	if fixed[0] == sealed[0] {
+		t.Errorf("expected SealFixed and Seal to use different format bytes; both use %d", fixed[0])
+	}
+	if _, err := encrypt.Open(fixed, key); err == nil {
+		t.Errorf("expected an error opening a message from SealFixed with Open")
+	}
+}
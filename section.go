@@ -0,0 +1,28 @@
+package encrypt
+
+import "io"
+
+// NewSection returns a Reader that decrypts the n bytes of plaintext starting at offset off
+// of r, which is size bytes long and was encrypted by a Writer using key.
+// Like io.NewSectionReader, Read returns io.EOF at the end of the section
+// and Seek positions are relative to its start.
+//
+// Each section reads r with io.ReaderAt and keeps its own position,
+// so sections of the same stream may be read concurrently, for example to process ranges in parallel.
+// An error positioning the section at off is returned by the first Read.
+func NewSection(r io.ReaderAt, size int64, key Key, off, n int64) *Reader {
+	reader := &Reader{
+		r:       io.NewSectionReader(r, 0, size),
+		key:     key,
+		size:    size,
+		sized:   true,
+		limit:   off + n,
+		limited: true,
+		section: true,
+		start:   off,
+	}
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		reader.err = err
+	}
+	return reader
+}
@@ -0,0 +1,62 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestNewSection(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	for _, withHeader := range []bool{false, true} {
+		buf := &bytes.Buffer{}
+		w := encrypt.NewWriter(buf, key)
+		if withHeader {
+			w.SetMetadata(nil)
+		}
+		w.Write(plaintext)
+		w.Close()
+		src := bytes.NewReader(buf.Bytes())
+
+		// sections are read concurrently from the same source
+		bounds := []int64{0, 1000, chunkSize + 7, 100000, int64(len(plaintext))}
+		var wg sync.WaitGroup
+		for i := 0; i < len(bounds)-1; i++ {
+			off, n := bounds[i], bounds[i+1]-bounds[i]
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				got, err := io.ReadAll(encrypt.NewSection(src, src.Size(), key, off, n))
+				if err != nil {
+					t.Errorf("header %t, section at %d: %v", withHeader, off, err)
+				}
+				if !bytes.Equal(got, plaintext[off:off+n]) {
+					t.Errorf("header %t, section at %d: plaintext does not match", withHeader, off)
+				}
+			}()
+		}
+		wg.Wait()
+
+		section := encrypt.NewSection(src, src.Size(), key, 1000, 5000)
+		if n, err := section.Seek(0, io.SeekEnd); n != 5000 || err != nil {
+			t.Errorf("header %t: expected the end of the section at 5000/nil; got %d/%v", withHeader, n, err)
+		}
+		if n, err := section.Seek(10, io.SeekStart); n != 10 || err != nil {
+			t.Fatalf("header %t: expected 10/nil; got %d/%v", withHeader, n, err)
+		}
+		got, err := io.ReadAll(section)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, plaintext[1010:6000]) {
+			t.Errorf("header %t: expected the section to be read from its relative offset", withHeader)
+		}
+		if _, err := section.Seek(-1, io.SeekStart); err == nil {
+			t.Errorf("header %t: expected an error seeking before the start of the section", withHeader)
+		}
+	}
+}
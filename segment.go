@@ -0,0 +1,104 @@
+package encrypt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// SegmentReader decrypts a concatenation of streams that may each be encrypted with a different key.
+// It is created by NewReaderFunc.
+type SegmentReader struct {
+	r       io.Reader
+	resolve func(keyID []byte) (Key, bool)
+	cur     *Reader
+	hdr     Header
+	n       int // n is the number of segments started so far
+	err     error
+}
+
+// NewReaderFunc returns a SegmentReader that decrypts r,
+// a concatenation of segments that were each written by a Writer with a header,
+// such as one with metadata, a table of contents, or a trailer.
+// The key of each segment is found by calling resolve with the fingerprint recorded in its header,
+// which is the Key.Fingerprint of the key that encrypted it,
+// so archives can hold data from many tenants or key generations and still be decrypted in one pass.
+//
+// Headerless segments can't be used, since nothing marks where they end,
+// and neither can padded segments.
+// An error is returned if resolve doesn't know the key of a segment.
+func NewReaderFunc(r io.Reader, resolve func(keyID []byte) (Key, bool)) *SegmentReader {
+	return &SegmentReader{r: r, resolve: resolve}
+}
+
+// Read implements io.Reader.
+func (s *SegmentReader) Read(p []byte) (int, error) {
+	for s.err == nil {
+		if s.cur == nil {
+			s.err = s.next()
+			continue
+		}
+		n, err := s.cur.Read(p)
+		if err == io.EOF {
+			s.err = s.skipTail()
+			s.cur = nil
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+	return 0, s.err
+}
+
+// next starts reading the next segment, returning io.EOF if there are no more.
+func (s *SegmentReader) next() error {
+	hdr, src, err := ReadHeader(s.r)
+	if err != nil {
+		return fmt.Errorf("encrypt: segment %d: %w", s.n, err)
+	}
+	if hdr.Version == 0 {
+		// ReadHeader only reports a headerless stream when no magic string was found
+		if _, err := src.Read(make([]byte, 1)); err == io.EOF {
+			return io.EOF
+		}
+		return fmt.Errorf("encrypt: segment %d doesn't have a header", s.n)
+	}
+	if hdr.Padded {
+		return fmt.Errorf("encrypt: segment %d is padded", s.n)
+	}
+	key, ok := s.resolve(hdr.Fingerprint)
+	if !ok {
+		return fmt.Errorf("encrypt: no key for segment %d with fingerprint %x", s.n, hdr.Fingerprint)
+	}
+	s.cur = NewReader(src, key)
+	s.hdr = hdr
+	s.n++
+	return nil
+}
+
+// skipTail consumes anything that follows the end record of the current segment,
+// which a Reader stops before.
+func (s *SegmentReader) skipTail() error {
+	if s.hdr.TOC {
+		// the table of contents is a record followed by its size
+		var prefix [recordHeaderSize]byte
+		if _, err := io.ReadFull(s.r, prefix[:]); err != nil {
+			return truncated(err)
+		}
+		n := int64(binary.BigEndian.Uint32(prefix[1:])) + 8
+		if prefix[0] != recordTOC {
+			return errors.New("encrypt: malformed table of contents")
+		}
+		if _, err := io.CopyN(io.Discard, s.r, n); err != nil {
+			return truncated(err)
+		}
+	}
+	if s.hdr.Trailer {
+		if _, err := io.CopyN(io.Discard, s.r, trailerSize); err != nil {
+			return truncated(err)
+		}
+	}
+	return nil
+}
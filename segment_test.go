@@ -0,0 +1,64 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestNewReaderFunc(t *testing.T) {
+	keys := map[string]encrypt.Key{}
+	resolve := func(keyID []byte) (encrypt.Key, bool) {
+		key, ok := keys[string(keyID)]
+		return key, ok
+	}
+	archive := &bytes.Buffer{}
+	var plaintext []byte
+	setups := []func(w *encrypt.Writer) error{
+		func(w *encrypt.Writer) error { return w.SetMetadata(map[string]string{"tenant": "a"}) },
+		func(w *encrypt.Writer) error { return w.SetChunkSize(1024) },
+		func(w *encrypt.Writer) error { return w.EnableTOC() },
+		func(w *encrypt.Writer) error { return w.EnableTrailer() },
+		func(w *encrypt.Writer) error { return w.EnableChain() },
+	}
+	for i, setup := range setups {
+		key, _ := encrypt.NewKey()
+		keys[string(key.Fingerprint())] = key
+		w := encrypt.NewWriter(archive, key)
+		if err := setup(w); err != nil {
+			t.Fatal(err)
+		}
+		segment := bytes.Repeat([]byte{byte('a' + i)}, 3000*i)
+		w.Write(segment)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		plaintext = append(plaintext, segment...)
+	}
+
+	got, err := io.ReadAll(encrypt.NewReaderFunc(bytes.NewReader(archive.Bytes()), resolve))
+	if err != nil || !bytes.Equal(got, plaintext) {
+		t.Errorf("decrypted archive doesn't match: %v", err)
+	}
+
+	unknown, _ := encrypt.NewKey()
+	w := encrypt.NewWriter(archive, unknown)
+	w.SetMetadata(map[string]string{"tenant": "b"})
+	w.Write([]byte("unknown"))
+	w.Close()
+	_, err = io.ReadAll(encrypt.NewReaderFunc(bytes.NewReader(archive.Bytes()), resolve))
+	if err == nil || !strings.Contains(err.Error(), "no key for segment 5") {
+		t.Errorf("expected an error for the unknown key; got %v", err)
+	}
+
+	headerless := &bytes.Buffer{}
+	w = encrypt.NewWriter(headerless, unknown)
+	w.Write([]byte("headerless"))
+	w.Close()
+	if _, err := io.ReadAll(encrypt.NewReaderFunc(headerless, resolve)); err == nil {
+		t.Errorf("expected an error for a headerless segment")
+	}
+}
@@ -0,0 +1,245 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// NewGCMSIV returns AES-GCM-SIV as defined by RFC 8452, using a 16- or 32-byte key.
+// Unlike AES-GCM, reusing a nonce with AES-GCM-SIV only reveals whether two chunks
+// with the same nonce and additional data are identical,
+// rather than compromising the key and the confidentiality of both chunks.
+//
+// The standard library does not provide AES-GCM-SIV, so it is implemented here on top of crypto/aes.
+// It is suitable for use with NewWriterAEAD,
+// although NewWriterGCMSIV also records the choice of cipher in the stream.
+func NewGCMSIV(key []byte) (cipher.AEAD, error) {
+	if len(key) != 16 && len(key) != 32 {
+		return nil, fmt.Errorf("encrypt.NewGCMSIV: %w", KeySizeError(len(key)))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &gcmSIV{block: block, keySize: len(key)}, nil
+}
+
+// NewWriterGCMSIV returns a new Writer that encrypts data with key before writing to w,
+// using AES-GCM-SIV instead of AES-GCM.
+// This protects the stream from a faulty random number generator that repeats nonces,
+// at the cost of slower encryption.
+//
+// The cipher is recorded in the stream header, so the output can be decrypted by NewReader.
+// Callers must call Close to write the final chunk of data.
+func NewWriterGCMSIV(w io.Writer, key Key) *Writer {
+	return &Writer{
+		w:      w,
+		key:    key,
+		header: &header{cipher: cipherGCMSIV},
+	}
+}
+
+const sivNonceSize = 12
+
+// gcmSIV implements cipher.AEAD for AES-GCM-SIV.
+type gcmSIV struct {
+	block   cipher.Block // block is keyed with the key-generating key
+	keySize int
+}
+
+func (g *gcmSIV) NonceSize() int { return sivNonceSize }
+func (g *gcmSIV) Overhead() int  { return tagSize }
+
+// deriveKeys derives the per-nonce authentication and encryption keys.
+func (g *gcmSIV) deriveKeys(nonce []byte) (authKey []byte, block cipher.Block) {
+	var in, out [aesBlockSize]byte
+	copy(in[4:], nonce)
+	keys := make([]byte, 0, 16+g.keySize)
+	for i := uint32(0); len(keys) < cap(keys); i++ {
+		binary.LittleEndian.PutUint32(in[:4], i)
+		g.block.Encrypt(out[:], in[:])
+		keys = append(keys, out[:8]...)
+	}
+	block, err := aes.NewCipher(keys[16:])
+	if err != nil {
+		// unreachable, since the encryption key is always 16 or 32 bytes
+		panic(err)
+	}
+	return keys[:16], block
+}
+
+// tag computes the authentication tag of plaintext and additionalData.
+func (g *gcmSIV) tag(authKey []byte, block cipher.Block, nonce, plaintext, additionalData []byte) []byte {
+	p := newPolyval(authKey)
+	p.update(additionalData)
+	p.update(plaintext)
+	var lengths [aesBlockSize]byte
+	binary.LittleEndian.PutUint64(lengths[:8], uint64(len(additionalData))*8)
+	binary.LittleEndian.PutUint64(lengths[8:], uint64(len(plaintext))*8)
+	p.update(lengths[:])
+
+	s := p.sum()
+	for i := range nonce {
+		s[i] ^= nonce[i]
+	}
+	s[15] &= 0x7f
+	tag := make([]byte, aesBlockSize)
+	block.Encrypt(tag, s[:])
+	return tag
+}
+
+// ctr xors src with the keystream starting at the counter block derived from tag, writing to dst.
+func (g *gcmSIV) ctr(block cipher.Block, dst, src, tag []byte) {
+	var counter, stream [aesBlockSize]byte
+	copy(counter[:], tag)
+	counter[15] |= 0x80
+	for len(src) > 0 {
+		block.Encrypt(stream[:], counter[:])
+		n := len(src)
+		if n >= aesBlockSize {
+			n = aesBlockSize
+			binary.LittleEndian.PutUint64(dst[:8], binary.LittleEndian.Uint64(src[:8])^binary.LittleEndian.Uint64(stream[:8]))
+			binary.LittleEndian.PutUint64(dst[8:16], binary.LittleEndian.Uint64(src[8:16])^binary.LittleEndian.Uint64(stream[8:]))
+		} else {
+			for i := 0; i < n; i++ {
+				dst[i] = src[i] ^ stream[i]
+			}
+		}
+		dst, src = dst[n:], src[n:]
+		binary.LittleEndian.PutUint32(counter[:4], binary.LittleEndian.Uint32(counter[:4])+1)
+	}
+}
+
+func (g *gcmSIV) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != sivNonceSize {
+		panic("encrypt: incorrect nonce length given to AES-GCM-SIV")
+	}
+	authKey, block := g.deriveKeys(nonce)
+	tag := g.tag(authKey, block, nonce, plaintext, additionalData)
+	ret, out := sliceForAppend(dst, len(plaintext)+tagSize)
+	g.ctr(block, out, plaintext, tag)
+	copy(out[len(plaintext):], tag)
+	return ret
+}
+
+func (g *gcmSIV) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != sivNonceSize {
+		panic("encrypt: incorrect nonce length given to AES-GCM-SIV")
+	}
+	if len(ciphertext) < tagSize {
+		return nil, errors.New("cipher: message authentication failed")
+	}
+	tag := ciphertext[len(ciphertext)-tagSize:]
+	ciphertext = ciphertext[:len(ciphertext)-tagSize]
+	authKey, block := g.deriveKeys(nonce)
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	g.ctr(block, out, ciphertext, tag)
+	if subtle.ConstantTimeCompare(g.tag(authKey, block, nonce, out, additionalData), tag) != 1 {
+		for i := range out {
+			out[i] = 0
+		}
+		return nil, errors.New("cipher: message authentication failed")
+	}
+	return ret, nil
+}
+
+// sliceForAppend extends in by n bytes, returning the whole slice and the extension.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	return head, head[len(in):]
+}
+
+// polyval computes the POLYVAL universal hash from RFC 8452,
+// with field elements held as two little-endian uint64 halves.
+type polyval struct {
+	hLo, hHi uint64
+	sLo, sHi uint64
+}
+
+func newPolyval(key []byte) *polyval {
+	return &polyval{
+		hLo: binary.LittleEndian.Uint64(key[:8]),
+		hHi: binary.LittleEndian.Uint64(key[8:]),
+	}
+}
+
+// update absorbs b, zero-padded to a multiple of the block size.
+func (p *polyval) update(b []byte) {
+	for len(b) >= aesBlockSize {
+		p.sLo ^= binary.LittleEndian.Uint64(b[:8])
+		p.sHi ^= binary.LittleEndian.Uint64(b[8:16])
+		p.sLo, p.sHi = dot(p.sLo, p.sHi, p.hLo, p.hHi)
+		b = b[aesBlockSize:]
+	}
+	if len(b) > 0 {
+		var block [aesBlockSize]byte
+		copy(block[:], b)
+		p.update(block[:])
+	}
+}
+
+func (p *polyval) sum() [aesBlockSize]byte {
+	var s [aesBlockSize]byte
+	binary.LittleEndian.PutUint64(s[:8], p.sLo)
+	binary.LittleEndian.PutUint64(s[8:], p.sHi)
+	return s
+}
+
+// dot returns a*b*x^-128 in the POLYVAL field,
+// which is defined by the polynomial x^128 + x^127 + x^126 + x^121 + 1.
+// The product is computed with three carry-less multiplications (Karatsuba)
+// and reduced as in BoringSSL and Tink, multiplying by x^-128 rather than reducing modulo the polynomial directly.
+func dot(aLo, aHi, bLo, bHi uint64) (lo, hi uint64) {
+	r0Lo, r0Hi := clmul(aLo, bLo)
+	r1Lo, r1Hi := clmul(aHi, bHi)
+	midLo, midHi := clmul(aLo^aHi, bLo^bHi)
+	midLo ^= r0Lo ^ r1Lo
+	midHi ^= r0Hi ^ r1Hi
+	r0Hi ^= midLo
+	r1Lo ^= midHi
+
+	// x^-128 = x^-7 + x^-2 + x^-1 + 1, and the bits shifted below x^0 by the first three terms
+	// are folded back into r0 so that a single reduction suffices
+	r0Hi ^= r0Lo<<63 ^ r0Lo<<62 ^ r0Lo<<57
+	r1Lo ^= r0Lo ^ r0Lo>>1 ^ r0Hi<<63 ^ r0Lo>>2 ^ r0Hi<<62 ^ r0Lo>>7 ^ r0Hi<<57
+	r1Hi ^= r0Hi ^ r0Hi>>1 ^ r0Hi>>2 ^ r0Hi>>7
+	return r1Lo, r1Hi
+}
+
+// clmul returns the 128-bit carry-less product of x and y.
+func clmul(x, y uint64) (lo, hi uint64) {
+	lo = bmul64(x, y)
+	hi = bits.Reverse64(bmul64(bits.Reverse64(x), bits.Reverse64(y))) >> 1
+	return lo, hi
+}
+
+// bmul64 returns the low 64 bits of the carry-less product of x and y, as in BearSSL's ghash_ctmul64.
+// The operands are split into four sets of bits spaced four apart,
+// so that the carries of the integer multiplications never reach a bit that is kept,
+// and the multiplications have no data-dependent timing on common 64-bit platforms.
+func bmul64(x, y uint64) uint64 {
+	const (
+		m0 = 0x1111111111111111
+		m1 = 0x2222222222222222
+		m2 = 0x4444444444444444
+		m3 = 0x8888888888888888
+	)
+	x0, x1, x2, x3 := x&m0, x&m1, x&m2, x&m3
+	y0, y1, y2, y3 := y&m0, y&m1, y&m2, y&m3
+	z0 := x0*y0 ^ x1*y3 ^ x2*y2 ^ x3*y1
+	z1 := x0*y1 ^ x1*y0 ^ x2*y3 ^ x3*y2
+	z2 := x0*y2 ^ x1*y1 ^ x2*y0 ^ x3*y3
+	z3 := x0*y3 ^ x1*y2 ^ x2*y1 ^ x3*y0
+	return z0&m0 | z1&m1 | z2&m2 | z3&m3
+}
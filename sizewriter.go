@@ -0,0 +1,39 @@
+package encrypt
+
+import "errors"
+
+// SizeWriter counts the bytes written to it and reports the size of the stream
+// that NewWriter would produce for them, without encrypting anything.
+// It is useful for computing the encrypted size of streamed input whose length isn't known in advance,
+// such as the output of a transform, before committing to an upload.
+type SizeWriter struct {
+	n      int64
+	closed bool
+}
+
+// NewSizeWriter returns a SizeWriter with nothing written.
+func NewSizeWriter() *SizeWriter {
+	return &SizeWriter{}
+}
+
+// Write counts p as plaintext. It never fails before Close.
+func (w *SizeWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("call to write on closed writer")
+	}
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// Close prevents additional calls to Write, like Writer.Close.
+func (w *SizeWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+// Size returns the number of bytes that a Writer from NewWriter would write
+// for the plaintext counted so far, including the final chunk.
+// It matches Writer.BytesWritten after Close and is final once w is closed.
+func (w *SizeWriter) Size() int64 {
+	return EncryptedSize(w.n)
+}
@@ -0,0 +1,38 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestSizeWriter(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	for _, size := range []int64{0, 1, encrypt.ChunkSize - 1, encrypt.ChunkSize, encrypt.ChunkSize + 1, encrypt.ChunkSize*3 + 7} {
+		buf := &bytes.Buffer{}
+		w := encrypt.NewWriter(buf, key)
+		sw := encrypt.NewSizeWriter()
+		// odd-sized writes cross chunk boundaries at different points than the data
+		src := bytes.NewReader(make([]byte, size))
+		if _, err := io.CopyBuffer(io.MultiWriter(w, sw), src, make([]byte, 1000)); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := sw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if sw.Size() != int64(buf.Len()) {
+			t.Errorf("size %d: expected %d; got %d", size, buf.Len(), sw.Size())
+		}
+	}
+
+	sw := encrypt.NewSizeWriter()
+	sw.Close()
+	if _, err := sw.Write([]byte("x")); err == nil {
+		t.Errorf("expected an error writing to a closed SizeWriter")
+	}
+}
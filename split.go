@@ -0,0 +1,80 @@
+package encrypt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// DecryptSplit decrypts src, which was encrypted by a Writer using key,
+// and splits the plaintext into documents separated by sep,
+// writing each document to a writer returned by next.
+// next is called with index 0 before anything is written and again with the next index after each separator,
+// so like strings.Split, a stream containing n separators produces n+1 documents, some of which may be empty.
+// The separators themselves aren't written, and may span chunk boundaries.
+// Each writer is closed before next is called for the following document.
+//
+// The plaintext is streamed, so memory use doesn't depend on the size of the documents.
+// Since each document is written as it is decrypted,
+// a document may be partly written before an error such as ErrAuthFailed is returned;
+// the writer is still closed in that case.
+func DecryptSplit(src io.Reader, key Key, sep []byte, next func(index int) (io.WriteCloser, error)) error {
+	if len(sep) == 0 {
+		return errors.New("encrypt.DecryptSplit: empty separator")
+	}
+	index := 0
+	w, err := next(index)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if w != nil {
+			w.Close()
+		}
+	}()
+	r := NewReader(src, key)
+	// buf holds plaintext that hasn't been written yet,
+	// which is never more than the start of a separator between reads
+	buf := make([]byte, 0, chunkSize+len(sep))
+	for {
+		n, rerr := r.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if rerr != nil && rerr != io.EOF {
+			return rerr
+		}
+		for {
+			i := bytes.Index(buf, sep)
+			if i < 0 {
+				break
+			}
+			if _, err := w.Write(buf[:i]); err != nil {
+				return err
+			}
+			err := w.Close()
+			w = nil
+			if err != nil {
+				return err
+			}
+			index++
+			if w, err = next(index); err != nil {
+				return err
+			}
+			buf = buf[:copy(buf, buf[i+len(sep):])]
+		}
+		if rerr == io.EOF {
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+			err := w.Close()
+			w = nil
+			return err
+		}
+		// anything longer than a partial separator at the end of buf can't be part of one
+		if keep := len(sep) - 1; len(buf) > keep {
+			if _, err := w.Write(buf[:len(buf)-keep]); err != nil {
+				return err
+			}
+			buf = buf[:copy(buf, buf[len(buf)-keep:])]
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+// closeBuffer is a bytes.Buffer that records whether it was closed.
+type closeBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closeBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestDecryptSplit(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	sep := []byte("\x00--next--\x00")
+	docs := []string{
+		"first",
+		"",
+		// the separator after this document spans the boundary between the second and third chunks
+		strings.Repeat("a", 2*encrypt.ChunkSize-len("first")-2*len(sep)-4),
+		strings.Repeat("b", 3*encrypt.ChunkSize),
+		"last",
+	}
+	plaintext := []byte(strings.Join(docs, string(sep)))
+	ciphertext, err := encrypt.EncryptAll(plaintext, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var outputs []*closeBuffer
+	err = encrypt.DecryptSplit(bytes.NewReader(ciphertext), key, sep, func(index int) (io.WriteCloser, error) {
+		if index != len(outputs) {
+			t.Errorf("expected index %d; got %d", len(outputs), index)
+		}
+		if index > 0 && !outputs[index-1].closed {
+			t.Errorf("document %d wasn't closed before opening the next", index-1)
+		}
+		outputs = append(outputs, &closeBuffer{})
+		return outputs[index], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) != len(docs) {
+		t.Fatalf("expected %d documents; got %d", len(docs), len(outputs))
+	}
+	for i, out := range outputs {
+		if out.String() != docs[i] {
+			t.Errorf("document %d: expected %d bytes; got %d", i, len(docs[i]), out.Len())
+		}
+		if !out.closed {
+			t.Errorf("document %d wasn't closed", i)
+		}
+	}
+
+	// a tampered stream is reported, and the open document is still closed
+	ciphertext[len(ciphertext)-1] ^= 1
+	outputs = nil
+	err = encrypt.DecryptSplit(bytes.NewReader(ciphertext), key, sep, func(index int) (io.WriteCloser, error) {
+		outputs = append(outputs, &closeBuffer{})
+		return outputs[index], nil
+	})
+	if !errors.Is(err, encrypt.ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed; got %v", err)
+	}
+	if last := outputs[len(outputs)-1]; !last.closed {
+		t.Errorf("expected the open document to be closed after an error")
+	}
+}
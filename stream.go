@@ -0,0 +1,242 @@
+package encrypt
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Sizes of the STREAM format written by NewSTREAMWriter.
+const (
+	streamChunkSize = 64 * 1024 // streamChunkSize is the plaintext size of every chunk except the last
+	streamSaltSize  = 16        // streamSaltSize is the size of the random value that begins the stream
+	streamLastFlag  = 1         // streamLastFlag is the final byte of the nonce of the last chunk
+)
+
+// streamPayloadInfo is the HKDF info used to derive the payload key of a STREAM.
+var streamPayloadInfo = []byte("payload")
+
+// STREAMWriter encrypts data with the STREAM construction of Hoang, Reyhanitabar, Rogaway, and Vizár,
+// using the same layout as the payload of an age file:
+//
+//	salt | chunk 0 | chunk 1 | ... | chunk n
+//
+// The 16-byte random salt is used with HKDF-SHA256 (RFC 5869) to derive a payload key from the key,
+// with "payload" as the info.
+// Every chunk holds 64 KiB of plaintext except the last, which holds 1 to 64 KiB,
+// or no plaintext if the stream is empty,
+// and is sealed with AES-256-GCM as ciphertext|tag without storing its nonce.
+// The nonce of chunk i is i as an 11-byte big-endian counter followed by a byte that is 1 for the last chunk and 0 otherwise,
+// which authenticates the order of the chunks and the end of the stream.
+//
+// The layout is documented and stable, unlike the format of Writer,
+// so it can be read by other implementations of STREAM that use AES-256-GCM with these parameters.
+// age itself uses ChaCha20-Poly1305 and can't read it.
+type STREAMWriter struct {
+	w       io.Writer
+	key     Key
+	aead    cipher.AEAD
+	chunk   []byte
+	counter uint64
+	closed  bool
+	err     error
+}
+
+// NewSTREAMWriter returns a STREAMWriter that encrypts data with key before writing to w.
+// Callers must call Close to write the last chunk,
+// without which a STREAMReader reports the stream as truncated.
+func NewSTREAMWriter(w io.Writer, key Key) *STREAMWriter {
+	return &STREAMWriter{w: w, key: key}
+}
+
+// Write implements io.Writer.
+// The last chunk of a STREAM is sealed differently from the others,
+// so a full chunk is held in the buffer until more data is written or the stream is closed.
+func (w *STREAMWriter) Write(p []byte) (n int, err error) {
+	if w.closed {
+		return 0, errors.New("call to write on closed writer")
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.aead == nil {
+		if w.err = w.start(); w.err != nil {
+			return 0, w.err
+		}
+	}
+	for len(p) > 0 {
+		if len(w.chunk) == streamChunkSize {
+			// more data follows, so the buffered chunk isn't the last
+			if w.err = w.seal(false); w.err != nil {
+				return n, w.err
+			}
+		}
+		nn := copy(w.chunk[len(w.chunk):streamChunkSize], p)
+		w.chunk = w.chunk[:len(w.chunk)+nn]
+		p = p[nn:]
+		n += nn
+	}
+	return n, nil
+}
+
+// Close seals the buffered data as the last chunk and prevents additional calls to Write.
+// If a previous write to the underlying writer failed, Close returns that error instead.
+func (w *STREAMWriter) Close() error {
+	if w.closed || w.err != nil {
+		return w.err
+	}
+	w.closed = true
+	if w.aead == nil {
+		if w.err = w.start(); w.err != nil {
+			return w.err
+		}
+	}
+	w.err = w.seal(true)
+	return w.err
+}
+
+// start writes the salt and derives the payload key.
+func (w *STREAMWriter) start() error {
+	salt := make([]byte, streamSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("encrypt.STREAMWriter: crypto.rand.Reader failed: %w", err)
+	}
+	aead, err := newSTREAMCipher(w.key, salt)
+	if err != nil {
+		return err
+	}
+	if _, err := w.w.Write(salt); err != nil {
+		return err
+	}
+	w.aead = aead
+	w.chunk = make([]byte, 0, streamChunkSize+aead.Overhead())
+	return nil
+}
+
+// seal encrypts the buffered chunk and writes it to the underlying writer.
+func (w *STREAMWriter) seal(last bool) error {
+	nonce := streamNonce(w.counter, last)
+	sealed := w.aead.Seal(w.chunk[:0], nonce, w.chunk, nil)
+	if _, err := w.w.Write(sealed); err != nil {
+		return err
+	}
+	w.counter++
+	w.chunk = w.chunk[:0]
+	return nil
+}
+
+// STREAMReader decrypts a stream written by a STREAMWriter
+// or another implementation of the same format.
+type STREAMReader struct {
+	r         io.Reader
+	key       Key
+	aead      cipher.AEAD
+	sealed    []byte
+	plaintext []byte
+	counter   uint64
+	err       error
+}
+
+// NewSTREAMReader returns a STREAMReader for decrypting r,
+// where r was encrypted by a STREAMWriter using key.
+//
+// Read returns ErrAuthFailed if any chunk was altered, reordered, or encrypted with a different key,
+// and ErrTruncated if the stream ends before its last chunk.
+func NewSTREAMReader(r io.Reader, key Key) *STREAMReader {
+	return &STREAMReader{r: r, key: key}
+}
+
+// Read implements io.Reader.
+func (r *STREAMReader) Read(p []byte) (int, error) {
+	for len(r.plaintext) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.plaintext, r.err = r.next(); r.err == io.EOF && len(r.plaintext) > 0 {
+			// the last chunk is returned before io.EOF
+			break
+		}
+	}
+	n := copy(p, r.plaintext)
+	r.plaintext = r.plaintext[n:]
+	return n, nil
+}
+
+// next reads and decrypts the next chunk.
+// It returns io.EOF along with the plaintext of the last chunk.
+func (r *STREAMReader) next() ([]byte, error) {
+	if r.aead == nil {
+		salt := make([]byte, streamSaltSize)
+		if _, err := io.ReadFull(r.r, salt); err != nil {
+			return nil, truncated(err)
+		}
+		aead, err := newSTREAMCipher(r.key, salt)
+		if err != nil {
+			return nil, err
+		}
+		r.aead = aead
+		// one extra byte reveals whether a full chunk is the last one
+		r.sealed = make([]byte, 0, streamChunkSize+aead.Overhead()+1)
+	}
+	size := streamChunkSize + r.aead.Overhead()
+	n, err := io.ReadFull(r.r, r.sealed[len(r.sealed):cap(r.sealed)])
+	r.sealed = r.sealed[:len(r.sealed)+n]
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	if len(r.sealed) > size {
+		// more data follows the chunk, so it must not be the last
+		plaintext, err := r.aead.Open(nil, streamNonce(r.counter, false), r.sealed[:size], nil)
+		if err != nil {
+			return nil, ErrAuthFailed
+		}
+		r.sealed = append(r.sealed[:0], r.sealed[size:]...)
+		r.counter++
+		return plaintext, nil
+	}
+	if len(r.sealed) < r.aead.Overhead() {
+		return nil, ErrTruncated
+	}
+	plaintext, err := r.aead.Open(nil, streamNonce(r.counter, true), r.sealed, nil)
+	if err != nil {
+		// a chunk that isn't marked as the last can only be followed by more data
+		if _, nerr := r.aead.Open(nil, streamNonce(r.counter, false), r.sealed, nil); nerr == nil {
+			return nil, ErrTruncated
+		}
+		return nil, ErrAuthFailed
+	}
+	if len(plaintext) == 0 && r.counter > 0 {
+		// only an empty stream may end with an empty chunk
+		return nil, errors.New("encrypt.STREAMReader: empty last chunk")
+	}
+	r.sealed = r.sealed[:0]
+	return plaintext, io.EOF
+}
+
+// newSTREAMCipher derives the payload key of a STREAM from key and salt
+// using HKDF-SHA256 and returns AES-256-GCM with it.
+func newSTREAMCipher(key Key, salt []byte) (cipher.AEAD, error) {
+	// HKDF-Extract: PRK = HMAC-Hash(salt, IKM)
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(key[:])
+	var prk Key
+	copy(prk[:], mac.Sum(nil))
+	// Derive is HKDF-Expand with a single block of output
+	return newGCM(prk.Derive(streamPayloadInfo), nonceSize)
+}
+
+// streamNonce returns the nonce of the chunk at index counter:
+// an 11-byte big-endian counter followed by the last chunk flag.
+func streamNonce(counter uint64, last bool) []byte {
+	nonce := make([]byte, nonceSize)
+	binary.BigEndian.PutUint64(nonce[3:11], counter)
+	if last {
+		nonce[11] = streamLastFlag
+	}
+	return nonce
+}
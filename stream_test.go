@@ -0,0 +1,110 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestSTREAM(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	const chunk = 64 * 1024
+	for _, size := range []int{0, 1, chunk - 1, chunk, chunk + 1, chunk*3 + 100} {
+		plaintext := make([]byte, size)
+		for i := range plaintext {
+			plaintext[i] = byte(i * 7)
+		}
+		buf := &bytes.Buffer{}
+		w := encrypt.NewSTREAMWriter(buf, key)
+		if _, err := io.CopyBuffer(w, bytes.NewReader(plaintext), make([]byte, 1000)); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(encrypt.NewSTREAMReader(bytes.NewReader(buf.Bytes()), key))
+		if err != nil || !bytes.Equal(got, plaintext) {
+			t.Errorf("size %d: round trip failed: %v", size, err)
+		}
+		if got := decryptSTREAM(t, buf.Bytes(), key); !bytes.Equal(got, plaintext) {
+			t.Errorf("size %d: stream doesn't follow the documented layout", size)
+		}
+	}
+}
+
+func TestSTREAMReader_errors(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	const sealedChunk = 64*1024 + 16
+	buf := &bytes.Buffer{}
+	w := encrypt.NewSTREAMWriter(buf, key)
+	w.Write(make([]byte, 64*1024*3))
+	w.Close()
+	ciphertext := buf.Bytes()
+
+	tests := map[string]struct {
+		ciphertext []byte
+		err        error
+	}{
+		"tampered":            {append(append([]byte{}, ciphertext[:100]...), append([]byte{ciphertext[100] ^ 1}, ciphertext[101:]...)...), encrypt.ErrAuthFailed},
+		"truncated at chunk":  {ciphertext[:16+sealedChunk*2], encrypt.ErrTruncated},
+		"truncated mid-chunk": {ciphertext[:16+sealedChunk*2+10], encrypt.ErrTruncated},
+		"missing salt":        {ciphertext[:10], encrypt.ErrTruncated},
+		"swapped chunks": {
+			bytes.Join([][]byte{ciphertext[:16], ciphertext[16+sealedChunk : 16+sealedChunk*2], ciphertext[16 : 16+sealedChunk], ciphertext[16+sealedChunk*2:]}, nil),
+			encrypt.ErrAuthFailed,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := io.ReadAll(encrypt.NewSTREAMReader(bytes.NewReader(tt.ciphertext), key))
+			if !errors.Is(err, tt.err) {
+				t.Errorf("expected %v; got %v", tt.err, err)
+			}
+		})
+	}
+	other, _ := encrypt.NewKey()
+	if _, err := io.ReadAll(encrypt.NewSTREAMReader(bytes.NewReader(ciphertext), other)); !errors.Is(err, encrypt.ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed for the wrong key; got %v", err)
+	}
+}
+
+// decryptSTREAM decrypts a STREAM independently of the package to check the documented layout.
+func decryptSTREAM(t *testing.T, ciphertext []byte, key encrypt.Key) []byte {
+	salt, ciphertext := ciphertext[:16], ciphertext[16:]
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(key.Bytes())
+	mac = hmac.New(sha256.New, mac.Sum(nil))
+	mac.Write([]byte("payload\x01"))
+	block, _ := aes.NewCipher(mac.Sum(nil))
+	aead, _ := cipher.NewGCM(block)
+
+	var plaintext []byte
+	for counter := byte(0); ; counter++ {
+		n := 64*1024 + 16
+		last := len(ciphertext) <= n
+		if last {
+			n = len(ciphertext)
+		}
+		nonce := make([]byte, 12)
+		nonce[10] = counter
+		if last {
+			nonce[11] = 1
+		}
+		p, err := aead.Open(nil, nonce, ciphertext[:n], nil)
+		if err != nil {
+			t.Fatalf("chunk %d: %v", counter, err)
+		}
+		plaintext = append(plaintext, p...)
+		ciphertext = ciphertext[n:]
+		if last {
+			return plaintext
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package encrypt
+
+import (
+	"fmt"
+	"io"
+)
+
+// NewStrictReader returns a Reader for decrypting r, where r was encrypted by a Writer using key,
+// that authenticates the whole stream before returning any plaintext.
+// The first call to Read or Seek reads r to the end, checking every chunk,
+// and then rewinds r to continue as a normal Reader.
+// For a stream with a header, such as one with metadata, the check also confirms that none of the stream was cut off;
+// a headerless stream that was truncated at a chunk boundary can't be told apart from a shorter stream.
+// If any part of the stream fails, no plaintext is returned at all,
+// so a program can't act on the start of a stream whose later chunks were modified or cut off.
+//
+// This doubles the work of decrypting the stream, and delays the first Read until all of r has been checked.
+// r must be seekable so that it can be read twice.
+// The stream must not be modified between the check and the read that follows it,
+// since every chunk is authenticated again as it is read but the earlier check is not repeated.
+func NewStrictReader(r io.ReadSeeker, key Key) *Reader {
+	return &Reader{
+		r:      r,
+		key:    key,
+		strict: true,
+	}
+}
+
+// verifyStream reads the whole of r.r with a separate Reader to authenticate it,
+// then restores the position of r.r.
+func (r *Reader) verifyStream() error {
+	s := r.r.(io.Seeker)
+	start, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("encrypt.NewStrictReader: %w", err)
+	}
+	verifier := NewReader(r.r, r.key)
+	verifier.maxChunk = r.maxChunk
+	_, err = io.Copy(io.Discard, verifier)
+	if _, serr := s.Seek(start, io.SeekStart); err == nil && serr != nil {
+		err = fmt.Errorf("encrypt.NewStrictReader: %w", serr)
+	}
+	return err
+}
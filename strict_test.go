@@ -0,0 +1,60 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestNewStrictReader(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := make([]byte, 3*encrypt.ChunkSize+10)
+	for i := range plaintext {
+		plaintext[i] = byte(i)
+	}
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.SetMetadata(map[string]string{"name": "data.bin"})
+	w.WriteAndClose(plaintext)
+	ciphertext := buf.Bytes()
+
+	r := encrypt.NewStrictReader(bytes.NewReader(ciphertext), key)
+	if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, plaintext) {
+		t.Errorf("expected the plaintext to round trip; got %d bytes/%v", len(got), err)
+	}
+	r = encrypt.NewStrictReader(bytes.NewReader(ciphertext), key)
+	if _, err := r.Seek(-10, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, plaintext[len(plaintext)-10:]) {
+		t.Errorf("expected the end of the plaintext after seeking; got %v/%v", got, err)
+	}
+
+	// a normal Reader returns the chunks before a damaged one, but a strict Reader returns nothing
+	tampered := append([]byte{}, ciphertext...)
+	tampered[len(tampered)-100] ^= 1
+	if n, _ := io.ReadFull(encrypt.NewReader(bytes.NewReader(tampered), key), make([]byte, encrypt.ChunkSize)); n == 0 {
+		t.Fatalf("expected a normal Reader to return the first chunk")
+	}
+	r = encrypt.NewStrictReader(bytes.NewReader(tampered), key)
+	for i := 0; i < 2; i++ {
+		if n, err := r.Read(make([]byte, 100)); n != 0 || !errors.Is(err, encrypt.ErrAuthFailed) {
+			t.Errorf("read %d: expected 0/ErrAuthFailed for a tampered stream; got %d/%v", i, n, err)
+		}
+	}
+
+	truncated := ciphertext[:len(ciphertext)-200]
+	r = encrypt.NewStrictReader(bytes.NewReader(truncated), key)
+	if n, err := r.Read(make([]byte, 100)); n != 0 || !errors.Is(err, encrypt.ErrTruncated) {
+		t.Errorf("expected 0/ErrTruncated for a truncated stream; got %d/%v", n, err)
+	}
+
+	other, _ := encrypt.NewKey()
+	r = encrypt.NewStrictReader(bytes.NewReader(ciphertext), other)
+	if _, err := r.Seek(10, io.SeekStart); !errors.Is(err, encrypt.ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed from Seek with the wrong key; got %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package encrypt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// tocEntrySize is the encoded size of a ChunkEntry, which holds a uint64 offset and a uint32 length.
+const tocEntrySize = 12
+
+// ChunkEntry describes one chunk of a stream in its table of contents.
+type ChunkEntry struct {
+	Offset          int64 // Offset is the position of the chunk in the ciphertext.
+	PlaintextOffset int64 // PlaintextOffset is the position of the chunk's data in the plaintext.
+	PlaintextLength int   // PlaintextLength is the size of the chunk's data.
+}
+
+// EnableTOC makes Close write a table of contents to the end of the stream,
+// listing the position and size of every chunk.
+// The table is authenticated with the same key as the stream,
+// and a Reader uses it to seek in streams whose chunks vary in size,
+// such as those written with Flush or SetChunkSize.
+// The entries are also available from TOC once the Writer is closed,
+// for programs that keep their own index.
+//
+// EnableTOC must be called before any data has been written to the underlying writer.
+// It is not supported for detached, padded, uniform, or resumed streams, or with a trailer or checksums.
+func (w *Writer) EnableTOC() error {
+	switch {
+	case w.started:
+		return errors.New("encrypt.Writer.EnableTOC: data has already been written")
+	case w.tags != nil:
+		return errors.New("encrypt.Writer.EnableTOC: not supported with detached tags")
+	case w.bucket > 0:
+		return errors.New("encrypt.Writer.EnableTOC: not supported for padded streams")
+	case w.resumed:
+		return errors.New("encrypt.Writer.EnableTOC: not supported for resumed streams")
+	case w.header != nil && w.header.uniform:
+		return errors.New("encrypt.Writer.EnableTOC: not supported for uniform streams")
+	case w.header != nil && w.header.trailer:
+		return errors.New("encrypt.Writer.EnableTOC: not supported for streams with a trailer")
+	case w.header != nil && w.header.checksums:
+		return errors.New("encrypt.Writer.EnableTOC: not supported for streams with checksums")
+	}
+	if w.header == nil {
+		w.header = &header{}
+	}
+	w.header.toc = true
+	return nil
+}
+
+// TOC returns the table of contents of the chunks written so far,
+// or nil if EnableTOC was not called.
+func (w *Writer) TOC() []ChunkEntry {
+	return w.toc
+}
+
+// writeTOC writes the table of contents as the final record of the stream,
+// followed by the size of that record as a big-endian uint64 so that it can be found from the end.
+// The record is authenticated with the number of entries as its index.
+func (w *Writer) writeTOC() error {
+	plaintext := make([]byte, len(w.toc)*tocEntrySize)
+	for i, e := range w.toc {
+		binary.BigEndian.PutUint64(plaintext[i*tocEntrySize:], uint64(e.Offset))
+		binary.BigEndian.PutUint32(plaintext[i*tocEntrySize+8:], uint32(e.PlaintextLength))
+	}
+	start := w.written
+	if err := w.writeRecord(recordTOC, plaintext); err != nil {
+		return err
+	}
+	trailer := make([]byte, 8)
+	binary.BigEndian.PutUint64(trailer, uint64(w.written-start))
+	return w.write(trailer)
+}
+
+// TOC returns the table of contents written by a Writer after a call to EnableTOC,
+// or nil if the stream doesn't have one.
+// Reading it requires the underlying reader to implement io.Seeker and its size to be known;
+// the current position is restored afterwards.
+func (r *Reader) TOC() ([]ChunkEntry, error) {
+	if err := r.detect(); err != nil {
+		return nil, err
+	}
+	if r.header == nil || !r.header.toc {
+		return nil, nil
+	}
+	if r.toc != nil {
+		return r.toc, nil
+	}
+	s, ok := r.r.(io.Seeker)
+	if !ok {
+		return nil, fmt.Errorf("encrypt.Reader.TOC: seek method not supported by %T", r.r)
+	}
+	size, err := r.sourceSize()
+	if err != nil {
+		return nil, err
+	}
+	pos, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt.Reader.TOC: %w", err)
+	}
+	toc, err := r.readTOC(s, size)
+	if _, serr := s.Seek(pos, io.SeekStart); err == nil && serr != nil {
+		err = fmt.Errorf("encrypt.Reader.TOC: %w", serr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.toc = toc
+	return toc, nil
+}
+
+// readTOC reads and verifies the table of contents at the end of a stream that is size bytes long.
+func (r *Reader) readTOC(s io.Seeker, size int64) ([]ChunkEntry, error) {
+	malformed := errors.New("encrypt.Reader.TOC: malformed table of contents")
+	trailer := make([]byte, 8)
+	if _, err := s.Seek(size-int64(len(trailer)), io.SeekStart); err != nil {
+		return nil, fmt.Errorf("encrypt.Reader.TOC: %w", err)
+	}
+	if _, err := io.ReadFull(r.r, trailer); err != nil {
+		return nil, fmt.Errorf("encrypt.Reader.TOC: %w", truncated(err))
+	}
+	recordSize := binary.BigEndian.Uint64(trailer)
+	start := size - int64(len(trailer)) - int64(recordSize)
+	if recordSize < recordHeaderSize || recordSize > uint64(size) || start < r.base {
+		return nil, malformed
+	}
+	if _, err := s.Seek(start, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("encrypt.Reader.TOC: %w", err)
+	}
+	record := make([]byte, recordSize)
+	if _, err := io.ReadFull(r.r, record); err != nil {
+		return nil, fmt.Errorf("encrypt.Reader.TOC: %w", truncated(err))
+	}
+	nonceSize, tagSize := r.overhead()
+	count := (int(recordSize) - recordHeaderSize - nonceSize - tagSize) / tocEntrySize
+	if record[0] != recordTOC || int(binary.BigEndian.Uint32(record[1:])) != len(record)-recordHeaderSize || count < 0 {
+		return nil, malformed
+	}
+	aead, err := r.cipher()
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := openRecord(aead, nil, record[recordHeaderSize:], recordAD(recordTOC, int64(count), r.header.binding))
+	if err != nil {
+		return nil, err
+	}
+	if len(plaintext) != count*tocEntrySize {
+		return nil, malformed
+	}
+
+	// the entries must describe consecutive records from the end of the header to the end record
+	toc := make([]ChunkEntry, count)
+	offset, plaintextOffset := r.base, int64(0)
+	for i := range toc {
+		e := ChunkEntry{
+			Offset:          int64(binary.BigEndian.Uint64(plaintext[i*tocEntrySize:])),
+			PlaintextOffset: plaintextOffset,
+			PlaintextLength: int(binary.BigEndian.Uint32(plaintext[i*tocEntrySize+8:])),
+		}
+		if e.Offset != offset || e.PlaintextLength <= 0 || e.PlaintextLength > maxChunkSize {
+			return nil, malformed
+		}
+		toc[i] = e
+		offset += int64(recordHeaderSize + nonceSize + e.PlaintextLength + tagSize)
+		plaintextOffset += int64(e.PlaintextLength)
+	}
+	if offset+r.endRecordSize() != start {
+		return nil, malformed
+	}
+	return toc, nil
+}
+
+// seekTOC returns the chunk index, plaintext offset, and ciphertext position of the record holding newOffset,
+// using the table of contents of the stream.
+// Offsets past the end of the data resolve to the end record, with overshot set.
+func (r *Reader) seekTOC(newOffset int64) (index, total, sectorStart int64, overshot bool, err error) {
+	toc, err := r.TOC()
+	if err != nil {
+		return 0, 0, 0, false, err
+	}
+	i := sort.Search(len(toc), func(i int) bool {
+		return toc[i].PlaintextOffset+int64(toc[i].PlaintextLength) > newOffset
+	})
+	if i < len(toc) {
+		return int64(i), toc[i].PlaintextOffset, toc[i].Offset, false, nil
+	}
+	// position the cursor at the end record, which follows the final entry
+	nonceSize, tagSize := r.overhead()
+	sectorStart = r.base
+	if len(toc) > 0 {
+		last := toc[len(toc)-1]
+		total = last.PlaintextOffset + int64(last.PlaintextLength)
+		sectorStart = last.Offset + int64(recordHeaderSize+nonceSize+last.PlaintextLength+tagSize)
+	}
+	return int64(len(toc)), total, sectorStart, true, nil
+}
@@ -0,0 +1,108 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestWriter_EnableTOC(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	if err := w.EnableTOC(); err != nil {
+		t.Fatal(err)
+	}
+	// chunks of varying sizes can't be located without the table of contents
+	w.SetChunkSize(1024)
+	w.Write(plaintext[:5000])
+	w.Flush()
+	w.Write(plaintext[5000:5100])
+	w.SetChunkSize(4096)
+	w.Write(plaintext[5100:])
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	toc := w.TOC()
+	var total int64
+	for i, e := range toc {
+		if e.PlaintextOffset != total {
+			t.Fatalf("entry %d: expected plaintext offset %d; got %d", i, total, e.PlaintextOffset)
+		}
+		total += int64(e.PlaintextLength)
+	}
+	if total != int64(len(plaintext)) {
+		t.Errorf("expected the entries to cover %d bytes; got %d", len(plaintext), total)
+	}
+
+	r := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+	// the final chunks are larger than the chunk size in the header
+	r.SetMaxChunkSize(4096)
+	got, err := r.TOC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, toc) {
+		t.Errorf("expected the Reader to report the same table of contents as the Writer")
+	}
+	decrypted, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("plaintext does not match")
+	}
+
+	tt := []struct {
+		offset int64
+		whence int
+	}{
+		{0, io.SeekStart},
+		{1023, io.SeekStart},
+		{1024, io.SeekStart},
+		{5050, io.SeekStart},
+		{5100, io.SeekStart},
+		{70000, io.SeekStart},
+		{int64(len(plaintext)), io.SeekStart},
+		{int64(len(plaintext)) + 100, io.SeekStart},
+		{-1, io.SeekEnd},
+		{-5000, io.SeekEnd},
+		{10, io.SeekEnd},
+	}
+	for _, td := range tt {
+		expected := bytes.NewReader(plaintext)
+		r := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+		r.SetMaxChunkSize(4096)
+		n1, _ := expected.Seek(td.offset, td.whence)
+		n2, err := r.Seek(td.offset, td.whence)
+		if err != nil || n1 != n2 {
+			t.Errorf("seek(%d, %d): expected %d/nil; got %d/%v", td.offset, td.whence, n1, n2, err)
+			continue
+		}
+		want, _ := io.ReadAll(expected)
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Errorf("seek(%d, %d): %v", td.offset, td.whence, err)
+		}
+		if !bytes.Equal(want, got) {
+			t.Errorf("seek(%d, %d): plaintext does not match", td.offset, td.whence)
+		}
+	}
+
+	tampered := append([]byte{}, buf.Bytes()...)
+	tampered[len(tampered)-20] ^= 0xff
+	if _, err := encrypt.NewReader(bytes.NewReader(tampered), key).TOC(); err == nil {
+		t.Errorf("expected an error reading a modified table of contents")
+	}
+
+	w = encrypt.NewWriter(&bytes.Buffer{}, key)
+	w.Write(make([]byte, chunkSize))
+	if err := w.EnableTOC(); err == nil {
+		t.Errorf("expected an error enabling the table of contents after data was written")
+	}
+}
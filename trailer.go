@@ -0,0 +1,90 @@
+package encrypt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// trailerSize is the size of the HMAC-SHA256 written at the end of a stream by EnableTrailer.
+const trailerSize = sha256.Size
+
+// trailerInfo derives the key of the trailer HMAC from the key of the stream.
+var trailerInfo = []byte("encrypt trailer")
+
+// EnableTrailer makes Close write an HMAC-SHA256 of the whole stream after its end record,
+// keyed by a subkey derived from the key of the Writer.
+// VerifyTrailer checks it with a single pass over the ciphertext and without decrypting anything,
+// which is a cheap way to confirm that a stored file is complete and unmodified.
+// Every chunk is still authenticated on its own when the stream is read,
+// and a Reader ignores the trailer.
+//
+// EnableTrailer must be called before any data has been written to the underlying writer.
+// It is not supported for detached, padded, uniform, or resumed streams, or with a table of contents.
+func (w *Writer) EnableTrailer() error {
+	switch {
+	case w.started:
+		return errors.New("encrypt.Writer.EnableTrailer: data has already been written")
+	case w.tags != nil:
+		return errors.New("encrypt.Writer.EnableTrailer: not supported with detached tags")
+	case w.bucket > 0:
+		return errors.New("encrypt.Writer.EnableTrailer: not supported for padded streams")
+	case w.resumed:
+		return errors.New("encrypt.Writer.EnableTrailer: not supported for resumed streams")
+	case w.header != nil && w.header.uniform:
+		return errors.New("encrypt.Writer.EnableTrailer: not supported for uniform streams")
+	case w.header != nil && w.header.toc:
+		return errors.New("encrypt.Writer.EnableTrailer: not supported with a table of contents")
+	}
+	if w.header == nil {
+		w.header = &header{}
+	}
+	w.header.trailer = true
+	subkey := w.key.Derive(trailerInfo)
+	w.trailer = hmac.New(sha256.New, subkey[:])
+	return nil
+}
+
+// VerifyTrailer checks the trailer written by a Writer after a call to EnableTrailer,
+// which authenticates the whole of r with key.
+// It returns ErrAuthFailed if any part of r was modified, truncated, or extended,
+// or if it was written with a different key,
+// and an error if the stream doesn't have a trailer.
+// r is read from the start, and is left positioned at its end.
+func VerifyTrailer(r io.ReadSeeker, key Key) error {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("encrypt.VerifyTrailer: %w", err)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("encrypt.VerifyTrailer: %w", err)
+	}
+	hdr, _, err := ReadHeader(r)
+	if err != nil {
+		return fmt.Errorf("encrypt.VerifyTrailer: %w", err)
+	}
+	if !hdr.Trailer {
+		return errors.New("encrypt.VerifyTrailer: stream has no trailer")
+	}
+	if size < hdr.Size+trailerSize {
+		return ErrTruncated
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("encrypt.VerifyTrailer: %w", err)
+	}
+	subkey := key.Derive(trailerInfo)
+	mac := hmac.New(sha256.New, subkey[:])
+	if _, err := io.CopyN(mac, r, size-trailerSize); err != nil {
+		return fmt.Errorf("encrypt.VerifyTrailer: %w", truncated(err))
+	}
+	trailer := make([]byte, trailerSize)
+	if _, err := io.ReadFull(r, trailer); err != nil {
+		return fmt.Errorf("encrypt.VerifyTrailer: %w", truncated(err))
+	}
+	if !hmac.Equal(mac.Sum(nil), trailer) {
+		return ErrAuthFailed
+	}
+	return nil
+}
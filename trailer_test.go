@@ -0,0 +1,120 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestWriter_EnableTrailer(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := make([]byte, encrypt.ChunkSize*2+10)
+	for i := range plaintext {
+		plaintext[i] = byte(i)
+	}
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	if err := w.EnableTrailer(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.EnableTOC(); err == nil {
+		t.Errorf("expected an error enabling a table of contents with a trailer")
+	}
+	w.Write(plaintext)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := buf.Bytes()
+
+	if err := encrypt.VerifyTrailer(bytes.NewReader(ciphertext), key); err != nil {
+		t.Errorf("expected the trailer to verify; got %v", err)
+	}
+	hdr, _, err := encrypt.ReadHeader(bytes.NewReader(ciphertext))
+	if err != nil || !hdr.Trailer {
+		t.Errorf("expected the header to report a trailer; got %v/%v", hdr.Trailer, err)
+	}
+
+	// a Reader ignores the trailer, including when seeking from the end
+	r := encrypt.NewReader(bytes.NewReader(ciphertext), key)
+	if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, plaintext) {
+		t.Errorf("decrypted stream doesn't match: %v", err)
+	}
+	if n, err := r.Seek(-10, io.SeekEnd); n != int64(len(plaintext)-10) || err != nil {
+		t.Errorf("expected %d/nil; got %d/%v", len(plaintext)-10, n, err)
+	}
+
+	tampered := append([]byte{}, ciphertext...)
+	tampered[len(tampered)/2] ^= 1
+	other, _ := encrypt.NewKey()
+	tests := map[string]struct {
+		ciphertext []byte
+		key        encrypt.Key
+	}{
+		"tampered":  {tampered, key},
+		"truncated": {ciphertext[:len(ciphertext)-1], key},
+		"extended":  {append(append([]byte{}, ciphertext...), 0), key},
+		"wrong key": {ciphertext, other},
+	}
+	for name, tt := range tests {
+		if err := encrypt.VerifyTrailer(bytes.NewReader(tt.ciphertext), tt.key); !errors.Is(err, encrypt.ErrAuthFailed) {
+			t.Errorf("%s: expected ErrAuthFailed; got %v", name, err)
+		}
+	}
+
+	buf.Reset()
+	w = encrypt.NewWriter(buf, key)
+	w.SetMetadata(map[string]string{"name": "file.txt"})
+	w.Close()
+	if err := encrypt.VerifyTrailer(bytes.NewReader(buf.Bytes()), key); err == nil {
+		t.Errorf("expected an error for a stream without a trailer")
+	}
+}
+
+func TestWriter_EnableTrailer_seekEnd(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	for _, tc := range []struct {
+		name   string
+		enable func(w *encrypt.Writer) error
+	}{
+		{"trailer", func(w *encrypt.Writer) error { return nil }},
+		{"checksums", (*encrypt.Writer).EnableChecksums},
+		{"chained", (*encrypt.Writer).EnableChain},
+	} {
+		for _, size := range []int{0, 1, encrypt.ChunkSize, encrypt.ChunkSize*2 + 10} {
+			plaintext := make([]byte, size)
+			buf := &bytes.Buffer{}
+			w := encrypt.NewWriter(buf, key)
+			if err := w.EnableTrailer(); err != nil {
+				t.Fatal(err)
+			}
+			if err := tc.enable(w); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.WriteAndClose(plaintext); err != nil {
+				t.Fatal(err)
+			}
+
+			r := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+			for _, offset := range []int64{0, 10} {
+				if n, err := r.Seek(offset, io.SeekEnd); n != int64(size)+offset || err != nil {
+					t.Errorf("%s, size %d: expected %d/nil seeking to %d from the end; got %d/%v", tc.name, size, int64(size)+offset, offset, n, err)
+					continue
+				}
+				if n, err := r.Read(make([]byte, 10)); n != 0 || err != io.EOF {
+					t.Errorf("%s, size %d: expected 0/EOF reading %d from the end; got %d/%v", tc.name, size, offset, n, err)
+				}
+			}
+			if size > 0 {
+				if _, err := r.Seek(-1, io.SeekEnd); err != nil {
+					t.Fatal(err)
+				}
+				if got, err := io.ReadAll(r); err != nil || len(got) != 1 {
+					t.Errorf("%s, size %d: expected the final byte; got %v/%v", tc.name, size, got, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package encrypt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// ErrNeedInput is returned by Transformer.Read when all of the ciphertext produced so far has been read
+// and more can only be produced by writing more plaintext or closing the Transformer.
+var ErrNeedInput = errors.New("encrypt: no ciphertext is available until more plaintext is written")
+
+// Transformer encrypts plaintext written to it and makes the ciphertext available to Read,
+// which adapts a source that pushes data to a consumer that pulls it,
+// without connecting them through an io.Pipe and a separate goroutine.
+// The ciphertext is in the same format as the output of NewWriter.
+//
+// A chunk becomes readable once it is full, or when Close is called for the final chunk,
+// so at most one chunk of plaintext and the ciphertext that hasn't been read yet are held in memory.
+type Transformer struct {
+	buf bytes.Buffer
+	w   *Writer
+}
+
+// NewTransformer returns a Transformer that encrypts data with key.
+func NewTransformer(key Key) *Transformer {
+	t := &Transformer{}
+	t.w = NewWriter(&t.buf, key)
+	return t
+}
+
+// Write encrypts p, making any chunks that it completes available to Read.
+func (t *Transformer) Write(p []byte) (int, error) {
+	return t.w.Write(p)
+}
+
+// Close encrypts the final chunk, making it available to Read,
+// and prevents additional calls to Write.
+func (t *Transformer) Close() error {
+	return t.w.Close()
+}
+
+// Read reads ciphertext that has been produced by Write and Close.
+// When there is none, Read returns the error that stopped Write or Close if there was one,
+// io.EOF if the Transformer has been closed, and ErrNeedInput otherwise.
+func (t *Transformer) Read(p []byte) (int, error) {
+	if t.buf.Len() == 0 {
+		if t.w.err != nil {
+			return 0, t.w.err
+		}
+		if t.w.closed {
+			return 0, io.EOF
+		}
+		return 0, ErrNeedInput
+	}
+	return t.buf.Read(p)
+}
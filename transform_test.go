@@ -0,0 +1,67 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestTransformer(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := make([]byte, encrypt.ChunkSize*2+10)
+	for i := range plaintext {
+		plaintext[i] = byte(i)
+	}
+	tr := encrypt.NewTransformer(key)
+
+	if _, err := tr.Read(make([]byte, 10)); !errors.Is(err, encrypt.ErrNeedInput) {
+		t.Fatalf("expected ErrNeedInput before any writes; got %v", err)
+	}
+	tr.Write(plaintext[:encrypt.ChunkSize-1])
+	if _, err := tr.Read(make([]byte, 10)); !errors.Is(err, encrypt.ErrNeedInput) {
+		t.Errorf("expected ErrNeedInput for a partial chunk; got %v", err)
+	}
+
+	var ciphertext []byte
+	pull := func() {
+		buf := make([]byte, 1000)
+		for {
+			n, err := tr.Read(buf)
+			ciphertext = append(ciphertext, buf[:n]...)
+			if err != nil {
+				return
+			}
+		}
+	}
+	tr.Write(plaintext[encrypt.ChunkSize-1:])
+	pull()
+	if len(ciphertext) != encrypt.SectorSize*2 {
+		t.Errorf("expected the two full chunks to be readable; got %d bytes", len(ciphertext))
+	}
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	pull()
+	if _, err := tr.Read(make([]byte, 10)); err != io.EOF {
+		t.Errorf("expected io.EOF after Close; got %v", err)
+	}
+
+	got, err := io.ReadAll(encrypt.NewReader(bytes.NewReader(ciphertext), key))
+	if err != nil || !bytes.Equal(got, plaintext) {
+		t.Errorf("decrypted stream doesn't match: %v", err)
+	}
+}
+
+func TestTransformer_error(t *testing.T) {
+	tr := encrypt.NewTransformer(encrypt.Key{})
+	if _, err := tr.Write(make([]byte, encrypt.ChunkSize)); !errors.Is(err, encrypt.ErrZeroKey) {
+		t.Fatalf("expected ErrZeroKey from Write; got %v", err)
+	}
+	// the error is reported before the Transformer is closed, instead of asking for more input
+	if _, err := tr.Read(make([]byte, 10)); !errors.Is(err, encrypt.ErrZeroKey) {
+		t.Errorf("expected ErrZeroKey from Read; got %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+package encrypt
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// treeMetadata identifies a stream written by EncryptTree.
+var treeMetadata = map[string]string{"archive": "tar"}
+
+// EncryptTree encrypts the directory tree at root into a single stream written to dst,
+// which can be restored by DecryptTree.
+// The tree is stored as a tar archive inside a stream with a header,
+// so the path, permissions, and modification time of every file are encrypted and authenticated along with its contents,
+// and a stream that is cut short is reported as truncated.
+// Files are streamed one at a time, so memory use doesn't depend on their sizes.
+//
+// Regular files, directories including empty ones, and symbolic links are stored;
+// symbolic links are not followed, and an error is returned for other types of files such as devices.
+func EncryptTree(dst io.Writer, root string, key Key) error {
+	w := NewWriter(dst, key)
+	if err := w.SetMetadata(treeMetadata); err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+	err := filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil || rel == "." {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		var link string
+		switch mode := info.Mode(); {
+		case mode.IsRegular(), mode.IsDir():
+		case mode&fs.ModeSymlink != 0:
+			if link, err = os.Readlink(name); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("encrypt.EncryptTree: unsupported file type for %s", name)
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// DecryptTree restores a directory tree that was encrypted by EncryptTree using key from src into the directory dst,
+// creating it if necessary.
+// Permissions and modification times are restored, except for the modification times of symbolic links.
+//
+// Paths that would be written outside of dst, whether directly or through a symbolic link in the archive,
+// cause an error, as does a stream that fails to authenticate.
+// If an error is returned, dst may hold part of the tree.
+func DecryptTree(dst string, src io.Reader, key Key) error {
+	r := NewReader(src, key)
+	md, err := r.Metadata()
+	if err != nil {
+		return err
+	}
+	if md["archive"] != treeMetadata["archive"] {
+		return errors.New("encrypt.DecryptTree: stream was not written by EncryptTree")
+	}
+	if err := os.MkdirAll(dst, 0o755); err != nil {
+		return err
+	}
+	// directories are modified by the entries written into them,
+	// so their modification times are restored last
+	var dirs []treeDir
+	links := map[string]bool{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			// the archive ends before the stream does, whose end record shows that nothing was cut off
+			if _, err := io.Copy(io.Discard, r); err != nil {
+				return err
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Clean(hdr.Name)
+		if !fs.ValidPath(name) || name == "." {
+			return fmt.Errorf("encrypt.DecryptTree: invalid path %q", hdr.Name)
+		}
+		if links[name] {
+			return fmt.Errorf("encrypt.DecryptTree: path %q is a symbolic link", hdr.Name)
+		}
+		for parent := path.Dir(name); parent != "."; parent = path.Dir(parent) {
+			if links[parent] {
+				return fmt.Errorf("encrypt.DecryptTree: path %q is inside a symbolic link", hdr.Name)
+			}
+		}
+		// the checks above only cover links from the archive, so the directory itself is checked too
+		if err := checkNoSymlinks(dst, name); err != nil {
+			return err
+		}
+		target := filepath.Join(dst, filepath.FromSlash(name))
+		mode := hdr.FileInfo().Mode().Perm()
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o700); err != nil {
+				return err
+			}
+			dirs = append(dirs, treeDir{name, mode, hdr.ModTime})
+			continue
+		case tar.TypeReg:
+			if err := writeTreeFile(target, tr, mode); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+			links[name] = true
+			continue
+		default:
+			return fmt.Errorf("encrypt.DecryptTree: unsupported entry type %q for %q", hdr.Typeflag, hdr.Name)
+		}
+		if err := os.Chtimes(target, hdr.ModTime, hdr.ModTime); err != nil {
+			return err
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		// Chmod and Chtimes follow symbolic links, so the path must not have been replaced by one
+		if err := checkNoSymlinks(dst, dirs[i].name); err != nil {
+			return err
+		}
+		target := filepath.Join(dst, filepath.FromSlash(dirs[i].name))
+		if err := os.Chmod(target, dirs[i].mode); err != nil {
+			return err
+		}
+		if err := os.Chtimes(target, dirs[i].modTime, dirs[i].modTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// treeDir is a directory restored by DecryptTree, whose permissions and modification time are set last.
+type treeDir struct {
+	name    string // name is the slash-separated path of the directory within the tree
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// checkNoSymlinks returns an error if name, or any directory between dst and name,
+// is a symbolic link, which could lead outside of dst.
+// Paths that don't exist yet are allowed.
+func checkNoSymlinks(dst, name string) error {
+	p := dst
+	for _, elem := range strings.Split(name, "/") {
+		p = filepath.Join(p, elem)
+		fi, err := os.Lstat(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("encrypt.DecryptTree: path %q is a symbolic link", name)
+		}
+	}
+	return nil
+}
+
+// writeTreeFile creates the file at name with the contents of r and the permissions in mode.
+func writeTreeFile(name string, r io.Reader, mode fs.FileMode) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// the mode is set after creating the file so that it isn't limited by the umask
+	return os.Chmod(name, mode)
+}
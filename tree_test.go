@@ -0,0 +1,157 @@
+package encrypt_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestEncryptTree(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	root := t.TempDir()
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	files := map[string]string{
+		"a.txt":          "first file",
+		"sub/b.txt":      "second file",
+		"sub/deep/c.bin": string(make([]byte, encrypt.ChunkSize*2+10)),
+	}
+	for name, contents := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0o640); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(root, "empty"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	symlinks := runtime.GOOS != "windows"
+	if symlinks {
+		if err := os.Symlink("a.txt", filepath.Join(root, "link")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := encrypt.EncryptTree(buf, root, key); err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := buf.Bytes()
+	dst := filepath.Join(t.TempDir(), "restored")
+	if err := encrypt.DecryptTree(dst, bytes.NewReader(ciphertext), key); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, contents := range files {
+		p := filepath.Join(dst, filepath.FromSlash(name))
+		got, err := os.ReadFile(p)
+		if err != nil || string(got) != contents {
+			t.Errorf("%s: contents don't match: %v", name, err)
+		}
+		fi, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !fi.ModTime().Equal(mtime) {
+			t.Errorf("%s: expected modification time %v; got %v", name, mtime, fi.ModTime())
+		}
+		if runtime.GOOS != "windows" && fi.Mode().Perm() != 0o640 {
+			t.Errorf("%s: expected mode 0640; got %v", name, fi.Mode().Perm())
+		}
+	}
+	if fi, err := os.Stat(filepath.Join(dst, "empty")); err != nil || !fi.IsDir() {
+		t.Errorf("expected the empty directory to be restored: %v", err)
+	}
+	if symlinks {
+		if link, err := os.Readlink(filepath.Join(dst, "link")); err != nil || link != "a.txt" {
+			t.Errorf("expected a symbolic link to a.txt; got %q/%v", link, err)
+		}
+	}
+
+	if err := encrypt.DecryptTree(t.TempDir(), bytes.NewReader(ciphertext[:len(ciphertext)-1]), key); !errors.Is(err, encrypt.ErrTruncated) {
+		t.Errorf("expected ErrTruncated; got %v", err)
+	}
+}
+
+func TestDecryptTree_escape(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	tests := map[string][]*tar.Header{
+		"parent":   {{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0o644}},
+		"absolute": {{Name: "/evil", Typeflag: tar.TypeReg, Mode: 0o644}},
+		"through link": {
+			{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "..", Mode: 0o777},
+			{Name: "link/evil", Typeflag: tar.TypeReg, Mode: 0o644},
+		},
+	}
+	for name, entries := range tests {
+		t.Run(name, func(t *testing.T) {
+			// the archive is authentic, so the checks don't rely on the key being secret
+			buf := &bytes.Buffer{}
+			w := encrypt.NewWriter(buf, key)
+			w.SetMetadata(map[string]string{"archive": "tar"})
+			tw := tar.NewWriter(w)
+			for _, hdr := range entries {
+				tw.WriteHeader(hdr)
+			}
+			tw.Close()
+			w.Close()
+
+			dir := t.TempDir()
+			dst := filepath.Join(dir, "dst")
+			if err := encrypt.DecryptTree(dst, buf, key); err == nil {
+				t.Errorf("expected an error")
+			}
+			if _, err := os.Stat(filepath.Join(dir, "evil")); err == nil {
+				t.Errorf("a file was written outside of the destination")
+			}
+		})
+	}
+}
+
+func TestDecryptTree_linkThenDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on windows")
+	}
+	key, _ := encrypt.NewKey()
+	outside := t.TempDir()
+	if err := os.Chmod(outside, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a directory entry with the same name as an earlier link must not change the link's target
+	buf := &bytes.Buffer{}
+	w := encrypt.NewWriter(buf, key)
+	w.SetMetadata(map[string]string{"archive": "tar"})
+	tw := tar.NewWriter(w)
+	tw.WriteHeader(&tar.Header{Name: "a", Typeflag: tar.TypeSymlink, Linkname: outside, Mode: 0o777})
+	tw.WriteHeader(&tar.Header{Name: "a/", Typeflag: tar.TypeDir, Mode: 0o777, ModTime: time.Unix(0, 0)})
+	tw.Close()
+	w.Close()
+
+	if err := encrypt.DecryptTree(filepath.Join(t.TempDir(), "dst"), buf, key); err == nil {
+		t.Errorf("expected an error for a directory entry replacing a symbolic link")
+	}
+	after, err := os.Stat(outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Mode() != before.Mode() || !after.ModTime().Equal(before.ModTime()) {
+		t.Errorf("the target of the link was modified: %v %v -> %v %v", before.Mode(), before.ModTime(), after.Mode(), after.ModTime())
+	}
+}
@@ -0,0 +1,114 @@
+package encrypt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// NewUniformWriter returns a new Writer that encrypts data with key before writing to w,
+// padding the final chunk to the same size as the others.
+// Every record that holds data then has the same size on disk,
+// which simplifies tools that locate chunks by fixed offsets.
+// The true length is authenticated in the stream, and a Reader returns exactly the original plaintext.
+//
+// Because the final chunk is always full, the size of the stream doesn't reveal the length of the plaintext,
+// so Reader.Seek reads the end of the stream to support io.SeekEnd.
+// Uniform streams don't support Flush or a table of contents.
+// Callers must call Close to write the final chunk of data.
+func NewUniformWriter(w io.Writer, key Key) *Writer {
+	return &Writer{
+		w:      w,
+		key:    key,
+		header: &header{uniform: true},
+	}
+}
+
+// padChunk returns the plaintext to seal for a record of the given kind,
+// which for the final chunk of a uniform stream is followed by zeroes up to the chunk size.
+func (w *Writer) padChunk(kind byte, plaintext []byte) []byte {
+	if kind != recordPadded {
+		return plaintext
+	}
+	padded := make([]byte, len(w.chunk))
+	copy(padded, plaintext)
+	return padded
+}
+
+// readPadded returns the data in the plaintext of the final record of a uniform stream without its padding,
+// using the length declared by the end record that follows it.
+func (r *Reader) readPadded(plaintext []byte) ([]byte, error) {
+	r.index++
+	r.padding = len(plaintext)
+	if _, err := r.readRecord(nil); err != io.EOF {
+		if err == nil {
+			err = errors.New("encrypt: malformed uniform stream")
+		}
+		return nil, err
+	}
+	n := r.declared - r.total
+	r.total = r.declared
+	return plaintext[:n], nil
+}
+
+// uniformSize returns the plaintext size of a uniform stream that is size bytes long
+// by reading the length declared by its end record.
+// The current position of the underlying reader is restored afterwards.
+func (r *Reader) uniformSize(size int64) (dataSize int64, lastChunkSize int, err error) {
+	s, ok := r.r.(io.Seeker)
+	if !ok {
+		return 0, 0, fmt.Errorf("encrypt.Reader.Seek: seek method not supported by %T", r.r)
+	}
+	sectorSize, chunkSize := r.sectorSize(), int64(r.chunkSize())
+	records := (size - r.base - r.endRecordSize()) / sectorSize
+	if records < 0 || r.base+records*sectorSize+r.endRecordSize() != size {
+		return 0, 0, fmt.Errorf("encrypt: invalid ciphertext size %d", size)
+	}
+	pos, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, 0, fmt.Errorf("encrypt.Reader.Seek: %w", err)
+	}
+	defer func() {
+		if _, serr := s.Seek(pos, io.SeekStart); err == nil && serr != nil {
+			err = fmt.Errorf("encrypt.Reader.Seek: %w", serr)
+		}
+	}()
+
+	start := size - r.endRecordSize()
+	ad := recordAD(recordEnd, records, r.header.binding)
+	if r.header.chained && records > 0 {
+		// the end record authenticates the hash of the final data record
+		start -= sectorSize
+	}
+	if _, err := s.Seek(start, io.SeekStart); err != nil {
+		return 0, 0, fmt.Errorf("encrypt.Reader.Seek: %w", err)
+	}
+	tail := make([]byte, size-start)
+	if _, err := io.ReadFull(r.r, tail); err != nil {
+		return 0, 0, fmt.Errorf("encrypt.Reader.Seek: %w", truncated(err))
+	}
+	end := tail[len(tail)-int(r.endRecordSize()):]
+	if len(end) < len(tail) {
+		ad = append(ad, chainHash(tail[recordHeaderSize:len(tail)-len(end)])...)
+	}
+	aead, err := r.cipher()
+	if err != nil {
+		return 0, 0, err
+	}
+	plaintext, err := openRecord(aead, nil, end[recordHeaderSize:], ad)
+	if err != nil {
+		return 0, 0, err
+	}
+	if end[0] != recordEnd || len(plaintext) != 8 {
+		return 0, 0, errors.New("encrypt: malformed end record")
+	}
+	dataSize = int64(binary.BigEndian.Uint64(plaintext))
+	if records == 0 && dataSize == 0 {
+		return 0, 0, nil
+	}
+	if records == 0 || dataSize <= (records-1)*chunkSize || dataSize > records*chunkSize {
+		return 0, 0, fmt.Errorf("encrypt: declared length %d does not match %d records", dataSize, records)
+	}
+	return dataSize, int(dataSize - (records-1)*chunkSize), nil
+}
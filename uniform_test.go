@@ -0,0 +1,85 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestNewUniformWriter(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	const recordSize = 5 + 12 + chunkSize + 16
+	const endRecordSize = 5 + 12 + 8 + 16
+	for _, size := range []int{0, 100, chunkSize, chunkSize*2 + 100} {
+		for _, chained := range []bool{false, true} {
+			plaintext := make([]byte, size)
+			for i := range plaintext {
+				plaintext[i] = byte(i)
+			}
+			buf := &bytes.Buffer{}
+			w := encrypt.NewUniformWriter(buf, key)
+			if chained {
+				w.EnableChain()
+			}
+			w.Write(plaintext)
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			h, _, err := encrypt.ReadHeader(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !h.Uniform {
+				t.Errorf("expected the header to report a uniform stream")
+			}
+			records := (size + chunkSize - 1) / chunkSize
+			if expected := h.Size + int64(records*recordSize+endRecordSize); int64(buf.Len()) != expected {
+				t.Errorf("size %d: expected every record to be full, for %d bytes; got %d", size, expected, buf.Len())
+			}
+
+			r := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+			decrypted, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("size %d, chained %v: %v", size, chained, err)
+			}
+			if !bytes.Equal(decrypted, plaintext) {
+				t.Errorf("size %d, chained %v: expected the padding to be removed; got %d bytes", size, chained, len(decrypted))
+			}
+			if declared, ok := r.DeclaredSize(); declared != int64(size) || !ok {
+				t.Errorf("size %d: expected a declared size of %d/true; got %d/%v", size, size, declared, ok)
+			}
+
+			for _, offset := range []int64{0, -1, -10, 5} {
+				if size == 0 && offset < 0 {
+					continue
+				}
+				n, err := r.Seek(offset, io.SeekEnd)
+				if err != nil {
+					t.Fatalf("size %d, chained %v: Seek(%d, io.SeekEnd): %v", size, chained, offset, err)
+				}
+				if n != int64(size)+offset {
+					t.Errorf("size %d: Seek(%d, io.SeekEnd): expected %d; got %d", size, offset, int64(size)+offset, n)
+				}
+				tail, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if offset <= 0 && !bytes.Equal(tail, plaintext[n:]) {
+					t.Errorf("size %d: Seek(%d, io.SeekEnd): plaintext does not match", size, offset)
+				}
+			}
+		}
+	}
+
+	w := encrypt.NewUniformWriter(&bytes.Buffer{}, key)
+	w.Write([]byte("Hello, world!"))
+	if err := w.Flush(); err == nil {
+		t.Errorf("expected Flush to fail for a uniform stream")
+	}
+	if err := w.EnableTOC(); err == nil {
+		t.Errorf("expected EnableTOC to fail for a uniform stream")
+	}
+}
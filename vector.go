@@ -0,0 +1,25 @@
+package encrypt
+
+import "encoding/binary"
+
+// sealVector encrypts plaintext as data record index of a stream whose header has the SHA-256 hash headerHash,
+// using nonce instead of a random one and the default AES-256-GCM cipher.
+// The output is the complete record as written by Writer:
+//
+//	'D' | uint32 length | nonce | ciphertext | tag
+//
+// where the tag authenticates the additional data 'D' | uint64 index | headerHash.
+// It exists to produce the fixed test vectors in testdata/vectors.json,
+// which let other implementations of the format check their output byte for byte;
+// reusing a nonce with the same key breaks the security of AES-GCM, so it must never be used to encrypt real data.
+// sealVector panics if nonce isn't 12 bytes long.
+func sealVector(key Key, nonce []byte, plaintext []byte, index int64, headerHash []byte) []byte {
+	aead, err := AEAD(key)
+	if err != nil {
+		panic(err)
+	}
+	record := append([]byte{recordData, 0, 0, 0, 0}, nonce...)
+	record = aead.Seal(record, nonce, plaintext, recordAD(recordData, index, headerHash))
+	binary.BigEndian.PutUint32(record[1:], uint32(len(record)-recordHeaderSize))
+	return record
+}
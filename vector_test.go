@@ -0,0 +1,154 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+var update = flag.Bool("update", false, "regenerate testdata/vectors.json")
+
+// vector is a test vector for a single data record, with every field hex encoded.
+// Header is a complete stream header written with the key, and HeaderHash is its SHA-256 hash,
+// which the record authenticates.
+type vector struct {
+	Key        string `json:"key"`
+	Nonce      string `json:"nonce"`
+	Index      int64  `json:"index"`
+	Header     string `json:"header"`
+	HeaderHash string `json:"header_hash"`
+	Plaintext  string `json:"plaintext"`
+	Record     string `json:"record"`
+}
+
+func TestSealVector(t *testing.T) {
+	if *update {
+		writeVectors(t)
+	}
+	data, err := os.ReadFile("testdata/vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []vector
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors) == 0 {
+		t.Fatal("no test vectors")
+	}
+	for i, v := range vectors {
+		var key encrypt.Key
+		copy(key[:], mustDecodeHex(t, v.Key))
+		nonce := mustDecodeHex(t, v.Nonce)
+		plaintext := mustDecodeHex(t, v.Plaintext)
+		header := mustDecodeHex(t, v.Header)
+		headerHash := mustDecodeHex(t, v.HeaderHash)
+		want := mustDecodeHex(t, v.Record)
+		if sum := sha256.Sum256(header); !bytes.Equal(sum[:], headerHash) {
+			t.Errorf("vector %d: expected the header hash to be the SHA-256 of the header %x; got %x", i, sum, headerHash)
+		}
+		if h, _, err := encrypt.ReadHeader(bytes.NewReader(header)); err != nil || h.Size != int64(len(header)) {
+			t.Errorf("vector %d: expected a complete header; got size %d of %d, %v", i, h.Size, len(header), err)
+		}
+		if got := encrypt.SealVector(key, nonce, plaintext, v.Index, headerHash); !bytes.Equal(got, want) {
+			t.Errorf("vector %d: expected %x; got %x", i, want, got)
+		}
+
+		// the record decrypts with plain AES-GCM and the documented additional data
+		if want[0] != 'D' || int(binary.BigEndian.Uint32(want[1:5])) != len(want)-5 {
+			t.Errorf("vector %d: malformed record prefix", i)
+			continue
+		}
+		ad := make([]byte, 9)
+		ad[0] = 'D'
+		binary.BigEndian.PutUint64(ad[1:], uint64(v.Index))
+		ad = append(ad, headerHash...)
+		gcm, err := encrypt.AEAD(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opened, err := gcm.Open(nil, want[5:5+len(nonce)], want[5+len(nonce):], ad)
+		if err != nil || !bytes.Equal(opened, plaintext) {
+			t.Errorf("vector %d: expected the record to decrypt; got %v", i, err)
+		}
+
+		// the first record of a stream is read by Reader when it follows the header
+		if v.Index == 0 {
+			r := encrypt.NewReader(io.MultiReader(bytes.NewReader(header), bytes.NewReader(want)), key)
+			got := make([]byte, len(plaintext))
+			if _, err := io.ReadFull(r, got); err != nil || !bytes.Equal(got, plaintext) {
+				t.Errorf("vector %d: expected Reader to decrypt the record after the header; got %v", i, err)
+			}
+		}
+	}
+}
+
+// writeVectors regenerates testdata/vectors.json.
+func writeVectors(t *testing.T) {
+	t.Helper()
+	var key encrypt.Key
+	for i := range key {
+		key[i] = byte(i)
+	}
+	nonce := make([]byte, 12)
+	for i := range nonce {
+		nonce[i] = byte(0xa0 + i)
+	}
+	// the header of a real stream, whose random stream ID and key check are fixed once written to the file
+	stream := &bytes.Buffer{}
+	w := encrypt.NewWriter(stream, key)
+	w.SetMetadata(map[string]string{"name": "vectors.json"})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	h, _, err := encrypt.ReadHeader(bytes.NewReader(stream.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := stream.Bytes()[:h.Size]
+	headerHash := sha256.Sum256(header)
+	var vectors []vector
+	for _, tc := range []struct {
+		plaintext []byte
+		index     int64
+	}{
+		{nil, 0},
+		{[]byte("Hello, world!"), 0},
+		{[]byte("Hello, world!"), 1},
+		{bytes.Repeat([]byte{0x55}, 100), 1<<32 + 7},
+	} {
+		vectors = append(vectors, vector{
+			Key:        hex.EncodeToString(key[:]),
+			Nonce:      hex.EncodeToString(nonce),
+			Index:      tc.index,
+			Header:     hex.EncodeToString(header),
+			HeaderHash: hex.EncodeToString(headerHash[:]),
+			Plaintext:  hex.EncodeToString(tc.plaintext),
+			Record:     hex.EncodeToString(encrypt.SealVector(key, nonce, tc.plaintext, tc.index, headerHash[:])),
+		})
+	}
+	data, err := json.MarshalIndent(vectors, "", "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("testdata/vectors.json", append(data, '\n'), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
@@ -0,0 +1,47 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"errors"
+	"io"
+)
+
+// NewVerifyingWriter returns a new Writer that encrypts data with key before writing to w,
+// and decrypts each chunk again immediately after encrypting it to check that it matches the plaintext.
+// This catches corruption from faulty memory or a broken cipher implementation
+// before the ciphertext is written, at roughly half the throughput of NewWriter.
+// The output is identical in format to that of NewWriter.
+//
+// Callers must call Close to write the final chunk of data.
+func NewVerifyingWriter(w io.Writer, key Key) *Writer {
+	return &Writer{
+		w:      w,
+		key:    key,
+		verify: true,
+	}
+}
+
+// seal encrypts plaintext with aead, appending the output to dst, and, for a verifying Writer,
+// checks that the result decrypts to the same plaintext.
+func (w *Writer) seal(aead cipher.AEAD, dst, plaintext, additionalData []byte) ([]byte, error) {
+	if w.sealed >= nonceLimit(aead) {
+		return nil, ErrNonceLimitReached
+	}
+	w.sealed++
+	var sealed []byte
+	var err error
+	if w.nonceKey != nil {
+		sealed = sealDeterministic(aead, w.nonceKey, dst, plaintext, additionalData)
+	} else {
+		sealed, err = sealRecord(aead, dst, plaintext, additionalData)
+	}
+	if err != nil || !w.verify {
+		return sealed, err
+	}
+	opened, err := decrypt(aead, nil, sealed[len(dst):], additionalData)
+	if err != nil || !bytes.Equal(opened, plaintext) {
+		return nil, errors.New("encrypt: verification of encrypted chunk failed")
+	}
+	return sealed, nil
+}
@@ -0,0 +1,30 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestNewVerifyingWriter(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	buf := &bytes.Buffer{}
+	w := encrypt.NewVerifyingWriter(buf, key)
+	w.Write(plaintext)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != len(plaintext)+3*encrypt.Overhead {
+		t.Errorf("expected the same format as NewWriter")
+	}
+	decrypted, err := io.ReadAll(encrypt.NewReader(buf, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("plaintext does not match")
+	}
+}
@@ -0,0 +1,89 @@
+package encrypt
+
+import (
+	"crypto/cipher"
+	"fmt"
+	"io"
+)
+
+// DecryptToWriterAt decrypts src, which is size bytes long and was encrypted by a Writer using key,
+// writing the plaintext of each chunk to dst at its offset in the decrypted stream.
+// Only one chunk is held in memory at a time,
+// and because each chunk is written independently of the others,
+// dst may be a sparse file or a region shared with other writers.
+//
+// If an error is returned, dst may contain some of the plaintext.
+func DecryptToWriterAt(dst io.WriterAt, src io.ReaderAt, size int64, key Key) error {
+	r := NewReaderSize(io.NewSectionReader(src, 0, size), key, size)
+	if err := r.detect(); err != nil {
+		return err
+	}
+	var buf []byte
+	var offset int64
+	for {
+		plaintext, err := r.next(buf[:0])
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := dst.WriteAt(plaintext, offset); err != nil {
+			return fmt.Errorf("encrypt.DecryptToWriterAt: %w", err)
+		}
+		offset += int64(len(plaintext))
+		buf = plaintext
+	}
+}
+
+// WriterAt encrypts chunks of a headerless stream independently of each other,
+// writing each one at its own offset in the output.
+// It is created by NewWriterAt.
+type WriterAt struct {
+	dst  io.WriterAt
+	aead cipher.AEAD
+	err  error
+}
+
+// NewWriterAt returns a WriterAt that encrypts chunks with key and writes them to dst,
+// producing the same format as NewWriter.
+// Every sector of that format has a fixed size, so the position of each chunk follows from its index,
+// which allows chunks to be encrypted and written in any order,
+// for example by several goroutines filling preallocated storage or the parts of a multipart upload.
+func NewWriterAt(dst io.WriterAt, key Key) *WriterAt {
+	w := &WriterAt{dst: dst}
+	if key.IsZero() {
+		w.err = ErrZeroKey
+		return w
+	}
+	w.aead, w.err = newGCM(key, nonceSize)
+	return w
+}
+
+// WriteChunk encrypts plaintext as the chunk at index and writes it to the underlying WriterAt
+// at offset index*SectorSize.
+// plaintext must hold exactly ChunkSize bytes, except for the final chunk of the stream, which may be shorter;
+// a short chunk anywhere else makes the stream fail to decrypt.
+// A stream of n bytes consists of the chunks 0 to (n-1)/ChunkSize,
+// and an empty stream has no chunks at all.
+//
+// WriteChunk may be called concurrently if the underlying WriterAt supports it, as *os.File does.
+func (w *WriterAt) WriteChunk(index int64, plaintext []byte) error {
+	if w.err != nil {
+		return w.err
+	}
+	switch {
+	case index < 0:
+		return fmt.Errorf("encrypt.WriterAt.WriteChunk: invalid chunk %d", index)
+	case len(plaintext) == 0 || len(plaintext) > chunkSize:
+		return fmt.Errorf("encrypt.WriterAt.WriteChunk: chunk of %d bytes must be between 1 and %d", len(plaintext), chunkSize)
+	}
+	sealed, err := encrypt(w.aead, plaintext, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := w.dst.WriteAt(sealed, index*SectorSize); err != nil {
+		return fmt.Errorf("encrypt.WriterAt.WriteChunk: %w", err)
+	}
+	return nil
+}
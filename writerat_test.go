@@ -0,0 +1,98 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/Travis-Britz/encrypt"
+)
+
+func TestDecryptToWriterAt(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := plaintextData()
+	for _, withHeader := range []bool{false, true} {
+		buf := &bytes.Buffer{}
+		w := encrypt.NewWriter(buf, key)
+		if withHeader {
+			w.SetChunkSize(4096)
+		}
+		w.Write(plaintext)
+		w.Close()
+
+		f, err := os.Create(t.TempDir() + "/plaintext")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := encrypt.DecryptToWriterAt(f, bytes.NewReader(buf.Bytes()), int64(buf.Len()), key); err != nil {
+			t.Fatal(err)
+		}
+		decrypted, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("header %t: plaintext does not match", withHeader)
+		}
+
+		ciphertext := buf.Bytes()
+		ciphertext[len(ciphertext)/2] ^= 0xff
+		if err := encrypt.DecryptToWriterAt(f, bytes.NewReader(ciphertext), int64(len(ciphertext)), key); !errors.Is(err, encrypt.ErrAuthFailed) {
+			t.Errorf("header %t: expected ErrAuthFailed; got %v", withHeader, err)
+		}
+	}
+}
+
+func TestWriterAt(t *testing.T) {
+	key, _ := encrypt.NewKey()
+	plaintext := make([]byte, encrypt.ChunkSize*4+100)
+	for i := range plaintext {
+		plaintext[i] = byte(i)
+	}
+	f, err := os.Create(t.TempDir() + "/ciphertext")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := encrypt.NewWriterAt(f, key)
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	// chunks are written concurrently and in reverse order
+	for i := int64(4); i >= 0; i-- {
+		chunk := plaintext[i*encrypt.ChunkSize:]
+		if len(chunk) > encrypt.ChunkSize {
+			chunk = chunk[:encrypt.ChunkSize]
+		}
+		wg.Add(1)
+		go func(i int64, chunk []byte) {
+			defer wg.Done()
+			errs <- w.WriteChunk(i, chunk)
+		}(i, chunk)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(encrypt.NewReader(f, key))
+	if err != nil || !bytes.Equal(got, plaintext) {
+		t.Errorf("decrypted stream doesn't match: %v", err)
+	}
+
+	if err := w.WriteChunk(0, make([]byte, encrypt.ChunkSize+1)); err == nil {
+		t.Errorf("expected an error for an oversized chunk")
+	}
+	if err := encrypt.NewWriterAt(f, encrypt.Key{}).WriteChunk(0, []byte("x")); !errors.Is(err, encrypt.ErrZeroKey) {
+		t.Errorf("expected ErrZeroKey; got %v", err)
+	}
+}